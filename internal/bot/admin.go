@@ -0,0 +1,256 @@
+package bot
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log/slog"
+	"rent_seekerbot/internal/database"
+	"rent_seekerbot/internal/i18n"
+	"rent_seekerbot/internal/ratelimit"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Broadcasts are sent more slowly than Telegram allows, leaving room for conversations.
+const (
+	broadcastRate  = 10
+	broadcastBurst = 10
+)
+
+// handleAdminButton processes the broadcast confirmation buttons.
+func (b *Bot) handleAdminButton(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	chatID := query.Message.Chat.ID
+	if !b.isAdmin(query.From.ID) {
+		b.answerCallback(ctx, query.ID, staleButtonMessage)
+		return
+	}
+	action := strings.TrimPrefix(query.Data, adminCallbackPrefix)
+	b.audit(ctx, query.From.ID, action, "")
+
+	b.broadcastMu.Lock()
+	text, ok := b.pendingBroadcasts[query.From.ID]
+	delete(b.pendingBroadcasts, query.From.ID)
+	b.broadcastMu.Unlock()
+
+	switch {
+	case !ok:
+		b.answerCallback(ctx, query.ID, broadcastNoneMessage)
+		return
+	case action == broadcastSendAction:
+		b.sendBroadcast(ctx, chatID, text)
+	default:
+		b.send(ctx, chatID, broadcastCancelledMessage)
+	}
+	b.answerCallback(ctx, query.ID, "")
+}
+
+// audit records an admin action. Failures are logged but don't stop the action.
+func (b *Bot) audit(ctx context.Context, adminID int64, action, details string) {
+	slog.InfoContext(ctx, "Admin action", "admin_id", adminID, "action", action, "details", details)
+	if err := b.store.LogAdminAction(adminID, action, details); err != nil {
+		slog.ErrorContext(ctx, "Error recording admin action", "error", err)
+	}
+}
+
+// showStats handles /stats.
+func (b *Bot) showStats(ctx context.Context, chatID int64) error {
+	stats, err := b.store.UserStats()
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user stats", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+	provider := b.providerStats.snapshot()
+	b.send(ctx, chatID, statsMessage, b.startedAt.Format(time.DateTime), stats.Users, stats.Groups,
+		stats.InConversation, stats.SavedSearches, stats.RoommateProfiles, stats.Blocked, provider.Calls,
+		b.listingsSent.Load(), b.alertsSent.Load(), provider.ErrorRate())
+	return nil
+}
+
+// startBroadcast handles /broadcast <text> by asking the admin to confirm the recipients.
+func (b *Bot) startBroadcast(ctx context.Context, chatID, adminID int64, text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		b.send(ctx, chatID, broadcastUsageMessage)
+		return nil
+	}
+	recipients, err := b.store.PrivateChatIDs()
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting broadcast recipients", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+
+	b.broadcastMu.Lock()
+	b.pendingBroadcasts[adminID] = text
+	b.broadcastMu.Unlock()
+	c := b.catalogue(ctx)
+	b.sendMessageWithMarkup(ctx, chatID, c.Plural(broadcastConfirmMessage, len(recipients), len(recipients), text),
+		broadcastConfirmation(c, len(recipients)))
+	return nil
+}
+
+// sendBroadcast delivers a confirmed broadcast in the background and reports back when done.
+func (b *Bot) sendBroadcast(ctx context.Context, chatID int64, text string) {
+	recipients, err := b.store.PrivateChatIDs()
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting broadcast recipients", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return
+	}
+	c := b.catalogue(ctx)
+	b.sendMessage(ctx, chatID, c.Plural(broadcastStartedMessage, len(recipients), len(recipients)))
+
+	b.background.Add(1)
+	go func() {
+		defer b.background.Done()
+		pace := ratelimit.NewBucket(broadcastRate, broadcastBurst)
+		delivered := 0
+		for _, recipient := range recipients {
+			time.Sleep(pace.Take(time.Now()))
+			if err := b.deliver(OutgoingMessage{ChatID: recipient, Text: text}); err != nil {
+				slog.WarnContext(ctx, "Failed to deliver broadcast", "chat_id", recipient, "error", err)
+				continue
+			}
+			delivered++
+		}
+		b.sendMessage(ctx, chatID, c.Plural(broadcastDoneMessage, len(recipients), delivered, len(recipients)))
+	}()
+}
+
+// showUser handles /user <chat ID>.
+func (b *Bot) showUser(ctx context.Context, chatID int64, args string) error {
+	userID, _, ok := parseUserID(args)
+	if !ok {
+		b.send(ctx, chatID, userUsageMessage)
+		return nil
+	}
+	userData, err := b.store.GetUser(userID)
+	if err == nil && userData == nil {
+		b.send(ctx, chatID, userNotFoundMessage, userID)
+		return nil
+	}
+	var blocked bool
+	if err == nil {
+		blocked, err = b.store.IsBlocked(userID)
+	}
+	var profile *database.RoommateProfile
+	if err == nil {
+		profile, err = b.store.GetRoommateProfile(userID)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user", "user_id", userID, "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+
+	c := b.catalogue(ctx)
+	state := userData.State
+	if state == "" {
+		state = c.Text(idleStateLabel)
+	}
+	roommateStatus := c.Text(noProfileLabel)
+	if profile != nil {
+		roommateStatus = c.Text(inactiveProfileLabel)
+		if profile.Active {
+			roommateStatus = c.Text(activeProfileLabel)
+		}
+	}
+	msg := c.Text(userDetailsMessage, userID, state, yesNo(c, blocked), roommateStatus, describeLanguage(c, userData)) + "\n"
+	if userData.StateOwner != 0 {
+		msg += c.Text(answeringMemberMessage, userData.StateOwner) + "\n"
+	}
+	b.sendMessage(ctx, chatID, msg+"\n"+describePreferences(c, userData))
+	return nil
+}
+
+// describeLanguage shows the language a chat chose with /language, or the language code
+// of its Telegram app when it follows the app.
+func describeLanguage(c *i18n.Catalogue, userData *database.UserData) string {
+	if userData.Language != "" {
+		return userData.Language
+	}
+	return c.Text(languageAutoLabel, userData.LanguageCode)
+}
+
+// showProviderStatus handles /provider status, checking the connection live.
+func (b *Bot) showProviderStatus(ctx context.Context, chatID int64) {
+	c := b.catalogue(ctx)
+	check := c.Text(providerCheckOKLabel)
+	if err := b.testProvider(ctx); err != nil {
+		check = "❌ " + err.Error()
+	}
+	provider := b.providerStats.snapshot()
+	b.sendMessage(ctx, chatID, c.Text(providerStatusMessage, check, provider.Calls, provider.Errors, provider.ErrorRate(),
+		provider.AvgLatency.Round(time.Millisecond), formatTime(c, provider.LastSuccessAt), describeLastError(c, provider)))
+}
+
+// formatTime formats a timestamp for admin messages, or "never" for the zero time.
+func formatTime(c *i18n.Catalogue, t time.Time) string {
+	if t.IsZero() {
+		return c.Text(neverLabel)
+	}
+	return t.Format(time.DateTime)
+}
+
+func describeLastError(c *i18n.Catalogue, provider providerSnapshot) string {
+	if provider.LastError == "" {
+		return c.Text(noneLabel)
+	}
+	return c.Text(lastErrorMessage, provider.LastError, formatTime(c, provider.LastErrorAt))
+}
+
+// isAdmin reports whether the user may use admin commands.
+func (b *Bot) isAdmin(userID int64) bool {
+	return b.admins[userID]
+}
+
+// parseUserID reads a user ID from the start of the command arguments and returns the rest.
+func parseUserID(args string) (int64, string, bool) {
+	idText, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	userID, err := strconv.ParseInt(idText, 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return userID, strings.TrimSpace(rest), true
+}
+
+// blockUser handles /block <user ID> [reason].
+func (b *Bot) blockUser(ctx context.Context, chatID int64, args string) error {
+	userID, reason, ok := parseUserID(args)
+	if !ok {
+		b.send(ctx, chatID, blockUsageMessage)
+		return nil
+	}
+	if err := b.store.BlockUser(userID, reason); err != nil {
+		slog.ErrorContext(ctx, "Error blocking user", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+	slog.InfoContext(ctx, "Blocked user", "user_id", userID, "details", reason)
+	b.send(ctx, chatID, userBlockedMessage, userID)
+	return nil
+}
+
+// unblockUser handles /unblock <user ID>.
+func (b *Bot) unblockUser(ctx context.Context, chatID int64, args string) error {
+	userID, _, ok := parseUserID(args)
+	if !ok {
+		b.send(ctx, chatID, unblockUsageMessage)
+		return nil
+	}
+	removed, err := b.store.UnblockUser(userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error unblocking user", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+	if !removed {
+		b.send(ctx, chatID, userNotBlockedMessage, userID)
+		return nil
+	}
+	slog.InfoContext(ctx, "Unblocked user", "user_id", userID)
+	b.send(ctx, chatID, userUnblockedMessage, userID)
+	return nil
+}
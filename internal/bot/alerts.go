@@ -0,0 +1,357 @@
+package bot
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log/slog"
+	"rent_seekerbot/internal/database"
+	"rent_seekerbot/internal/delivery"
+	"rent_seekerbot/internal/fsm"
+	"rent_seekerbot/internal/i18n"
+	"rent_seekerbot/internal/logging"
+	"rent_seekerbot/internal/metrics"
+	"rent_seekerbot/internal/ranking"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultAlertInterval is how often saved searches are run for new listings.
+	defaultAlertInterval = 30 * time.Minute
+	// outboxInterval is how often the outbox is checked for alerts that are due.
+	outboxInterval = time.Minute
+	// outboxRetention is how long listings stay in the outbox. Until then they aren't
+	// alerted again.
+	outboxRetention = 30 * 24 * time.Hour
+	// maxDigestListings is the most listings a digest lists; the rest are counted.
+	maxDigestListings = 10
+)
+
+// deliveryOptions are the delivery modes offered by /alerts.
+var deliveryOptions = []option{
+	{delivery.Instant, alertsInstantButtonText},
+	{delivery.Hourly, alertsHourlyButtonText},
+	{delivery.Daily, alertsDailyButtonText},
+	{delivery.Off, alertsOffButtonText},
+}
+
+// alertSchedule returns the user's delivery preference.
+func alertSchedule(userData *database.UserData) delivery.Schedule {
+	return delivery.NewSchedule(userData.Delivery, userData.DigestTime, userData.QuietHours, userData.Timezone)
+}
+
+// watchAlerts runs the saved searches for new listings every alertInterval, and sends
+// the alerts that are due every outboxInterval, until ctx is cancelled.
+func (b *Bot) watchAlerts(ctx context.Context) {
+	searches := time.NewTicker(b.alertInterval)
+	defer searches.Stop()
+	outbox := time.NewTicker(outboxInterval)
+	defer outbox.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-searches.C:
+			b.checkSavedSearches(ctx)
+		case now := <-outbox.C:
+			b.deliverAlerts(ctx, now)
+		}
+	}
+}
+
+// checkSavedSearches runs every private chat's saved search and queues the listings it
+// hasn't been sent in its outbox. Nothing is checked while the provider is down.
+func (b *Bot) checkSavedSearches(ctx context.Context) {
+	ctx = logging.WithCorrelationID(ctx, logging.NewCorrelationID())
+	if !b.providerAvailable() {
+		return
+	}
+	chatIDs, err := b.store.PrivateChatIDs()
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing chats for alerts", "error", err)
+		return
+	}
+	checked, queued := 0, 0
+	for _, chatID := range chatIDs {
+		if ctx.Err() != nil {
+			return
+		}
+		userData, err := b.store.GetUser(chatID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error getting user data", "chat_id", chatID, "error", err)
+			continue
+		}
+		if userData == nil || !b.watchesSearch(userData) {
+			continue
+		}
+		results, failure := b.findListings(ctx, userData)
+		if failure != "" {
+			continue
+		}
+		checked++
+		added, err := b.store.QueueNotifications(chatID, notifications(results))
+		if err != nil {
+			slog.ErrorContext(ctx, "Error queueing alerts", "chat_id", chatID, "error", err)
+			continue
+		}
+		queued += added
+	}
+	if _, err := b.store.PruneNotifications(time.Now().Add(-outboxRetention)); err != nil {
+		slog.ErrorContext(ctx, "Error pruning the outbox", "error", err)
+	}
+	slog.InfoContext(ctx, "Checked saved searches for new listings", "searches", checked, "queued", queued)
+}
+
+// watchesSearch reports whether the user has a complete saved search and wants alerts for it.
+func (b *Bot) watchesSearch(userData *database.UserData) bool {
+	return alertSchedule(userData).Mode != delivery.Off && len(missingPreferences(b.locales.Default(), userData)) == 0
+}
+
+// notifications turns search results into outbox entries.
+func notifications(results []ranking.Result) []database.Notification {
+	entries := make([]database.Notification, 0, len(results))
+	for _, result := range results {
+		property := result.Property
+		entries = append(entries, database.Notification{
+			ListingID: property.ID,
+			Address:   property.Address,
+			Price:     property.Price,
+			Bedrooms:  property.Bedrooms,
+			URL:       property.URL,
+		})
+	}
+	return entries
+}
+
+// deliverAlerts sends every chat with alerts waiting those that are due at now.
+func (b *Bot) deliverAlerts(ctx context.Context, now time.Time) {
+	chatIDs, err := b.store.ChatsWithPendingNotifications()
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing chats with alerts waiting", "error", err)
+		return
+	}
+	for _, chatID := range chatIDs {
+		if ctx.Err() != nil {
+			return
+		}
+		b.deliverChatAlerts(ctx, chatID, now)
+	}
+}
+
+// deliverChatAlerts sends the alerts waiting for a chat if its schedule is due, as one
+// message listing them all. They stay in the outbox if sending fails, to be retried.
+func (b *Bot) deliverChatAlerts(ctx context.Context, chatID int64, now time.Time) {
+	userData, err := b.store.GetUser(chatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user data", "chat_id", chatID, "error", err)
+		return
+	}
+	if userData == nil {
+		userData = &database.UserData{}
+	}
+	pending, err := b.store.PendingNotifications(chatID)
+	if err != nil || len(pending) == 0 {
+		if err != nil {
+			slog.ErrorContext(ctx, "Error getting alerts waiting", "chat_id", chatID, "error", err)
+		}
+		return
+	}
+	ids := make([]int64, 0, len(pending))
+	for _, n := range pending {
+		ids = append(ids, n.ID)
+	}
+
+	schedule := alertSchedule(userData)
+	if schedule.Mode == delivery.Off {
+		// Alerts queued before they were turned off are dropped
+		if err := b.store.DropNotifications(ids, now); err != nil {
+			slog.ErrorContext(ctx, "Error dropping alerts", "chat_id", chatID, "error", err)
+		}
+		return
+	}
+	last, err := b.store.LastAlertSent(chatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting the last alert", "chat_id", chatID, "error", err)
+		return
+	}
+	if !schedule.Due(now, last, pending[0].QueuedAt) {
+		return
+	}
+
+	c := b.userCatalogue(userData, "")
+	if err := b.deliver(OutgoingMessage{ChatID: chatID, Text: digestText(c, pending)}); err != nil {
+		slog.ErrorContext(ctx, "Failed to send alerts", "chat_id", chatID, "error", err)
+		return
+	}
+	if err := b.store.MarkSent(ids, now); err != nil {
+		slog.ErrorContext(ctx, "Error marking alerts sent", "chat_id", chatID, "error", err)
+	}
+	trigger := "digest"
+	if schedule.Mode == delivery.Instant {
+		trigger = "alert"
+	}
+	b.alertsSent.Add(int64(len(pending)))
+	metrics.AlertsSent.WithLabelValues(trigger).Add(float64(len(pending)))
+}
+
+// digestText lists alerts compactly, one line each with its link below, in the language
+// of c. Past maxDigestListings the rest are only counted.
+func digestText(c *i18n.Catalogue, pending []database.Notification) string {
+	var text strings.Builder
+	text.WriteString(c.Plural(digestHeaderMessage, len(pending), len(pending)))
+	for i, n := range pending {
+		if i == maxDigestListings {
+			rest := len(pending) - maxDigestListings
+			text.WriteString("\n" + c.Plural(digestMoreMessage, rest, rest))
+			break
+		}
+		text.WriteString("\n" + c.Plural(digestLineMessage, n.Bedrooms, n.Address, n.Price, n.Bedrooms))
+		if n.URL != "" {
+			text.WriteString("\n   " + n.URL)
+		}
+	}
+	return text.String()
+}
+
+// showAlertSettings handles /alerts by showing how new listings are sent, with buttons
+// to change it.
+func (b *Bot) showAlertSettings(ctx context.Context, chatID int64) error {
+	userData, err := b.getUserData(chatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user data", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+	c := b.catalogue(ctx)
+	schedule := alertSchedule(userData)
+	quiet := c.Text(quietHoursNoneLabel)
+	if schedule.QuietStart != schedule.QuietEnd {
+		quiet = formatQuietHours(schedule.QuietStart, schedule.QuietEnd)
+	}
+	text := c.Text(alertSettingsMessage, deliveryLabel(c, schedule), quiet,
+		schedule.Location.String(), time.Now().In(schedule.Location).Format(clockLayout))
+	if len(missingPreferences(c, userData)) > 0 {
+		text += "\n\n" + c.Text(alertsNoSearchMessage)
+	}
+	b.sendMessageWithMarkup(ctx, chatID, text, alertsMenu(c, schedule.Mode))
+	return nil
+}
+
+// clockLayout formats times of day in alert settings.
+const clockLayout = "15:04"
+
+// deliveryLabel describes how new listings are sent, in the language of c.
+func deliveryLabel(c *i18n.Catalogue, schedule delivery.Schedule) string {
+	switch schedule.Mode {
+	case delivery.Hourly:
+		return c.Text(deliveryHourlyLabel)
+	case delivery.Daily:
+		return c.Text(deliveryDailyLabel, delivery.FormatClock(schedule.DigestAt))
+	case delivery.Off:
+		return c.Text(deliveryOffLabel)
+	default:
+		return c.Text(deliveryInstantLabel)
+	}
+}
+
+// formatQuietHours shows quiet hours to users, e.g. "22:00–07:00".
+func formatQuietHours(start, end int) string {
+	return delivery.FormatClock(start) + "–" + delivery.FormatClock(end)
+}
+
+// handleAlertsButton handles the /alerts menu: instant alerts, hourly digests and turning
+// alerts off are set straight away, while a daily digest, quiet hours and the time zone
+// are asked for. It returns the text to answer the button press with.
+func (b *Bot) handleAlertsButton(ctx context.Context, query *tgbotapi.CallbackQuery, userData *database.UserData) string {
+	chatID := query.Message.Chat.ID
+	action := strings.TrimPrefix(query.Data, alertsCallbackPrefix)
+	if userData.State != string(fsm.Idle) && userData.Editing == "" {
+		// A menu from an earlier message shouldn't abandon the questions being answered
+		return finishCurrentStepMessage
+	}
+
+	var state fsm.State
+	switch action {
+	case delivery.Instant, delivery.Hourly, delivery.Off:
+		userData.Delivery = action
+		c := b.catalogue(ctx)
+		b.sendMessage(ctx, chatID, c.Text(deliverySetMessage, deliveryLabel(c, alertSchedule(userData))))
+		return ""
+	case delivery.Daily:
+		state = stateSelectingDigestTime
+	case alertsQuietHoursAction:
+		state = stateSelectingQuietHours
+	case alertsTimezoneAction:
+		state = stateAwaitingTimezone
+	default:
+		return staleButtonMessage
+	}
+	userData.State = string(state)
+	userData.Editing = ""
+	userData.History = nil
+	promptFor(ctx, b, chatID, b.searchFlow(ctx), state, userData)
+	return ""
+}
+
+// answerOrButton returns a typed answer, or the value of a button whose callback data
+// is prefix + the value. It reports false for any other button.
+func answerOrButton(in fsm.Input, prefix string) (string, bool) {
+	if in.Data == "" {
+		return in.Text, true
+	}
+	return strings.CutPrefix(in.Data, prefix)
+}
+
+// onDigestTime switches to a daily digest at the time picked or typed.
+func onDigestTime(c *i18n.Catalogue) fsm.Handler[*database.UserData] {
+	return func(u *database.UserData, in fsm.Input) (fsm.Outcome, error) {
+		answer, ok := answerOrButton(in, digestTimeCallbackPrefix)
+		if !ok {
+			return fsm.Outcome{}, fsm.ErrUnexpectedInput
+		}
+		at, err := delivery.ParseClock(answer)
+		if err != nil {
+			return fsm.Outcome{}, fsm.Reject(c.Text(invalidDigestTimeMessage))
+		}
+		u.Delivery = delivery.Daily
+		u.DigestTime = delivery.FormatClock(at)
+		return fsm.GoWithNotice(fsm.Idle, c.Text(deliverySetMessage, deliveryLabel(c, alertSchedule(u)))), nil
+	}
+}
+
+// onQuietHours stores the quiet hours picked or typed, or clears them.
+func onQuietHours(c *i18n.Catalogue) fsm.Handler[*database.UserData] {
+	return func(u *database.UserData, in fsm.Input) (fsm.Outcome, error) {
+		answer, ok := answerOrButton(in, quietHoursCallbackPrefix)
+		if !ok {
+			return fsm.Outcome{}, fsm.ErrUnexpectedInput
+		}
+		if in.Data != "" && answer == quietHoursOffAnswer {
+			u.QuietHours = ""
+			return fsm.GoWithNotice(fsm.Idle, c.Text(quietHoursClearedMessage)), nil
+		}
+		start, end, err := delivery.ParseQuietHours(answer)
+		if err != nil {
+			return fsm.Outcome{}, fsm.Reject(c.Text(invalidQuietHoursMessage))
+		}
+		u.QuietHours = delivery.FormatQuietHours(start, end)
+		return fsm.GoWithNotice(fsm.Idle, c.Text(quietHoursSetMessage, formatQuietHours(start, end))), nil
+	}
+}
+
+// onTimezone stores the time zone picked or typed, showing its time so the user can
+// check it.
+func onTimezone(c *i18n.Catalogue) fsm.Handler[*database.UserData] {
+	return func(u *database.UserData, in fsm.Input) (fsm.Outcome, error) {
+		answer, ok := answerOrButton(in, timezoneCallbackPrefix)
+		if !ok {
+			return fsm.Outcome{}, fsm.ErrUnexpectedInput
+		}
+		location, err := delivery.LoadTimezone(answer)
+		if err != nil {
+			return fsm.Outcome{}, fsm.Reject(c.Text(invalidTimezoneMessage, strings.TrimSpace(answer)))
+		}
+		u.Timezone = location.String()
+		return fsm.GoWithNotice(fsm.Idle, c.Text(timezoneSetMessage, u.Timezone, time.Now().In(location).Format(clockLayout))), nil
+	}
+}
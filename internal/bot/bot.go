@@ -0,0 +1,173 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"rent_seekerbot/internal/commute"
+	"rent_seekerbot/internal/database"
+	"rent_seekerbot/internal/geo"
+	"rent_seekerbot/internal/i18n"
+	"rent_seekerbot/internal/noise"
+	"rent_seekerbot/internal/query"
+	"rent_seekerbot/internal/ratelimit"
+	"rent_seekerbot/internal/real_estate_api"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Store persists users, roommate profiles, group shortlists and alerts. *database.DB implements it.
+type Store interface {
+	GetUser(chatID int64) (*database.UserData, error)
+	SaveUser(chatID int64, userData *database.UserData) error
+
+	GetRoommateProfile(chatID int64) (*database.RoommateProfile, error)
+	SaveRoommateProfile(profile *database.RoommateProfile) error
+	ActiveRoommateProfiles(excludeChatID int64) ([]database.RoommateProfile, error)
+	GetRoommateMatch(chatID, otherID int64) (*database.RoommateMatch, error)
+	GetRoommateMatchByID(id string) (*database.RoommateMatch, error)
+	ProposeRoommateMatch(chatID, otherID int64) (*database.RoommateMatch, error)
+	SaveRoommateDecision(matchID string, chatID int64, status string) (*database.RoommateMatch, error)
+
+	AddToShortlist(chatID int64, entry database.ShortlistEntry) error
+	SaveVote(chatID int64, listingID string, userID int64, vote int) error
+	VoteCounts(chatID int64, listingID string) (int, int, error)
+	Tally(chatID int64, limit int) ([]database.ShortlistEntry, error)
+
+	BlockUser(userID int64, reason string) error
+	UnblockUser(userID int64) (bool, error)
+	IsBlocked(userID int64) (bool, error)
+
+	UserStats() (database.UserStats, error)
+	PrivateChatIDs() ([]int64, error)
+	LogAdminAction(adminID int64, action, details string) error
+
+	QueueNotifications(chatID int64, notifications []database.Notification) (int, error)
+	RecordShown(chatID int64, notifications []database.Notification, at time.Time) error
+	PendingNotifications(chatID int64) ([]database.Notification, error)
+	ChatsWithPendingNotifications() ([]int64, error)
+	LastAlertSent(chatID int64) (time.Time, error)
+	MarkSent(ids []int64, at time.Time) error
+	DropNotifications(ids []int64, at time.Time) error
+	PruneNotifications(before time.Time) (int64, error)
+
+	PingContext(ctx context.Context) error
+}
+
+// Bot holds everything needed to answer updates. Several bots can run in one process,
+// each with its own messenger, store and listings provider.
+type Bot struct {
+	messenger Messenger
+	store     Store
+	provider  real_estate_api.ZooplaClientInterface
+
+	gazetteer   *geo.Gazetteer
+	network     *commute.Network
+	noise       *noise.Index
+	queryParser *query.Parser
+
+	// locales holds the message catalogues, and flows the conversations asked in each
+	// of them, keyed by language tag.
+	locales *i18n.Bundle
+	flows   map[string]flows
+
+	// searchQuota limits how often each user can run a provider search.
+	searchQuota *ratelimit.Keyed
+	// alertInterval is how often saved searches are run for new listings.
+	alertInterval time.Duration
+	// admins holds the user IDs allowed to use admin commands.
+	admins map[int64]bool
+	// commands is the registry of bot commands, see newCommands.
+	commands []command
+
+	startedAt     time.Time
+	providerStats providerStats
+	// listingsSent counts search results shown to users, alertsSent listings sent as alerts
+	// and digests.
+	listingsSent  atomic.Int64
+	alertsSent    atomic.Int64
+	providerCheck providerCheck
+	// pendingBroadcasts holds each admin's /broadcast text until they confirm it.
+	broadcastMu       sync.Mutex
+	pendingBroadcasts map[int64]string
+	// pendingQueries holds each chat's search typed in plain text until it is saved from
+	// the confirmation card, cancelled, replaced or expired.
+	queryMu        sync.Mutex
+	pendingQueries map[int64]pendingQuery
+	// background tracks work that outlives an update, such as broadcasts.
+	background sync.WaitGroup
+}
+
+// Each user can run searchQuotaBurst searches in a row, then one every searchQuotaInterval.
+const (
+	searchQuotaBurst    = 3
+	searchQuotaInterval = 30 * time.Second
+)
+
+// New creates a bot and loads the embedded place, transit and noise datasets.
+func New(messenger Messenger, store Store, provider real_estate_api.ZooplaClientInterface) (*Bot, error) {
+	if messenger == nil {
+		return nil, fmt.Errorf("messenger is nil")
+	}
+	if store == nil {
+		return nil, fmt.Errorf("store is nil")
+	}
+	if provider == nil {
+		return nil, fmt.Errorf("provider is nil")
+	}
+
+	b := &Bot{
+		messenger:     messenger,
+		store:         store,
+		provider:      provider,
+		searchQuota:   ratelimit.NewKeyed(1/searchQuotaInterval.Seconds(), searchQuotaBurst),
+		alertInterval: defaultAlertInterval,
+		admins:        make(map[int64]bool),
+		startedAt:     time.Now(),
+
+		pendingBroadcasts: make(map[int64]string),
+		pendingQueries:    make(map[int64]pendingQuery),
+	}
+	var err error
+	b.gazetteer, err = geo.NewGazetteer()
+	if err != nil {
+		return nil, fmt.Errorf("error loading gazetteer: %w", err)
+	}
+	b.queryParser = query.NewParser(b.gazetteer)
+	b.network, err = commute.NewNetwork()
+	if err != nil {
+		return nil, fmt.Errorf("error loading transit network: %w", err)
+	}
+	b.noise, err = noise.NewIndex()
+	if err != nil {
+		return nil, fmt.Errorf("error loading noise sources: %w", err)
+	}
+	b.locales, err = i18n.NewBundle()
+	if err != nil {
+		return nil, fmt.Errorf("error loading message catalogues: %w", err)
+	}
+	b.flows = make(map[string]flows)
+	for _, c := range b.locales.Catalogues() {
+		b.flows[c.Tag()] = flows{search: b.newSearchFlow(c), roommate: b.newRoommateFlow(c)}
+	}
+	b.commands = b.newCommands()
+	return b, nil
+}
+
+// SetSearchQuota lets each user run burst searches in a row, then one every interval.
+func (b *Bot) SetSearchQuota(burst int, interval time.Duration) {
+	b.searchQuota = ratelimit.NewKeyed(1/interval.Seconds(), burst)
+}
+
+// SetAlertInterval sets how often saved searches are run for new listings.
+func (b *Bot) SetAlertInterval(interval time.Duration) {
+	b.alertInterval = interval
+}
+
+// SetAdmins sets the users allowed to use admin commands.
+func (b *Bot) SetAdmins(userIDs ...int64) {
+	b.admins = make(map[int64]bool, len(userIDs))
+	for _, id := range userIDs {
+		b.admins[id] = true
+	}
+}
@@ -0,0 +1,361 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"rent_seekerbot/internal/database"
+	"rent_seekerbot/internal/fsm"
+	"rent_seekerbot/internal/i18n"
+	"rent_seekerbot/internal/ranking"
+	"rent_seekerbot/internal/real_estate_api"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const testChatID = 100
+
+// Listings returned by the fake provider: two in Hackney and one in Croydon, well outside
+// a one mile radius of Hackney.
+var testListings = []real_estate_api.Property{
+	{ID: "1", Address: "1 Mare Street, London E8", Price: 1500, Bedrooms: 2, Latitude: 51.5450, Longitude: -0.0553, URL: "https://example.com/1"},
+	{ID: "2", Address: "2 Well Street, London E9", Price: 1800, Bedrooms: 2, Latitude: 51.5420, Longitude: -0.0490, URL: "https://example.com/2"},
+	{ID: "3", Address: "3 High Street, Croydon CR0", Price: 1200, Bedrooms: 2, Latitude: 51.3720, Longitude: -0.0990, URL: "https://example.com/3"},
+}
+
+// testBot is a bot wired to fakes, driven through HandleUpdate as Telegram would.
+type testBot struct {
+	t         *testing.T
+	bot       *Bot
+	messenger *RecordingMessenger
+	store     *fakeStore
+	provider  *fakeProvider
+	catalogue *i18n.Catalogue
+	user      *tgbotapi.User
+	chat      *tgbotapi.Chat
+}
+
+func newTestBot(t *testing.T) *testBot {
+	t.Helper()
+	messenger := NewRecordingMessenger()
+	store := newFakeStore()
+	provider := &fakeProvider{listings: testListings}
+	b, err := New(messenger, store, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testBot{
+		t:         t,
+		bot:       b,
+		messenger: messenger,
+		store:     store,
+		provider:  provider,
+		catalogue: b.locales.Default(),
+		user:      &tgbotapi.User{ID: testChatID, FirstName: "Ann", LanguageCode: "en"},
+		chat:      &tgbotapi.Chat{ID: testChatID, Type: "private"},
+	}
+}
+
+// send sends text to the bot, as a command if it starts with a slash.
+func (tb *testBot) send(text string) {
+	message := &tgbotapi.Message{MessageID: 1, From: tb.user, Chat: tb.chat, Text: text}
+	if strings.HasPrefix(text, "/") {
+		length, _, _ := strings.Cut(text, " ")
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: len(length)}}
+	}
+	tb.bot.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+}
+
+// press presses a button with the given callback data.
+func (tb *testBot) press(data string) {
+	tb.bot.HandleUpdate(context.Background(), tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      "callback",
+		From:    tb.user,
+		Data:    data,
+		Message: &tgbotapi.Message{MessageID: 1, Chat: tb.chat},
+	}})
+}
+
+// state returns the conversation state the store holds for the chat.
+func (tb *testBot) state() fsm.State {
+	return fsm.State(tb.store.user(testChatID).State)
+}
+
+// sent reports whether a message with exactly text was sent.
+func (tb *testBot) sent(text string) bool {
+	for _, message := range tb.messenger.Messages() {
+		if message.Text == text {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOnboardingToResults(t *testing.T) {
+	tb := newTestBot(t)
+	steps := []struct {
+		name  string
+		do    func()
+		state fsm.State
+	}{
+		{name: "start", do: func() { tb.send("/start") }, state: fsm.Idle},
+		{name: "go", do: func() { tb.press(goCallbackData) }, state: stateSelectingProperty},
+		{name: "property", do: func() { tb.press(propertyCallbackPrefix + propertyFlat) }, state: stateAwaitingPriceRange},
+		{name: "price range", do: func() { tb.send("£1,000 - £2,000") }, state: stateAwaitingBedrooms},
+		{name: "bedrooms typed", do: func() { tb.send("2") }, state: stateFurnishedUnfurnished},
+		{name: "furnished", do: func() { tb.press(furnishedCallbackPrefix + furnishedAnswer) }, state: stateSelectingPets},
+		{name: "pets", do: func() { tb.press(petsCallbackPrefix + petsNone) }, state: stateSelectingNoise},
+		{name: "noise", do: func() { tb.press(noiseCallbackPrefix + noiseAny) }, state: stateSelectingArea},
+		{name: "area", do: func() { tb.send("Hackney") }, state: stateSelectingRadius},
+		{name: "radius", do: func() { tb.press(radiusCallbackPrefix + "1") }, state: fsm.Idle},
+	}
+	for _, step := range steps {
+		before := len(tb.messenger.Messages())
+		step.do()
+		if got := tb.state(); got != step.state {
+			t.Fatalf("after %s: state = %q, want %q", step.name, got, step.state)
+		}
+		if len(tb.messenger.Messages()) == before {
+			t.Fatalf("after %s: nothing was sent", step.name)
+		}
+	}
+
+	want := searchCall{Area: "Hackney", MinPrice: 1000, MaxPrice: 2000, Bedrooms: 2, PropertyType: propertyFlat}
+	if searches := tb.provider.searches(); len(searches) != 1 || searches[0] != want {
+		t.Fatalf("searches = %+v, want [%+v]", searches, want)
+	}
+	// Croydon is outside the radius
+	if !tb.sent(tb.catalogue.Plural(resultsFoundMessage, 2, 2)) {
+		t.Error("results count wasn't sent")
+	}
+	for _, message := range tb.messenger.Messages() {
+		if strings.Contains(message.Text, "Croydon") {
+			t.Errorf("listing outside the radius was sent: %q", message.Text)
+		}
+	}
+	if last, _ := tb.messenger.Last(); last.Text != tb.catalogue.Text(newSearchMessage) {
+		t.Errorf("last message = %q, want the new search hint", last.Text)
+	}
+	// Shown listings aren't alerted later
+	if pending, _ := tb.store.PendingNotifications(testChatID); len(pending) != 0 {
+		t.Errorf("pending alerts = %+v, want none", pending)
+	}
+	if queued, _ := tb.store.QueueNotifications(testChatID, notificationsFor(testListings[:2])); queued != 0 {
+		t.Errorf("QueueNotifications() queued %d shown listings", queued)
+	}
+
+	saved := tb.store.user(testChatID)
+	if saved.Area != "Hackney" || saved.PriceRange != "1000 - 2000" || saved.Bedrooms != "2" || saved.RadiusMiles != 1 {
+		t.Errorf("saved preferences = %+v", saved)
+	}
+	if len(saved.History) != 0 {
+		t.Errorf("History = %v, want it cleared after the search", saved.History)
+	}
+}
+
+func notificationsFor(properties []real_estate_api.Property) []database.Notification {
+	var notifications []database.Notification
+	for _, property := range properties {
+		notifications = append(notifications, database.Notification{ListingID: property.ID})
+	}
+	return notifications
+}
+
+func TestStaleButtonIsAnsweredAndIgnored(t *testing.T) {
+	tb := newTestBot(t)
+	tb.send("/start")
+	tb.press(goCallbackData)
+	tb.messenger.Reset()
+
+	tb.press(radiusCallbackPrefix + "1")
+	if got := tb.state(); got != stateSelectingProperty {
+		t.Errorf("state = %q, want %q", got, stateSelectingProperty)
+	}
+	callbacks := tb.messenger.Callbacks()
+	if len(callbacks) != 1 || callbacks[0].Text != tb.catalogue.Text(staleButtonMessage) {
+		t.Errorf("callbacks = %+v, want the stale button answer", callbacks)
+	}
+	if len(tb.messenger.Edits()) != 1 {
+		t.Errorf("edits = %+v, want the stale buttons removed", tb.messenger.Edits())
+	}
+	if len(tb.provider.searches()) != 0 {
+		t.Error("a stale button ran a search")
+	}
+}
+
+func TestInvalidAnswerIsExplained(t *testing.T) {
+	tb := newTestBot(t)
+	tb.send("/start")
+	tb.press(goCallbackData)
+	tb.press(propertyCallbackPrefix + propertyFlat)
+	tb.messenger.Reset()
+
+	tb.send("cheap")
+	if got := tb.state(); got != stateAwaitingPriceRange {
+		t.Errorf("state = %q, want %q", got, stateAwaitingPriceRange)
+	}
+	if len(tb.messenger.Messages()) == 0 {
+		t.Error("the invalid price range wasn't explained")
+	}
+}
+
+func TestProviderErrorIsReported(t *testing.T) {
+	tb := newTestBot(t)
+	tb.provider.err = errors.New("provider down")
+	tb.send("/start")
+	for _, data := range []string{goCallbackData, propertyCallbackPrefix + propertyFlat} {
+		tb.press(data)
+	}
+	tb.send("1000-2000")
+	for _, data := range []string{bedroomsCallbackPrefix + "2", furnishedCallbackPrefix + furnishedAnswer, petsCallbackPrefix + petsNone, noiseCallbackPrefix + noiseAny} {
+		tb.press(data)
+	}
+	tb.send("Hackney")
+	tb.press(radiusCallbackPrefix + "1")
+
+	if !tb.sent(tb.catalogue.Text(searchErrorMessage)) {
+		t.Error("the search error wasn't reported")
+	}
+	if tb.sent(tb.catalogue.Text(newSearchMessage)) {
+		t.Error("results were reported for a failed search")
+	}
+}
+
+func TestBlockedUserIsIgnored(t *testing.T) {
+	tb := newTestBot(t)
+	if err := tb.store.BlockUser(testChatID, "spam"); err != nil {
+		t.Fatal(err)
+	}
+	tb.send("/start")
+	tb.press(goCallbackData)
+	if messages := tb.messenger.Messages(); len(messages) != 0 {
+		t.Errorf("messages = %+v, want none for a blocked user", messages)
+	}
+	if len(tb.messenger.Callbacks()) != 0 {
+		t.Error("a blocked user's button was answered")
+	}
+}
+
+func TestCommuteOrdersResultsByDefault(t *testing.T) {
+	tb := newTestBot(t)
+	userData := &database.UserData{
+		PropertyType:       propertyFlat,
+		PriceRange:         "1000 - 2000",
+		Bedrooms:           "2",
+		Area:               "Hackney",
+		CommuteDestination: "Liverpool Street",
+		CommuteLatitude:    51.5178,
+		CommuteLongitude:   -0.0823,
+		MaxCommuteMinutes:  90,
+	}
+	results, failure := tb.bot.findListings(context.Background(), userData)
+	if failure != "" || len(results) < 2 {
+		t.Fatalf("findListings() = %+v, %q", results, failure)
+	}
+	for i, result := range results {
+		if result.Minutes < 0 {
+			t.Fatalf("result %d has no commute time", i)
+		}
+		if i > 0 && result.Minutes < results[i-1].Minutes {
+			t.Errorf("results aren't quickest first: %d min after %d min", result.Minutes, results[i-1].Minutes)
+		}
+	}
+
+	// An order chosen with /sort still wins
+	userData.SortOrder = ranking.BestMatch
+	results, _ = tb.bot.findListings(context.Background(), userData)
+	for i := 1; i < len(results); i++ {
+		if results[i].Score > results[i-1].Score {
+			t.Errorf("results aren't best match first: %d after %d", results[i].Score, results[i-1].Score)
+		}
+	}
+}
+
+func TestAdminReportsStayOutOfGroups(t *testing.T) {
+	tb := newTestBot(t)
+	tb.bot.SetAdmins(testChatID)
+	tb.chat = &tgbotapi.Chat{ID: -testChatID, Type: "group"}
+
+	refusal := tb.catalogue.Text(privateOnlyCommandMessage)
+	for _, command := range []string{"/stats", "/user 42", "/provider status"} {
+		tb.messenger.Reset()
+		tb.send(command)
+		if messages := tb.messenger.Messages(); len(messages) != 1 || messages[0].Text != refusal {
+			t.Errorf("%s in a group sent %+v, want only the private-only refusal", command, messages)
+		}
+	}
+}
+
+func TestRoommateDecisionNeedsAMatchProposedToTheUser(t *testing.T) {
+	tb := newTestBot(t)
+	for _, chatID := range []int64{testChatID, 200, 300} {
+		profile := database.RoommateProfile{ChatID: chatID, FirstName: "User", Active: true,
+			MinBudget: 800, MaxBudget: 1200, Areas: "Hackney", WorkFromHome: "no", Cleanliness: 3}
+		if err := tb.store.SaveRoommateProfile(&profile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	others, _ := tb.store.ProposeRoommateMatch(200, 300)
+	own, _ := tb.store.ProposeRoommateMatch(testChatID, 200)
+
+	// Neither someone else's match nor a chat ID can be accepted
+	for _, data := range []string{"rm:accept:" + others.ID, "rm:accept:200", "rm:accept:"} {
+		tb.press(data)
+	}
+	if messages := tb.messenger.Messages(); len(messages) != 0 {
+		t.Errorf("forged decisions sent %+v, want nothing", messages)
+	}
+	if match, _ := tb.store.GetRoommateMatchByID(others.ID); match.StatusA != database.MatchPending || match.StatusB != database.MatchPending {
+		t.Errorf("a forged decision changed someone else's match to %+v", match)
+	}
+
+	// Accepting the user's own match shows the other person a card with the match ID only
+	tb.press("rm:accept:" + own.ID)
+	if match, _ := tb.store.GetRoommateMatchByID(own.ID); match.StatusOf(testChatID) != database.MatchAccepted {
+		t.Fatalf("the user's own decision wasn't saved: %+v", match)
+	}
+	var card OutgoingMessage
+	for _, message := range tb.messenger.Messages() {
+		if message.ChatID == 200 {
+			card = message
+		}
+	}
+	if len(card.Buttons) == 0 || card.Buttons[0][0].Data != "rm:accept:"+own.ID {
+		t.Errorf("the other person was sent %+v, want Accept/Decline buttons for the match", card)
+	}
+}
+
+func TestRoommateDecisionNeedsAnActiveProfile(t *testing.T) {
+	tb := newTestBot(t)
+	for _, profile := range []database.RoommateProfile{{ChatID: testChatID}, {ChatID: 200, Active: true}} {
+		if err := tb.store.SaveRoommateProfile(&profile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	match, _ := tb.store.ProposeRoommateMatch(testChatID, 200)
+
+	tb.press("rm:accept:" + match.ID)
+	if !tb.sent(tb.catalogue.Text(roommateNotActiveMessage)) {
+		t.Errorf("messages = %+v, want the not-active notice", tb.messenger.Messages())
+	}
+	if saved, _ := tb.store.GetRoommateMatchByID(match.ID); saved.StatusOf(testChatID) != database.MatchPending {
+		t.Errorf("an inactive profile's decision was saved: %+v", saved)
+	}
+}
+
+func TestQuietFilterKeepsListingsWithoutNoiseData(t *testing.T) {
+	tb := newTestBot(t)
+	properties := []real_estate_api.Property{
+		{ID: "manchester", Latitude: 53.4794, Longitude: -2.2353},
+		{ID: "north circular", Latitude: 51.5970, Longitude: 0.0000},
+		{ID: "unlocated"},
+	}
+	var kept []string
+	for _, property := range tb.bot.filterQuiet(properties) {
+		kept = append(kept, property.ID)
+	}
+	if len(kept) != 1 || kept[0] != "manchester" {
+		t.Errorf("filterQuiet() kept %v, want only the listing outside the noise data", kept)
+	}
+}
@@ -1,46 +1,432 @@
 package bot
 
-import tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+import (
+	"fmt"
+	"rent_seekerbot/internal/delivery"
+	"rent_seekerbot/internal/fsm"
+	"rent_seekerbot/internal/geo"
+	"rent_seekerbot/internal/i18n"
+	"rent_seekerbot/internal/roommate"
+	"strconv"
+)
 
 const (
-	// Button text
-	goButtonText = "Let's go!"
+	// Button label keys
+	goButtonText = "button.go"
+
+	flatButtonText  = "button.flat"
+	houseButtonText = "button.house"
+
+	studioButtonText = "button.studio"
+
+	furnishedButtonText   = "button.furnished"
+	unfurnishedButtonText = "button.unfurnished"
+
+	noPetsButtonText   = "button.no_pets"
+	catButtonText      = "button.cat"
+	dogButtonText      = "button.dog"
+	otherPetButtonText = "button.other_pet"
+
+	searchNowButtonText = "button.search_now"
+	backButtonText      = "button.back"
+	cancelButtonText    = "button.cancel"
+
+	quietOnlyButtonText = "button.quiet_only"
+	anyNoiseButtonText  = "button.any_noise"
+
+	noCommuteFilterButtonText = "button.no_commute_filter"
+	yesButtonText             = "button.yes"
+	noButtonText              = "button.no"
+	sometimesButtonText       = "button.sometimes"
+	acceptButtonText          = "button.accept"
+	declineButtonText         = "button.decline"
+	broadcastSendButtonText   = "button.broadcast_send" // plural
+	broadcastCancelButtonText = "button.broadcast_cancel"
+	languageAutoButtonText    = "button.language_auto"
+	querySaveButtonText       = "button.query_save"
+	sortBestButtonText        = "button.sort_best"
+	sortCheapestButtonText    = "button.sort_cheapest"
+	sortNewestButtonText      = "button.sort_newest"
+	sortNearestButtonText     = "button.sort_nearest"
+	sortQuickestButtonText    = "button.sort_quickest"
+	alertsInstantButtonText   = "button.alerts_instant"
+	alertsHourlyButtonText    = "button.alerts_hourly"
+	alertsDailyButtonText     = "button.alerts_daily"
+	alertsOffButtonText       = "button.alerts_off"
+	quietHoursButtonText      = "button.quiet_hours"
+	timezoneButtonText        = "button.timezone"
+	noQuietHoursButtonText    = "button.no_quiet_hours"
+
+	// Answers to the search questions. They are stored in the users table, passed to
+	// providers and sent as callback data after the question's prefix, so they must not change.
+	propertyFlat      = "Flat"
+	propertyHouse     = "House"
+	bedroomsStudio    = "Studio"
+	furnishedAnswer   = "Furnished"
+	unfurnishedAnswer = "Unfurnished"
+	petsNone          = "No pets"
+	petsCat           = "Cat"
+	petsDog           = "Dog"
+	petsOther         = "Other pet"
+	noiseQuietOnly    = "quiet"
+	noiseAny          = "any"
+
+	// Callback data of the "Let's go" button
+	goCallbackData = "go"
+	// Callback data prefixes for the search questions, followed by the answer
+	propertyCallbackPrefix  = "type:"
+	bedroomsCallbackPrefix  = "beds:"
+	furnishedCallbackPrefix = "furnished:"
+	petsCallbackPrefix      = "pets:"
+	noiseCallbackPrefix     = "noise:"
+
+	// Callback data prefix for "Did you mean…?" area suggestions
+	areaCallbackPrefix = "area:"
+	// Callback data prefix for search radius buttons, followed by the radius in miles
+	radiusCallbackPrefix = "radius:"
+	// Callback data prefix for maximum commute time buttons, followed by minutes
+	commuteCallbackPrefix = "commute:"
+
+	// Callback data for roommate buttons is roommateCallbackPrefix + action + ":" + value
+	roommateCallbackPrefix     = "rm:"
+	roommateSmokerAction       = "smoker"
+	roommatePetsAction         = "pets"
+	roommateWorkFromHomeAction = "wfh"
+	roommateCleanlinessAction  = "clean"
+	roommateAcceptAction       = "accept"
+	roommateDeclineAction      = "decline"
 
-	flatButtonText  = "Flat"
-	houseButtonText = "House"
+	// Callback data for group votes is voteCallbackPrefix + voteUp or voteDown + ":" + listing ID
+	voteCallbackPrefix = "vote:"
+	voteUp             = "up"
+	voteDown           = "down"
 
-	studioButtonText   = "Studio"
-	oneBedButtonText   = "1"
-	twoBedButtonText   = "2"
-	threeBedButtonText = "3"
-	fourBedButtonText  = "4"
-	fiveBedButtonText  = "5"
+	// Callback data for admin buttons is adminCallbackPrefix + action
+	adminCallbackPrefix   = "admin:"
+	broadcastSendAction   = "broadcast_send"
+	broadcastCancelAction = "broadcast_cancel"
 
-	furnished   = "Furnished"
-	unfurnished = "Unfurnished"
+	// Callback data for the navigation buttons under every question is
+	// navigationCallbackPrefix + action + ":" + the state of the question
+	navigationCallbackPrefix = "nav:"
+	backAction               = "back"
+	cancelAction             = "cancel"
+
+	// Callback data for the preferences menu is preferencesCallbackPrefix + a preference
+	// key, or preferencesSearchAction
+	preferencesCallbackPrefix = "pref:"
+	preferencesSearchAction   = "search"
+
+	// Callback data for the /language menu is languageCallbackPrefix + a language tag,
+	// or languageAutoAction to follow the Telegram app
+	languageCallbackPrefix = "lang:"
+	languageAutoAction     = "auto"
+
+	// Callback data for the confirmation card of a search typed in plain text is
+	// queryCallbackPrefix + a preference key, querySaveAction or queryCancelAction
+	queryCallbackPrefix = "query:"
+	querySaveAction     = "save"
+	queryCancelAction   = "cancel"
+
+	// Callback data for the /sort menu is sortCallbackPrefix + one of ranking.Orders
+	sortCallbackPrefix = "sort:"
+
+	// Callback data for the /alerts menu is alertsCallbackPrefix + one of delivery.Modes,
+	// alertsQuietHoursAction or alertsTimezoneAction
+	alertsCallbackPrefix   = "alerts:"
+	alertsQuietHoursAction = "quiet"
+	alertsTimezoneAction   = "timezone"
+	// Callback data prefix for daily digest time buttons, followed by the time, e.g. "09:00"
+	digestTimeCallbackPrefix = "digest:"
+	// Callback data prefix for quiet hours buttons, followed by the hours, e.g.
+	// "22:00-07:00", or quietHoursOffAnswer
+	quietHoursCallbackPrefix = "quiet:"
+	quietHoursOffAnswer      = "off"
+	// Callback data prefix for time zone buttons, followed by the zone name
+	timezoneCallbackPrefix = "tz:"
 )
 
+// option is an answer to a question asked with buttons.
+type option struct {
+	value string
+	// label is the message key of the button label. Without one the value is shown.
+	label string
+}
+
+var (
+	propertyOptions     = []option{{propertyFlat, flatButtonText}, {propertyHouse, houseButtonText}}
+	bedroomOptions      = []option{{bedroomsStudio, studioButtonText}, {"1", ""}, {"2", ""}, {"3", ""}, {"4", ""}, {"5", ""}}
+	furnishedOptions    = []option{{furnishedAnswer, furnishedButtonText}, {unfurnishedAnswer, unfurnishedButtonText}}
+	petOptions          = []option{{petsNone, noPetsButtonText}, {petsCat, catButtonText}, {petsDog, dogButtonText}, {petsOther, otherPetButtonText}}
+	noiseOptions        = []option{{noiseQuietOnly, quietOnlyButtonText}, {noiseAny, anyNoiseButtonText}}
+	workFromHomeOptions = []option{
+		{roommate.WorkFromHomeYes, yesButtonText},
+		{roommate.WorkFromHomeSometimes, sometimesButtonText},
+		{roommate.WorkFromHomeNo, noButtonText},
+	}
+)
+
+// optionLabel returns the translated label of value, or value itself if it isn't one of
+// the options, e.g. an answer saved by an older version.
+func optionLabel(c *i18n.Catalogue, options []option, value string) string {
+	for _, o := range options {
+		if o.value == value {
+			if o.label == "" {
+				return o.value
+			}
+			return c.Text(o.label)
+		}
+	}
+	return value
+}
+
+// Create buttons for options, perRow to a row, whose callback data is prefix + the answer
+func optionButtons(c *i18n.Catalogue, prefix string, options []option, perRow int) [][]fsm.Button {
+	var rows [][]fsm.Button
+	var row []fsm.Button
+	for _, o := range options {
+		row = append(row, fsm.Button{Label: optionLabel(c, options, o.value), Data: prefix + o.value})
+		if len(row) == perRow {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Create the "Back" and "Cancel" buttons added to the question of state
+func navigationButtons(c *i18n.Catalogue, state fsm.State) []fsm.Button {
+	return []fsm.Button{
+		{Label: c.Text(backButtonText), Data: navigationCallbackPrefix + backAction + ":" + string(state)},
+		{Label: c.Text(cancelButtonText), Data: navigationCallbackPrefix + cancelAction + ":" + string(state)},
+	}
+}
+
 // Create the "Let's go" button
-var goButton = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
-	tgbotapi.NewInlineKeyboardButtonData(goButtonText, goButtonText)))
+func goButton(c *i18n.Catalogue) [][]fsm.Button {
+	return [][]fsm.Button{{{Label: c.Text(goButtonText), Data: goCallbackData}}}
+}
 
-// Create "Select the property type" button
-var selectProperty = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
-	tgbotapi.NewInlineKeyboardButtonData(flatButtonText, flatButtonText)),
-	tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(houseButtonText, houseButtonText)))
+// Create "Select the property type" buttons
+func selectProperty(c *i18n.Catalogue) [][]fsm.Button {
+	return optionButtons(c, propertyCallbackPrefix, propertyOptions, 1)
+}
 
 // Create "Select the number of bedrooms" buttons
-var selectBedrooms = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
-	tgbotapi.NewInlineKeyboardButtonData(studioButtonText, studioButtonText),
-	tgbotapi.NewInlineKeyboardButtonData(oneBedButtonText, oneBedButtonText),
-	tgbotapi.NewInlineKeyboardButtonData(twoBedButtonText, twoBedButtonText)),
-	tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData(threeBedButtonText, threeBedButtonText),
-		tgbotapi.NewInlineKeyboardButtonData(fourBedButtonText, fourBedButtonText),
-		tgbotapi.NewInlineKeyboardButtonData(fiveBedButtonText, fiveBedButtonText)),
-)
+func selectBedrooms(c *i18n.Catalogue) [][]fsm.Button {
+	return optionButtons(c, bedroomsCallbackPrefix, bedroomOptions, 3)
+}
 
 // Create "Select furnished or unfurnished" buttons
-var isFurnished = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
-	tgbotapi.NewInlineKeyboardButtonData(furnished, furnished),
-	tgbotapi.NewInlineKeyboardButtonData(unfurnished, unfurnished)))
+func isFurnished(c *i18n.Catalogue) [][]fsm.Button {
+	return optionButtons(c, furnishedCallbackPrefix, furnishedOptions, 2)
+}
+
+// Create "Do you have pets?" buttons
+func selectPets(c *i18n.Catalogue) [][]fsm.Button {
+	return optionButtons(c, petsCallbackPrefix, petOptions, 2)
+}
+
+// Create "Only show quiet homes?" buttons
+func selectNoise(c *i18n.Catalogue) [][]fsm.Button {
+	return optionButtons(c, noiseCallbackPrefix, noiseOptions, 2)
+}
+
+// Create "Did you mean…?" buttons, one per suggested area
+func areaSuggestions(c *i18n.Catalogue, places []geo.Place) [][]fsm.Button {
+	var rows [][]fsm.Button
+	for _, place := range places {
+		rows = append(rows, []fsm.Button{{Label: placeLabel(c, place), Data: areaCallbackPrefix + place.Name}})
+	}
+	return rows
+}
+
+// placeLabelPrefix followed by a place kind, such as geo.KindOutcode, is the message key
+// of the label of places of that kind.
+const placeLabelPrefix = "place."
+
+// placeLabel names a place with its kind, e.g. "E1 (postcode area)", in the language of c.
+func placeLabel(c *i18n.Catalogue, place geo.Place) string {
+	key := placeLabelPrefix + place.Kind
+	if !c.Has(key) {
+		return place.Name
+	}
+	return c.Text(key, place.Name)
+}
+
+// Create "Select the search radius" buttons
+func selectRadius(c *i18n.Catalogue) [][]fsm.Button {
+	var row []fsm.Button
+	for _, miles := range []float64{0.5, 1, 3, 5} {
+		row = append(row, fsm.Button{Label: formatDistance(c, miles), Data: radiusCallbackPrefix + formatMiles(miles)})
+	}
+	return [][]fsm.Button{row}
+}
+
+// Create "Select the maximum commute time" buttons
+func selectCommuteTime(c *i18n.Catalogue) [][]fsm.Button {
+	var row []fsm.Button
+	for _, minutes := range []int{20, 30, 45, 60} {
+		row = append(row, fsm.Button{Label: c.Text(minutesMessage, minutes), Data: commuteCallbackPrefix + strconv.Itoa(minutes)})
+	}
+	return [][]fsm.Button{row, {
+		{Label: c.Text(noCommuteFilterButtonText), Data: commuteCallbackPrefix + "0"},
+	}}
+}
+
+// Create "Yes"/"No" buttons for a roommate profile question
+func roommateYesNo(c *i18n.Catalogue, action string) [][]fsm.Button {
+	return [][]fsm.Button{{
+		{Label: c.Text(yesButtonText), Data: roommateCallbackPrefix + action + ":yes"},
+		{Label: c.Text(noButtonText), Data: roommateCallbackPrefix + action + ":no"},
+	}}
+}
+
+// Create "Do you work from home?" buttons
+func roommateWorkFromHome(c *i18n.Catalogue) [][]fsm.Button {
+	return optionButtons(c, roommateCallbackPrefix+roommateWorkFromHomeAction+":", workFromHomeOptions, 3)
+}
+
+// Create "How tidy are you?" buttons, from 1 to 5
+var roommateCleanliness = func() [][]fsm.Button {
+	var row []fsm.Button
+	for i := 1; i <= 5; i++ {
+		row = append(row, fsm.Button{Label: strconv.Itoa(i),
+			Data: roommateCallbackPrefix + roommateCleanlinessAction + ":" + strconv.Itoa(i)})
+	}
+	return [][]fsm.Button{row}
+}()
+
+// Create "Accept"/"Decline" buttons for a proposed roommate. They carry the match ID
+// rather than the other person's chat ID.
+func roommateDecision(c *i18n.Catalogue, matchID string) [][]fsm.Button {
+	return [][]fsm.Button{{
+		{Label: c.Text(acceptButtonText), Data: roommateCallbackPrefix + roommateAcceptAction + ":" + matchID},
+		{Label: c.Text(declineButtonText), Data: roommateCallbackPrefix + roommateDeclineAction + ":" + matchID},
+	}}
+}
+
+// Create 👍/👎 buttons for a shortlisted listing, labelled with the current votes
+func voteButtons(listingID string, up, down int) [][]fsm.Button {
+	return [][]fsm.Button{{
+		{Label: fmt.Sprintf("👍 %d", up), Data: voteCallbackPrefix + voteUp + ":" + listingID},
+		{Label: fmt.Sprintf("👎 %d", down), Data: voteCallbackPrefix + voteDown + ":" + listingID},
+	}}
+}
+
+// Create "Send"/"Cancel" buttons to confirm a broadcast
+func broadcastConfirmation(c *i18n.Catalogue, recipients int) [][]fsm.Button {
+	return [][]fsm.Button{{
+		{Label: c.Plural(broadcastSendButtonText, recipients, recipients), Data: adminCallbackPrefix + broadcastSendAction},
+		{Label: c.Text(broadcastCancelButtonText), Data: adminCallbackPrefix + broadcastCancelAction},
+	}}
+}
+
+// Create an edit button per preference, two to a row, whose callback data is prefix + the
+// preference key
+func preferenceButtons(c *i18n.Catalogue, prefix string) [][]fsm.Button {
+	var rows [][]fsm.Button
+	var row []fsm.Button
+	for _, field := range preferenceFields {
+		row = append(row, fsm.Button{Label: c.Text(field.label), Data: prefix + field.key})
+		if len(row) == 2 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Create the /preferences menu, with an edit button per preference and "Search now"
+func preferencesMenu(c *i18n.Catalogue) [][]fsm.Button {
+	return append(preferenceButtons(c, preferencesCallbackPrefix),
+		[]fsm.Button{{Label: c.Text(searchNowButtonText), Data: preferencesCallbackPrefix + preferencesSearchAction}})
+}
+
+// Create the buttons of the confirmation card of a typed search, with an edit button per
+// preference, "Save and search" and "Cancel"
+func queryCard(c *i18n.Catalogue) [][]fsm.Button {
+	return append(preferenceButtons(c, queryCallbackPrefix), []fsm.Button{
+		{Label: c.Text(querySaveButtonText), Data: queryCallbackPrefix + querySaveAction},
+		{Label: c.Text(cancelButtonText), Data: queryCallbackPrefix + queryCancelAction},
+	})
+}
+
+// Create the /sort menu, one button per order with the current one ticked
+func sortMenu(c *i18n.Catalogue, options []option, current string) [][]fsm.Button {
+	rows := optionButtons(c, sortCallbackPrefix, options, 2)
+	for _, row := range rows {
+		for i := range row {
+			if row[i].Data == sortCallbackPrefix+current {
+				row[i].Label = "✓ " + row[i].Label
+			}
+		}
+	}
+	return rows
+}
+
+// Create the /language menu, one button per language and one to follow the Telegram app
+func languageMenu(c *i18n.Catalogue, catalogues []*i18n.Catalogue) [][]fsm.Button {
+	var rows [][]fsm.Button
+	for _, catalogue := range catalogues {
+		rows = append(rows, []fsm.Button{{Label: catalogue.Name(), Data: languageCallbackPrefix + catalogue.Tag()}})
+	}
+	return append(rows, []fsm.Button{{Label: c.Text(languageAutoButtonText), Data: languageCallbackPrefix + languageAutoAction}})
+}
+
+// Create the /alerts menu, one button per delivery mode with the current one ticked, and
+// buttons for the quiet hours and time zone
+func alertsMenu(c *i18n.Catalogue, current string) [][]fsm.Button {
+	rows := optionButtons(c, alertsCallbackPrefix, deliveryOptions, 2)
+	for _, row := range rows {
+		for i := range row {
+			if row[i].Data == alertsCallbackPrefix+current {
+				row[i].Label = "✓ " + row[i].Label
+			}
+		}
+	}
+	return append(rows, []fsm.Button{
+		{Label: c.Text(quietHoursButtonText), Data: alertsCallbackPrefix + alertsQuietHoursAction},
+		{Label: c.Text(timezoneButtonText), Data: alertsCallbackPrefix + alertsTimezoneAction},
+	})
+}
+
+// Create "When should the daily digest be sent?" buttons
+func selectDigestTime() [][]fsm.Button {
+	var rows [][]fsm.Button
+	var row []fsm.Button
+	for _, at := range []string{"07:00", "08:00", "09:00", "12:00", "18:00", "21:00"} {
+		row = append(row, fsm.Button{Label: at, Data: digestTimeCallbackPrefix + at})
+		if len(row) == 3 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	return rows
+}
+
+// Create "When shouldn't alerts be sent?" buttons
+func selectQuietHours(c *i18n.Catalogue) [][]fsm.Button {
+	var row []fsm.Button
+	for _, hours := range [][2]int{{22 * 60, 7 * 60}, {23 * 60, 8 * 60}} {
+		row = append(row, fsm.Button{Label: formatQuietHours(hours[0], hours[1]),
+			Data: quietHoursCallbackPrefix + delivery.FormatQuietHours(hours[0], hours[1])})
+	}
+	return [][]fsm.Button{row, {
+		{Label: c.Text(noQuietHoursButtonText), Data: quietHoursCallbackPrefix + quietHoursOffAnswer},
+	}}
+}
+
+// Create "Which time zone are you in?" buttons
+func selectTimezone() [][]fsm.Button {
+	return [][]fsm.Button{
+		{{Label: "Europe/London", Data: timezoneCallbackPrefix + "Europe/London"}, {Label: "Europe/Warsaw", Data: timezoneCallbackPrefix + "Europe/Warsaw"}},
+		{{Label: "Europe/Berlin", Data: timezoneCallbackPrefix + "Europe/Berlin"}, {Label: "UTC", Data: timezoneCallbackPrefix + "UTC"}},
+	}
+}
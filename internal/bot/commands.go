@@ -0,0 +1,267 @@
+package bot
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log/slog"
+	"rent_seekerbot/internal/geo"
+	"rent_seekerbot/internal/i18n"
+	"strings"
+)
+
+// command is a bot command. The registry of commands drives dispatch, /help and the
+// command menu registered with Telegram.
+type command struct {
+	// name is the command without its slash, e.g. "start".
+	name string
+	// usage describes the arguments, if any, e.g. "<user ID> [reason]". The description
+	// is the message commandDescriptionPrefix + name.
+	usage string
+	// adminOnly commands are hidden from, and refused to, everyone but the admins.
+	adminOnly bool
+	// privateOnly commands are refused in group chats.
+	privateOnly bool
+	// handle runs the command. userID is the member who sent it, which differs from
+	// chatID in group chats, and args holds any text after the command.
+	handle func(ctx context.Context, chatID, userID int64, args string) error
+}
+
+// commandDescriptionPrefix followed by a command's name is the message key of its description.
+const commandDescriptionPrefix = "commands."
+
+// maxSuggestionDistance is how many edits apart an unknown command may be from a known
+// one for it to be suggested.
+const maxSuggestionDistance = 2
+
+// newCommands returns the bot's commands in the order they're listed in /help and the menu.
+func (b *Bot) newCommands() []command {
+	return []command{
+		{name: "start",
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.start(ctx, chatID)
+			}},
+		{name: "preferences",
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.showUserPreferences(ctx, chatID)
+			}},
+		{name: "search", usage: "<text>",
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.startTypedSearch(ctx, chatID, args)
+			}},
+		{name: "sort",
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.showSortMenu(ctx, chatID)
+			}},
+		{name: "alerts", privateOnly: true,
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.showAlertSettings(ctx, chatID)
+			}},
+		{name: "commute",
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.startCommuteSetup(ctx, chatID, userID)
+			}},
+		{name: "back",
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.handleNavigationCommand(ctx, chatID, "/back")
+			}},
+		{name: "cancel",
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.handleNavigationCommand(ctx, chatID, "/cancel")
+			}},
+		{name: "tally",
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.showTally(ctx, chatID)
+			}},
+		{name: "roommate", privateOnly: true,
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.startRoommateSetup(ctx, chatID)
+			}},
+		{name: "matches", privateOnly: true,
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.showNextRoommateMatch(ctx, chatID)
+			}},
+		{name: "roommate_stop", privateOnly: true,
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.stopRoommateMatching(ctx, chatID)
+			}},
+		{name: "language",
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.showLanguageMenu(ctx, chatID)
+			}},
+		{name: "help",
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.showHelp(ctx, chatID, userID)
+			}},
+
+		{name: "stats", adminOnly: true, privateOnly: true,
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.showStats(ctx, chatID)
+			}},
+		{name: "broadcast", usage: "<text>", adminOnly: true,
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.startBroadcast(ctx, chatID, userID, args)
+			}},
+		{name: "user", usage: "<chat ID>", adminOnly: true, privateOnly: true,
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.showUser(ctx, chatID, args)
+			}},
+		{name: "provider", usage: "status", adminOnly: true, privateOnly: true,
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				if strings.TrimSpace(args) != "status" {
+					b.send(ctx, chatID, providerUsageMessage)
+					return nil
+				}
+				b.showProviderStatus(ctx, chatID)
+				return nil
+			}},
+		{name: "block", usage: "<user ID> [reason]", adminOnly: true,
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.blockUser(ctx, chatID, args)
+			}},
+		{name: "unblock", usage: "<user ID>", adminOnly: true,
+			handle: func(ctx context.Context, chatID, userID int64, args string) error {
+				return b.unblockUser(ctx, chatID, args)
+			}},
+	}
+}
+
+// findCommand looks up a command by name, without its slash.
+func (b *Bot) findCommand(name string) (command, bool) {
+	for _, cmd := range b.commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// handleCommand processes bot commands. userID is the member who sent the command,
+// which differs from chatId in group chats. args holds any text after the command.
+func (b *Bot) handleCommand(ctx context.Context, chatId int64, userID int64, name, args string) error {
+	name = strings.TrimPrefix(name, "/")
+	cmd, ok := b.findCommand(name)
+	if !ok || cmd.adminOnly && !b.isAdmin(userID) {
+		// Admin commands are treated as unknown so other users don't learn about them
+		b.sendMessage(ctx, chatId, b.unknownCommandReply(b.catalogue(ctx), name, userID))
+		return nil
+	}
+	if cmd.privateOnly && isGroupChat(chatId) {
+		b.send(ctx, chatId, privateOnlyCommandMessage)
+		return nil
+	}
+	if cmd.adminOnly {
+		b.audit(ctx, userID, "/"+cmd.name, args)
+	}
+	return cmd.handle(ctx, chatId, userID, args)
+}
+
+// unknownCommandReply suggests the command closest to name that userID may use, if any
+// is close enough, in the language of c.
+func (b *Bot) unknownCommandReply(c *i18n.Catalogue, name string, userID int64) string {
+	name = strings.ToLower(name)
+	best, bestDistance := "", maxSuggestionDistance+1
+	for _, cmd := range b.commands {
+		if cmd.adminOnly && !b.isAdmin(userID) {
+			continue
+		}
+		distance := geo.Levenshtein(name, cmd.name)
+		if len(name) >= 3 && strings.HasPrefix(cmd.name, name) {
+			// Abbreviations such as /pref beat typos
+			distance = 0
+		}
+		if distance < bestDistance {
+			best, bestDistance = cmd.name, distance
+		}
+	}
+	if best == "" {
+		return c.Text(unknownCommandMessage)
+	}
+	return c.Text(unknownCommandSuggestionMessage, best)
+}
+
+// showHelp handles /help by listing the commands userID can use in this chat, with a
+// reminder of /back and /cancel while a question is waiting for an answer.
+func (b *Bot) showHelp(ctx context.Context, chatID, userID int64) error {
+	c := b.catalogue(ctx)
+	var text strings.Builder
+	text.WriteString(c.Text(helpHeaderMessage))
+	group := isGroupChat(chatID)
+	for _, cmd := range b.commands {
+		if cmd.adminOnly || cmd.privateOnly && group {
+			continue
+		}
+		text.WriteString("\n" + helpLine(c, cmd))
+	}
+	if b.isAdmin(userID) {
+		text.WriteString("\n\n" + c.Text(helpAdminHeaderMessage))
+		for _, cmd := range b.commands {
+			if cmd.adminOnly {
+				text.WriteString("\n" + helpLine(c, cmd))
+			}
+		}
+	}
+	if group {
+		text.WriteString("\n\n" + c.Text(helpGroupNotice))
+	}
+
+	userData, err := b.getUserData(chatID)
+	if err != nil {
+		// The list is still useful without the reminder
+		slog.ErrorContext(ctx, "Error getting user data", "error", err)
+	} else if userData != nil && userData.State != "" {
+		text.WriteString("\n\n" + c.Text(helpInFlowNotice))
+	}
+	b.sendMessage(ctx, chatID, text.String())
+	return nil
+}
+
+// helpLine describes a command on one line of /help, in the language of c.
+func helpLine(c *i18n.Catalogue, cmd command) string {
+	line := "/" + cmd.name
+	if cmd.usage != "" {
+		line += " " + cmd.usage
+	}
+	return line + " — " + c.Text(commandDescriptionPrefix+cmd.name)
+}
+
+// registerCommands sets the command menus Telegram shows: every public command in private
+// chats, those that work in groups in group chats, and the admin commands too in the
+// admins' private chats. The default language's menus are shown to every user, and each
+// other language's to users whose app is set to it. Failures are logged; the commands
+// still work when typed.
+func (b *Bot) registerCommands(api *tgbotapi.BotAPI) {
+	var menus []tgbotapi.SetMyCommandsConfig
+	for _, c := range b.locales.Catalogues() {
+		var private, group, admin []tgbotapi.BotCommand
+		for _, cmd := range b.commands {
+			botCommand := tgbotapi.BotCommand{Command: cmd.name, Description: c.Text(commandDescriptionPrefix + cmd.name)}
+			admin = append(admin, botCommand)
+			if cmd.adminOnly {
+				continue
+			}
+			private = append(private, botCommand)
+			if !cmd.privateOnly {
+				group = append(group, botCommand)
+			}
+		}
+
+		language := c.Tag()
+		if language == i18n.DefaultTag {
+			language = ""
+		}
+		menus = append(menus,
+			tgbotapi.NewSetMyCommandsWithScopeAndLanguage(tgbotapi.NewBotCommandScopeDefault(), language, private...),
+			tgbotapi.NewSetMyCommandsWithScopeAndLanguage(tgbotapi.NewBotCommandScopeAllGroupChats(), language, group...),
+		)
+		for adminID := range b.admins {
+			menus = append(menus, tgbotapi.NewSetMyCommandsWithScopeAndLanguage(tgbotapi.NewBotCommandScopeChat(adminID), language, admin...))
+		}
+	}
+	for _, menu := range menus {
+		if _, err := api.Request(menu); err != nil {
+			// An admin who hasn't messaged the bot yet has no chat to set the menu in
+			slog.Warn("Failed to register command menu", "scope", menu.Scope.Type, "language", menu.LanguageCode,
+				"chat_id", menu.Scope.ChatID, "error", err)
+		}
+	}
+}
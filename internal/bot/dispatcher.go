@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log/slog"
+	"rent_seekerbot/internal/logging"
+	"rent_seekerbot/internal/metrics"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	// workerCount is the number of updates handled at the same time.
+	workerCount = 16
+	// workerQueueSize is the number of updates waiting for each worker before receiving blocks.
+	workerQueueSize = 64
+)
+
+// dispatcher handles updates on a fixed pool of workers. Updates are sharded by chat ID,
+// so each chat's updates are handled in order while different chats run in parallel.
+type dispatcher struct {
+	queues []chan tgbotapi.Update
+	handle func(context.Context, tgbotapi.Update)
+	wg     sync.WaitGroup
+}
+
+func newDispatcher(workers, queueSize int, handle func(context.Context, tgbotapi.Update)) *dispatcher {
+	d := &dispatcher{queues: make([]chan tgbotapi.Update, workers), handle: handle}
+	for i := range d.queues {
+		d.queues[i] = make(chan tgbotapi.Update, queueSize)
+		d.wg.Add(1)
+		go d.work(d.queues[i])
+	}
+	return d
+}
+
+// dispatch queues an update on its chat's worker. It blocks while that worker's queue is full.
+func (d *dispatcher) dispatch(update tgbotapi.Update) {
+	shard := uint64(updateChatID(update)) % uint64(len(d.queues))
+	d.queues[shard] <- update
+}
+
+// close stops accepting updates and waits for the queued ones to be handled.
+func (d *dispatcher) close() {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.wg.Wait()
+}
+
+func (d *dispatcher) work(queue <-chan tgbotapi.Update) {
+	defer d.wg.Done()
+	for update := range queue {
+		d.run(update)
+	}
+}
+
+// run handles one update under a new correlation ID. A panic is logged and the worker
+// carries on with the next update.
+func (d *dispatcher) run(update tgbotapi.Update) {
+	// Handlers aren't cancelled at shutdown: updates already received are still handled
+	ctx := logging.WithCorrelationID(context.Background(), logging.NewCorrelationID())
+	slog.InfoContext(ctx, "Handling update", "update_id", update.UpdateID, "chat_id", updateChatID(update))
+	kind := updateType(update)
+	start := time.Now()
+	defer func() {
+		metrics.UpdatesProcessed.WithLabelValues(kind).Inc()
+		metrics.HandlerDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+		if r := recover(); r != nil {
+			slog.ErrorContext(ctx, "Panic handling update", "update_id", update.UpdateID, "panic", r, "stack", string(debug.Stack()))
+		}
+	}()
+	d.handle(ctx, update)
+}
+
+// updateType names the kind of update for metrics.
+func updateType(update tgbotapi.Update) string {
+	switch {
+	case update.Message != nil:
+		return "message"
+	case update.CallbackQuery != nil:
+		return "callback_query"
+	}
+	return "other"
+}
+
+// updateChatID returns the chat an update belongs to, or 0 for updates outside a chat.
+func updateChatID(update tgbotapi.Update) int64 {
+	// FromChat assumes callback queries have a message, which isn't true for inline messages
+	if query := update.CallbackQuery; query != nil {
+		if query.Message != nil && query.Message.Chat != nil {
+			return query.Message.Chat.ID
+		}
+		if query.From != nil {
+			return query.From.ID
+		}
+		return 0
+	}
+	if chat := update.FromChat(); chat != nil {
+		return chat.ID
+	}
+	if user := update.SentFrom(); user != nil {
+		return user.ID
+	}
+	return 0
+}
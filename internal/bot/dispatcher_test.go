@@ -0,0 +1,124 @@
+package bot
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// chatUpdate returns the seq'th update of a chat, as a message or a button press.
+func chatUpdate(chatID int64, seq int) tgbotapi.Update {
+	chat := &tgbotapi.Chat{ID: chatID}
+	if seq%2 == 1 {
+		return tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:      "callback",
+			From:    &tgbotapi.User{ID: chatID},
+			Message: &tgbotapi.Message{MessageID: seq, Chat: chat},
+		}}
+	}
+	return tgbotapi.Update{Message: &tgbotapi.Message{MessageID: seq, Chat: chat, From: &tgbotapi.User{ID: chatID}}}
+}
+
+// updateSeq returns the sequence number chatUpdate gave an update.
+func updateSeq(update tgbotapi.Update) int {
+	if update.CallbackQuery != nil {
+		return update.CallbackQuery.Message.MessageID
+	}
+	return update.Message.MessageID
+}
+
+func TestDispatcherHandlesEachChatInOrderAndOneAtATime(t *testing.T) {
+	const (
+		chats          = 50
+		updatesPerChat = 40
+		workers        = 8
+	)
+
+	var (
+		mu       sync.Mutex
+		handled  = make(map[int64][]int)
+		inFlight [chats + 1]atomic.Int32
+		maxBusy  atomic.Int32
+		busy     atomic.Int32
+	)
+	handle := func(ctx context.Context, update tgbotapi.Update) {
+		chatID := updateChatID(update)
+		if n := inFlight[chatID].Add(1); n != 1 {
+			t.Errorf("chat %d has %d updates handled at once", chatID, n)
+		}
+		n := busy.Add(1)
+		for {
+			max := maxBusy.Load()
+			if n <= max || maxBusy.CompareAndSwap(max, n) {
+				break
+			}
+		}
+		time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+		mu.Lock()
+		handled[chatID] = append(handled[chatID], updateSeq(update))
+		mu.Unlock()
+		busy.Add(-1)
+		inFlight[chatID].Add(-1)
+	}
+
+	// Interleave the chats' updates as they would arrive from Telegram
+	var updates []tgbotapi.Update
+	next := make([]int, chats+1)
+	for len(updates) < chats*updatesPerChat {
+		chatID := int64(1 + rand.Intn(chats))
+		if next[chatID] == updatesPerChat {
+			continue
+		}
+		updates = append(updates, chatUpdate(chatID, next[chatID]))
+		next[chatID]++
+	}
+
+	d := newDispatcher(workers, 4, handle)
+	channel := make(chan tgbotapi.Update)
+	go func() {
+		for _, update := range updates {
+			channel <- update
+		}
+		close(channel)
+	}()
+	receiveUpdates(channel, d)
+	d.close()
+
+	for chatID := int64(1); chatID <= chats; chatID++ {
+		seqs := handled[chatID]
+		if len(seqs) != updatesPerChat {
+			t.Errorf("chat %d: %d updates handled, want %d", chatID, len(seqs), updatesPerChat)
+			continue
+		}
+		for i, seq := range seqs {
+			if seq != i {
+				t.Errorf("chat %d: update %d handled in position %d", chatID, seq, i)
+				break
+			}
+		}
+	}
+	if maxBusy.Load() < 2 {
+		t.Errorf("at most %d updates were handled at once, want chats handled in parallel", maxBusy.Load())
+	}
+}
+
+func TestDispatcherRecoversFromPanics(t *testing.T) {
+	var handled atomic.Int32
+	d := newDispatcher(1, 1, func(ctx context.Context, update tgbotapi.Update) {
+		if updateSeq(update) == 0 {
+			panic("handler bug")
+		}
+		handled.Add(1)
+	})
+	d.dispatch(chatUpdate(1, 0))
+	d.dispatch(chatUpdate(1, 1))
+	d.close()
+	if handled.Load() != 1 {
+		t.Errorf("handled %d updates after a panic, want 1", handled.Load())
+	}
+}
@@ -0,0 +1,401 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"rent_seekerbot/internal/database"
+	"rent_seekerbot/internal/fsm"
+	"rent_seekerbot/internal/real_estate_api"
+	"slices"
+	"sync"
+	"time"
+)
+
+// EditedButtons is a button edit recorded by RecordingMessenger.
+type EditedButtons struct {
+	ChatID    int64
+	MessageID int
+	Buttons   [][]fsm.Button
+}
+
+// CallbackAnswer is a button acknowledgement recorded by RecordingMessenger.
+type CallbackAnswer struct {
+	CallbackID string
+	Text       string
+}
+
+// RecordingMessenger is a Messenger that records outgoing messages instead of sending
+// them, so conversations can be driven without Telegram.
+type RecordingMessenger struct {
+	mu        sync.Mutex
+	messages  []OutgoingMessage
+	edits     []EditedButtons
+	callbacks []CallbackAnswer
+}
+
+func NewRecordingMessenger() *RecordingMessenger {
+	return &RecordingMessenger{}
+}
+
+func (m *RecordingMessenger) Send(msg OutgoingMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func (m *RecordingMessenger) EditButtons(chatID int64, messageID int, buttons [][]fsm.Button) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.edits = append(m.edits, EditedButtons{ChatID: chatID, MessageID: messageID, Buttons: buttons})
+	return nil
+}
+
+func (m *RecordingMessenger) AnswerCallback(callbackID, text string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.callbacks = append(m.callbacks, CallbackAnswer{CallbackID: callbackID, Text: text})
+	return nil
+}
+
+// Messages returns the messages sent so far.
+func (m *RecordingMessenger) Messages() []OutgoingMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]OutgoingMessage(nil), m.messages...)
+}
+
+// Edits returns the button edits made so far.
+func (m *RecordingMessenger) Edits() []EditedButtons {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]EditedButtons(nil), m.edits...)
+}
+
+// Callbacks returns the button presses answered so far.
+func (m *RecordingMessenger) Callbacks() []CallbackAnswer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]CallbackAnswer(nil), m.callbacks...)
+}
+
+// Last returns the most recent message, and false if nothing was sent.
+func (m *RecordingMessenger) Last() (OutgoingMessage, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.messages) == 0 {
+		return OutgoingMessage{}, false
+	}
+	return m.messages[len(m.messages)-1], true
+}
+
+// Reset forgets everything recorded so far.
+func (m *RecordingMessenger) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages, m.edits, m.callbacks = nil, nil, nil
+}
+
+// fakeStore is an in-memory Store. Methods the tests don't need are left to the embedded
+// nil Store, so calling one panics and shows the fake needs extending.
+type fakeStore struct {
+	Store
+
+	mu      sync.Mutex
+	users   map[int64]database.UserData
+	blocked map[int64]bool
+	outbox  []fakeNotification
+	nextID  int64
+	// profiles and matches hold roommate profiles and proposed pairs by chat ID and match ID.
+	profiles map[int64]database.RoommateProfile
+	matches  map[string]database.RoommateMatch
+}
+
+// fakeNotification is a row of the fake outbox.
+type fakeNotification struct {
+	database.Notification
+	ChatID  int64
+	Alert   bool
+	Dropped bool
+	SentAt  time.Time
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		users:    make(map[int64]database.UserData),
+		blocked:  make(map[int64]bool),
+		profiles: make(map[int64]database.RoommateProfile),
+		matches:  make(map[string]database.RoommateMatch),
+	}
+}
+
+func (s *fakeStore) GetUser(chatID int64) (*database.UserData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	userData, ok := s.users[chatID]
+	if !ok {
+		return nil, nil
+	}
+	// Hand out copies, as the database does, so changes only stick once saved
+	userData.Keywords = append([]string(nil), userData.Keywords...)
+	userData.History = append([]string(nil), userData.History...)
+	return &userData, nil
+}
+
+func (s *fakeStore) SaveUser(chatID int64, userData *database.UserData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := *userData
+	saved.Keywords = append([]string(nil), userData.Keywords...)
+	saved.History = append([]string(nil), userData.History...)
+	s.users[chatID] = saved
+	return nil
+}
+
+func (s *fakeStore) BlockUser(userID int64, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocked[userID] = true
+	return nil
+}
+
+func (s *fakeStore) UnblockUser(userID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wasBlocked := s.blocked[userID]
+	delete(s.blocked, userID)
+	return wasBlocked, nil
+}
+
+func (s *fakeStore) IsBlocked(userID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.blocked[userID], nil
+}
+
+func (s *fakeStore) PrivateChatIDs() ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []int64
+	for id := range s.users {
+		if id > 0 && !s.blocked[id] {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (s *fakeStore) LogAdminAction(adminID int64, action, details string) error {
+	return nil
+}
+
+func (s *fakeStore) QueueNotifications(chatID int64, notifications []database.Notification) (int, error) {
+	return s.addNotifications(chatID, notifications, true, time.Time{}), nil
+}
+
+func (s *fakeStore) RecordShown(chatID int64, notifications []database.Notification, at time.Time) error {
+	s.addNotifications(chatID, notifications, false, at)
+	return nil
+}
+
+func (s *fakeStore) addNotifications(chatID int64, notifications []database.Notification, alert bool, sentAt time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added := 0
+	for _, n := range notifications {
+		if slices.ContainsFunc(s.outbox, func(row fakeNotification) bool {
+			return row.ChatID == chatID && row.ListingID == n.ListingID
+		}) {
+			continue
+		}
+		s.nextID++
+		n.ID = s.nextID
+		n.QueuedAt = time.Now()
+		s.outbox = append(s.outbox, fakeNotification{Notification: n, ChatID: chatID, Alert: alert, SentAt: sentAt})
+		added++
+	}
+	return added
+}
+
+func (s *fakeStore) PendingNotifications(chatID int64) ([]database.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pending []database.Notification
+	for _, row := range s.outbox {
+		if row.ChatID == chatID && row.SentAt.IsZero() {
+			pending = append(pending, row.Notification)
+		}
+	}
+	return pending, nil
+}
+
+func (s *fakeStore) ChatsWithPendingNotifications() ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []int64
+	for _, row := range s.outbox {
+		if row.SentAt.IsZero() && !slices.Contains(ids, row.ChatID) {
+			ids = append(ids, row.ChatID)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (s *fakeStore) LastAlertSent(chatID int64) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var last time.Time
+	for _, row := range s.outbox {
+		if row.ChatID == chatID && row.Alert && !row.Dropped && row.SentAt.After(last) {
+			last = row.SentAt
+		}
+	}
+	return last, nil
+}
+
+func (s *fakeStore) MarkSent(ids []int64, at time.Time) error {
+	s.takeNotifications(ids, at, false)
+	return nil
+}
+
+func (s *fakeStore) DropNotifications(ids []int64, at time.Time) error {
+	s.takeNotifications(ids, at, true)
+	return nil
+}
+
+func (s *fakeStore) takeNotifications(ids []int64, at time.Time, dropped bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.outbox {
+		if slices.Contains(ids, s.outbox[i].ID) {
+			s.outbox[i].SentAt = at
+			s.outbox[i].Dropped = dropped
+		}
+	}
+}
+
+func (s *fakeStore) PruneNotifications(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.outbox[:0]
+	for _, row := range s.outbox {
+		if row.SentAt.IsZero() || !row.SentAt.Before(before) {
+			kept = append(kept, row)
+		}
+	}
+	pruned := int64(len(s.outbox) - len(kept))
+	s.outbox = kept
+	return pruned, nil
+}
+
+func (s *fakeStore) GetRoommateProfile(chatID int64) (*database.RoommateProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	profile, ok := s.profiles[chatID]
+	if !ok {
+		return nil, nil
+	}
+	return &profile, nil
+}
+
+func (s *fakeStore) SaveRoommateProfile(profile *database.RoommateProfile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profiles[profile.ChatID] = *profile
+	return nil
+}
+
+func (s *fakeStore) GetRoommateMatchByID(id string) (*database.RoommateMatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	match, ok := s.matches[id]
+	if !ok {
+		return nil, nil
+	}
+	return &match, nil
+}
+
+func (s *fakeStore) ProposeRoommateMatch(chatID, otherID int64) (*database.RoommateMatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, b := min(chatID, otherID), max(chatID, otherID)
+	for _, match := range s.matches {
+		if match.UserA == a && match.UserB == b {
+			return &match, nil
+		}
+	}
+	s.nextID++
+	match := database.RoommateMatch{ID: fmt.Sprintf("match%d", s.nextID), UserA: a, UserB: b,
+		StatusA: database.MatchPending, StatusB: database.MatchPending}
+	s.matches[match.ID] = match
+	return &match, nil
+}
+
+func (s *fakeStore) SaveRoommateDecision(matchID string, chatID int64, status string) (*database.RoommateMatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	match, ok := s.matches[matchID]
+	if !ok || !match.Includes(chatID) {
+		return nil, nil
+	}
+	if chatID == match.UserA {
+		match.StatusA = status
+	} else {
+		match.StatusB = status
+	}
+	s.matches[matchID] = match
+	return &match, nil
+}
+
+func (s *fakeStore) PingContext(ctx context.Context) error {
+	return nil
+}
+
+// user returns what the store holds for a chat.
+func (s *fakeStore) user(chatID int64) database.UserData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.users[chatID]
+}
+
+// searchCall is a search made of fakeProvider.
+type searchCall struct {
+	Area               string
+	MinPrice, MaxPrice int
+	Bedrooms           int
+	PropertyType       string
+}
+
+// fakeProvider is a listings provider that returns fixed listings, or err if set, and
+// records the searches made of it.
+type fakeProvider struct {
+	mu       sync.Mutex
+	listings []real_estate_api.Property
+	err      error
+	calls    []searchCall
+}
+
+func (p *fakeProvider) SearchProperties(ctx context.Context, area string, minPrice, maxPrice, bedrooms int, propertyType string) ([]real_estate_api.Property, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, searchCall{Area: area, MinPrice: minPrice, MaxPrice: maxPrice, Bedrooms: bedrooms, PropertyType: propertyType})
+	if p.err != nil {
+		return nil, p.err
+	}
+	return append([]real_estate_api.Property(nil), p.listings...), nil
+}
+
+func (p *fakeProvider) TestApiConnection(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// searches returns the searches made so far.
+func (p *fakeProvider) searches() []searchCall {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]searchCall(nil), p.calls...)
+}
@@ -0,0 +1,301 @@
+package bot
+
+import (
+	"fmt"
+	"rent_seekerbot/internal/database"
+	"rent_seekerbot/internal/fsm"
+	"rent_seekerbot/internal/geo"
+	"rent_seekerbot/internal/i18n"
+	"rent_seekerbot/internal/query"
+	"strconv"
+	"strings"
+)
+
+// Search flow states. The values are stored in the users table, so they must not change.
+const (
+	stateSelectingProperty    fsm.State = "selecting_property"
+	stateAwaitingPriceRange   fsm.State = "awaiting_price_range"
+	stateAwaitingBedrooms     fsm.State = "awaiting_bedrooms"
+	stateFurnishedUnfurnished fsm.State = "furnished_unfurnished"
+	stateSelectingPets        fsm.State = "selecting_pets"
+	stateSelectingNoise       fsm.State = "selecting_noise"
+	stateSelectingArea        fsm.State = "selecting_area"
+	stateSelectingRadius      fsm.State = "selecting_radius"
+	// stateSearching is entered once every question is answered. The bot runs the search
+	// and returns to fsm.Idle.
+	stateSearching fsm.State = "searching"
+
+	stateAwaitingCommuteDestination fsm.State = "awaiting_commute_destination"
+	stateSelectingCommuteTime       fsm.State = "selecting_commute_time"
+
+	stateSelectingDigestTime fsm.State = "selecting_digest_time"
+	stateSelectingQuietHours fsm.State = "selecting_quiet_hours"
+	stateAwaitingTimezone    fsm.State = "awaiting_timezone"
+)
+
+// newSearchFlow builds the onboarding conversation that collects search preferences,
+// followed by the /commute and /alerts questions, asked in the language of c.
+func (b *Bot) newSearchFlow(c *i18n.Catalogue) *fsm.Machine[*database.UserData] {
+	return fsm.MustNew(map[fsm.State]fsm.Step[*database.UserData]{
+		fsm.Idle: {
+			OnButton: onGo,
+			Next:     []fsm.State{stateSelectingProperty},
+		},
+		stateSelectingProperty: {
+			Prompt:   buttonPrompt[*database.UserData](c.Text(selectPropertyMessage), selectProperty(c)),
+			OnButton: onChoice(propertyCallbackPrefix, propertyOptions, func(u *database.UserData, answer string) { u.PropertyType = answer }, stateAwaitingPriceRange),
+			Next:     []fsm.State{stateAwaitingPriceRange},
+		},
+		stateAwaitingPriceRange: {
+			Prompt: textPrompt[*database.UserData](c.Text(priceRangeMessage)),
+			OnText: onPriceRange(c),
+			Next:   []fsm.State{stateAwaitingBedrooms},
+		},
+		stateAwaitingBedrooms: {
+			Prompt:   buttonPrompt[*database.UserData](c.Text(selectBedroomsMessage), selectBedrooms(c)),
+			OnButton: onChoice(bedroomsCallbackPrefix, bedroomOptions, func(u *database.UserData, answer string) { u.Bedrooms, u.MaxBedrooms = answer, 0 }, stateFurnishedUnfurnished),
+			OnText:   onBedroomsText(c),
+			Next:     []fsm.State{stateFurnishedUnfurnished},
+		},
+		stateFurnishedUnfurnished: {
+			Prompt:   buttonPrompt[*database.UserData](c.Text(selectIsFurnished), isFurnished(c)),
+			OnButton: onChoice(furnishedCallbackPrefix, furnishedOptions, func(u *database.UserData, answer string) { u.Furnished = answer }, stateSelectingPets),
+			Next:     []fsm.State{stateSelectingPets},
+		},
+		stateSelectingPets: {
+			Prompt:   buttonPrompt[*database.UserData](c.Text(selectPetsMessage), selectPets(c)),
+			OnButton: onChoice(petsCallbackPrefix, petOptions, func(u *database.UserData, answer string) { u.Pets = answer }, stateSelectingNoise),
+			Next:     []fsm.State{stateSelectingNoise},
+		},
+		stateSelectingNoise: {
+			Prompt:   buttonPrompt[*database.UserData](c.Text(selectNoiseMessage), selectNoise(c)),
+			OnButton: onChoice(noiseCallbackPrefix, noiseOptions, func(u *database.UserData, answer string) { u.QuietOnly = answer == noiseQuietOnly }, stateSelectingArea),
+			Next:     []fsm.State{stateSelectingArea},
+		},
+		stateSelectingArea: {
+			Prompt:     textPrompt[*database.UserData](c.Text(selectArea)),
+			OnText:     b.onAreaText(c),
+			OnButton:   b.onAreaSuggestion,
+			OnLocation: b.onAreaLocation,
+			Next:       []fsm.State{stateSelectingRadius},
+		},
+		stateSelectingRadius: {
+			Prompt:   buttonPrompt[*database.UserData](c.Text(selectRadiusMessage), selectRadius(c)),
+			OnButton: onRadius,
+			Next:     []fsm.State{stateSearching},
+		},
+		stateSearching: {},
+
+		stateAwaitingCommuteDestination: {
+			Prompt:     textPrompt[*database.UserData](c.Text(commuteDestinationMessage)),
+			OnText:     b.onCommuteText(c),
+			OnButton:   b.onCommuteSuggestion,
+			OnLocation: onCommuteLocation(c),
+			Next:       []fsm.State{stateSelectingCommuteTime},
+		},
+		stateSelectingCommuteTime: {
+			Prompt: func(u *database.UserData) fsm.Prompt {
+				return fsm.Prompt{Text: c.Text(selectCommuteTimeMessage, u.CommuteDestination), Buttons: selectCommuteTime(c)}
+			},
+			OnButton: onCommuteTime(c),
+			Next:     []fsm.State{fsm.Idle},
+		},
+
+		stateSelectingDigestTime: {
+			Prompt:   buttonPrompt[*database.UserData](c.Text(selectDigestTimeMessage), selectDigestTime()),
+			OnButton: onDigestTime(c),
+			OnText:   onDigestTime(c),
+			Next:     []fsm.State{fsm.Idle},
+		},
+		stateSelectingQuietHours: {
+			Prompt:   buttonPrompt[*database.UserData](c.Text(selectQuietHoursMessage), selectQuietHours(c)),
+			OnButton: onQuietHours(c),
+			OnText:   onQuietHours(c),
+			Next:     []fsm.State{fsm.Idle},
+		},
+		stateAwaitingTimezone: {
+			Prompt:   buttonPrompt[*database.UserData](c.Text(selectTimezoneMessage), selectTimezone()),
+			OnButton: onTimezone(c),
+			OnText:   onTimezone(c),
+			Next:     []fsm.State{fsm.Idle},
+		},
+	})
+}
+
+// textPrompt returns a prompt answered by typing.
+func textPrompt[T any](text string) func(T) fsm.Prompt {
+	return func(T) fsm.Prompt {
+		return fsm.Prompt{Text: text}
+	}
+}
+
+// buttonPrompt returns a prompt answered with buttons.
+func buttonPrompt[T any](text string, buttons [][]fsm.Button) func(T) fsm.Prompt {
+	return func(T) fsm.Prompt {
+		return fsm.Prompt{Text: text, Buttons: buttons}
+	}
+}
+
+// onGo starts the search questions when "Let's go" is pressed.
+func onGo(_ *database.UserData, in fsm.Input) (fsm.Outcome, error) {
+	if in.Data != goCallbackData {
+		return fsm.Outcome{}, fsm.ErrUnexpectedInput
+	}
+	return fsm.Go(stateSelectingProperty), nil
+}
+
+// onChoice accepts the button of one of the options, whose callback data is prefix + the
+// answer, stores the answer with set and moves to next. Any other button, such as one
+// from an earlier question, is rejected.
+func onChoice(prefix string, options []option, set func(u *database.UserData, answer string), next fsm.State) fsm.Handler[*database.UserData] {
+	return func(u *database.UserData, in fsm.Input) (fsm.Outcome, error) {
+		for _, o := range options {
+			if in.Data == prefix+o.value {
+				set(u, o.value)
+				return fsm.Go(next), nil
+			}
+		}
+		return fsm.Outcome{}, fsm.ErrUnexpectedInput
+	}
+}
+
+func onPriceRange(c *i18n.Catalogue) fsm.Handler[*database.UserData] {
+	return func(u *database.UserData, in fsm.Input) (fsm.Outcome, error) {
+		minPrice, maxPrice, err := query.ParsePriceRange(in.Text)
+		if err != nil || minPrice < 0 || minPrice > maxPrice {
+			return fsm.Outcome{}, fsm.Reject(c.Text(invalidPriceRangeMessage))
+		}
+		u.PriceRange = fmt.Sprintf("%d - %d", minPrice, maxPrice)
+		return fsm.Go(stateAwaitingBedrooms), nil
+	}
+}
+
+// onBedroomsText accepts a typed answer only if it matches one of the bedroom buttons,
+// either the stored answer or its label in the language of c.
+func onBedroomsText(c *i18n.Catalogue) fsm.Handler[*database.UserData] {
+	return func(u *database.UserData, in fsm.Input) (fsm.Outcome, error) {
+		text := strings.TrimSpace(in.Text)
+		for _, o := range bedroomOptions {
+			if strings.EqualFold(text, o.value) || strings.EqualFold(text, optionLabel(c, bedroomOptions, o.value)) {
+				u.Bedrooms, u.MaxBedrooms = o.value, 0
+				return fsm.Go(stateFurnishedUnfurnished), nil
+			}
+		}
+		return fsm.Outcome{}, fsm.Reject(c.Text(invalidBedroomsMessage), selectBedrooms(c)...)
+	}
+}
+
+// bedroomCount converts the bedrooms answer to the number passed to providers.
+func bedroomCount(answer string) (int, error) {
+	if answer == bedroomsStudio {
+		return 0, nil
+	}
+	return strconv.Atoi(answer)
+}
+
+// areaRejection asks the user to pick one of the suggested areas, or to try again when
+// nothing is close.
+func areaRejection(c *i18n.Catalogue, text string, suggestions []geo.Place) error {
+	if len(suggestions) == 0 {
+		return fsm.Reject(c.Text(areaNotFoundMessage, text))
+	}
+	return fsm.Reject(c.Text(didYouMeanMessage, text), areaSuggestions(c, suggestions)...)
+}
+
+func (b *Bot) onAreaText(c *i18n.Catalogue) fsm.Handler[*database.UserData] {
+	return func(u *database.UserData, in fsm.Input) (fsm.Outcome, error) {
+		resolution := b.gazetteer.Resolve(in.Text)
+		if resolution.Place == nil {
+			return fsm.Outcome{}, areaRejection(c, in.Text, resolution.Suggestions)
+		}
+		place := resolution.Place
+		u.Area, u.Latitude, u.Longitude = place.Name, place.Latitude, place.Longitude
+		if !resolution.Exact {
+			return fsm.GoWithNotice(stateSelectingRadius, c.Text(areaCorrectedMessage, place.Name)), nil
+		}
+		return fsm.Go(stateSelectingRadius), nil
+	}
+}
+
+func (b *Bot) onAreaSuggestion(u *database.UserData, in fsm.Input) (fsm.Outcome, error) {
+	place, ok := b.gazetteer.Lookup(strings.TrimPrefix(in.Data, areaCallbackPrefix))
+	if !strings.HasPrefix(in.Data, areaCallbackPrefix) || !ok {
+		return fsm.Outcome{}, fsm.ErrUnexpectedInput
+	}
+	u.Area, u.Latitude, u.Longitude = place.Name, place.Latitude, place.Longitude
+	return fsm.Go(stateSelectingRadius), nil
+}
+
+func (b *Bot) onAreaLocation(u *database.UserData, in fsm.Input) (fsm.Outcome, error) {
+	// Describe the shared point by its nearest outcode for providers that search by area
+	place := b.gazetteer.Nearest(in.Location.Latitude, in.Location.Longitude)
+	u.Area, u.Latitude, u.Longitude = place.Name, in.Location.Latitude, in.Location.Longitude
+	return fsm.Go(stateSelectingRadius), nil
+}
+
+func onRadius(u *database.UserData, in fsm.Input) (fsm.Outcome, error) {
+	radius, err := strconv.ParseFloat(strings.TrimPrefix(in.Data, radiusCallbackPrefix), 64)
+	if !strings.HasPrefix(in.Data, radiusCallbackPrefix) || err != nil || radius <= 0 {
+		return fsm.Outcome{}, fsm.ErrUnexpectedInput
+	}
+	u.RadiusMiles = radius
+	return fsm.Go(stateSearching), nil
+}
+
+// onCommuteText accepts a station name, falling back to an area or postcode.
+func (b *Bot) onCommuteText(c *i18n.Catalogue) fsm.Handler[*database.UserData] {
+	return func(u *database.UserData, in fsm.Input) (fsm.Outcome, error) {
+		if station, ok := b.network.FindStation(in.Text); ok {
+			u.CommuteDestination, u.CommuteLatitude, u.CommuteLongitude = station.Name, station.Latitude, station.Longitude
+			return fsm.Go(stateSelectingCommuteTime), nil
+		}
+		resolution := b.gazetteer.Resolve(in.Text)
+		if resolution.Place == nil {
+			return fsm.Outcome{}, areaRejection(c, in.Text, resolution.Suggestions)
+		}
+		place := resolution.Place
+		u.CommuteDestination, u.CommuteLatitude, u.CommuteLongitude = place.Name, place.Latitude, place.Longitude
+		if !resolution.Exact {
+			return fsm.GoWithNotice(stateSelectingCommuteTime, c.Text(areaCorrectedMessage, place.Name)), nil
+		}
+		return fsm.Go(stateSelectingCommuteTime), nil
+	}
+}
+
+func (b *Bot) onCommuteSuggestion(u *database.UserData, in fsm.Input) (fsm.Outcome, error) {
+	place, ok := b.gazetteer.Lookup(strings.TrimPrefix(in.Data, areaCallbackPrefix))
+	if !strings.HasPrefix(in.Data, areaCallbackPrefix) || !ok {
+		return fsm.Outcome{}, fsm.ErrUnexpectedInput
+	}
+	u.CommuteDestination, u.CommuteLatitude, u.CommuteLongitude = place.Name, place.Latitude, place.Longitude
+	return fsm.Go(stateSelectingCommuteTime), nil
+}
+
+// onCommuteLocation describes the shared point in the language of c, as the destination
+// is shown in listings.
+func onCommuteLocation(c *i18n.Catalogue) fsm.Handler[*database.UserData] {
+	return func(u *database.UserData, in fsm.Input) (fsm.Outcome, error) {
+		u.CommuteDestination = c.Text(sharedLocationLabel)
+		u.CommuteLatitude, u.CommuteLongitude = in.Location.Latitude, in.Location.Longitude
+		return fsm.Go(stateSelectingCommuteTime), nil
+	}
+}
+
+// onCommuteTime stores the maximum travel time. Zero turns the commute filter off.
+func onCommuteTime(c *i18n.Catalogue) fsm.Handler[*database.UserData] {
+	return func(u *database.UserData, in fsm.Input) (fsm.Outcome, error) {
+		minutes, err := strconv.Atoi(strings.TrimPrefix(in.Data, commuteCallbackPrefix))
+		if !strings.HasPrefix(in.Data, commuteCallbackPrefix) || err != nil || minutes < 0 {
+			return fsm.Outcome{}, fsm.ErrUnexpectedInput
+		}
+		if minutes == 0 {
+			u.CommuteDestination = ""
+			u.CommuteLatitude = 0
+			u.CommuteLongitude = 0
+			u.MaxCommuteMinutes = 0
+			return fsm.GoWithNotice(fsm.Idle, c.Text(commuteClearedMessage)), nil
+		}
+		u.MaxCommuteMinutes = minutes
+		return fsm.GoWithNotice(fsm.Idle, c.Plural(commuteSavedMessage, minutes, minutes, u.CommuteDestination)), nil
+	}
+}
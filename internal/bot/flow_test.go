@@ -0,0 +1,284 @@
+package bot
+
+import (
+	"errors"
+	"rent_seekerbot/internal/commute"
+	"rent_seekerbot/internal/database"
+	"rent_seekerbot/internal/fsm"
+	"rent_seekerbot/internal/geo"
+	"rent_seekerbot/internal/i18n"
+	"testing"
+)
+
+// newFlowBot returns a bot with just the datasets the flows use, and the default catalogue.
+func newFlowBot(t *testing.T) (*Bot, *i18n.Catalogue) {
+	t.Helper()
+	gazetteer, err := geo.NewGazetteer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	network, err := commute.NewNetwork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := i18n.NewBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Bot{gazetteer: gazetteer, network: network}, bundle.Default()
+}
+
+// Kinds of result expected from a transition.
+const (
+	outcomeAccepted   = iota
+	outcomeRejected   // fsm.Rejection, explained to the user
+	outcomeUnexpected // fsm.ErrUnexpectedInput, e.g. a stale button
+)
+
+func typed(s string) fsm.Input   { return fsm.Input{Text: s} }
+func pressed(s string) fsm.Input { return fsm.Input{Data: s} }
+
+func TestSearchFlowTransitions(t *testing.T) {
+	b, c := newFlowBot(t)
+	flow := b.newSearchFlow(c)
+	hackney := &fsm.Location{Latitude: 51.545, Longitude: -0.055}
+
+	tests := []struct {
+		name   string
+		state  fsm.State
+		in     fsm.Input
+		want   int
+		next   fsm.State
+		notice bool
+		check  func(u *database.UserData) bool
+	}{
+		{name: "go button", state: fsm.Idle, in: pressed(goCallbackData), next: stateSelectingProperty},
+		{name: "idle stale button", state: fsm.Idle, in: pressed(propertyCallbackPrefix + propertyFlat), want: outcomeUnexpected},
+		{name: "idle text", state: fsm.Idle, in: typed("hello"), want: outcomeUnexpected},
+
+		{name: "property flat", state: stateSelectingProperty, in: pressed(propertyCallbackPrefix + propertyFlat), next: stateAwaitingPriceRange,
+			check: func(u *database.UserData) bool { return u.PropertyType == propertyFlat }},
+		{name: "property house", state: stateSelectingProperty, in: pressed(propertyCallbackPrefix + propertyHouse), next: stateAwaitingPriceRange,
+			check: func(u *database.UserData) bool { return u.PropertyType == propertyHouse }},
+		{name: "property unknown answer", state: stateSelectingProperty, in: pressed(propertyCallbackPrefix + "Castle"), want: outcomeUnexpected},
+		{name: "property stale button", state: stateSelectingProperty, in: pressed(bedroomsCallbackPrefix + "2"), want: outcomeUnexpected},
+		{name: "property typed", state: stateSelectingProperty, in: typed("Flat"), want: outcomeUnexpected},
+
+		{name: "price range", state: stateAwaitingPriceRange, in: typed("1000-2000"), next: stateAwaitingBedrooms,
+			check: func(u *database.UserData) bool { return u.PriceRange == "1000 - 2000" }},
+		{name: "price range with k", state: stateAwaitingPriceRange, in: typed("£1.5k - 2k"), next: stateAwaitingBedrooms,
+			check: func(u *database.UserData) bool { return u.PriceRange == "1500 - 2000" }},
+		{name: "price range reversed", state: stateAwaitingPriceRange, in: typed("2000-1000"), want: outcomeRejected},
+		{name: "price range not a number", state: stateAwaitingPriceRange, in: typed("cheap"), want: outcomeRejected},
+		{name: "price range button", state: stateAwaitingPriceRange, in: pressed(propertyCallbackPrefix + propertyFlat), want: outcomeUnexpected},
+
+		{name: "bedrooms button", state: stateAwaitingBedrooms, in: pressed(bedroomsCallbackPrefix + "2"), next: stateFurnishedUnfurnished,
+			check: func(u *database.UserData) bool { return u.Bedrooms == "2" }},
+		{name: "bedrooms studio button", state: stateAwaitingBedrooms, in: pressed(bedroomsCallbackPrefix + bedroomsStudio), next: stateFurnishedUnfurnished,
+			check: func(u *database.UserData) bool { return u.Bedrooms == bedroomsStudio }},
+		{name: "bedrooms typed number", state: stateAwaitingBedrooms, in: typed(" 3 "), next: stateFurnishedUnfurnished,
+			check: func(u *database.UserData) bool { return u.Bedrooms == "3" }},
+		{name: "bedrooms typed studio", state: stateAwaitingBedrooms, in: typed("studio"), next: stateFurnishedUnfurnished,
+			check: func(u *database.UserData) bool { return u.Bedrooms == bedroomsStudio }},
+		{name: "bedrooms typed out of range", state: stateAwaitingBedrooms, in: typed("9"), want: outcomeRejected},
+		{name: "bedrooms typed words", state: stateAwaitingBedrooms, in: typed("a few"), want: outcomeRejected},
+		{name: "bedrooms unknown button", state: stateAwaitingBedrooms, in: pressed(bedroomsCallbackPrefix + "9"), want: outcomeUnexpected},
+		{name: "bedrooms stale button", state: stateAwaitingBedrooms, in: pressed(propertyCallbackPrefix + propertyFlat), want: outcomeUnexpected},
+
+		{name: "furnished", state: stateFurnishedUnfurnished, in: pressed(furnishedCallbackPrefix + furnishedAnswer), next: stateSelectingPets,
+			check: func(u *database.UserData) bool { return u.Furnished == furnishedAnswer }},
+		{name: "unfurnished", state: stateFurnishedUnfurnished, in: pressed(furnishedCallbackPrefix + unfurnishedAnswer), next: stateSelectingPets,
+			check: func(u *database.UserData) bool { return u.Furnished == unfurnishedAnswer }},
+		{name: "furnished stale button", state: stateFurnishedUnfurnished, in: pressed(bedroomsCallbackPrefix + "2"), want: outcomeUnexpected},
+		{name: "furnished typed", state: stateFurnishedUnfurnished, in: typed("yes"), want: outcomeUnexpected},
+
+		{name: "pets dog", state: stateSelectingPets, in: pressed(petsCallbackPrefix + petsDog), next: stateSelectingNoise,
+			check: func(u *database.UserData) bool { return u.Pets == petsDog }},
+		{name: "pets stale button", state: stateSelectingPets, in: pressed(furnishedCallbackPrefix + furnishedAnswer), want: outcomeUnexpected},
+
+		{name: "noise quiet only", state: stateSelectingNoise, in: pressed(noiseCallbackPrefix + noiseQuietOnly), next: stateSelectingArea,
+			check: func(u *database.UserData) bool { return u.QuietOnly }},
+		{name: "noise any", state: stateSelectingNoise, in: pressed(noiseCallbackPrefix + noiseAny), next: stateSelectingArea,
+			check: func(u *database.UserData) bool { return !u.QuietOnly }},
+		{name: "noise stale button", state: stateSelectingNoise, in: pressed(petsCallbackPrefix + petsDog), want: outcomeUnexpected},
+
+		{name: "area typed", state: stateSelectingArea, in: typed("Hackney"), next: stateSelectingRadius,
+			check: func(u *database.UserData) bool { return u.Area == "Hackney" && u.Latitude != 0 }},
+		{name: "area postcode", state: stateSelectingArea, in: typed("e1 6an"), next: stateSelectingRadius,
+			check: func(u *database.UserData) bool { return u.Area == "E1" }},
+		{name: "area misspelt", state: stateSelectingArea, in: typed("Hackny"), next: stateSelectingRadius, notice: true,
+			check: func(u *database.UserData) bool { return u.Area == "Hackney" }},
+		{name: "area unknown", state: stateSelectingArea, in: typed("Xyzzyqwv"), want: outcomeRejected},
+		{name: "area suggestion", state: stateSelectingArea, in: pressed(areaCallbackPrefix + "Hackney"), next: stateSelectingRadius,
+			check: func(u *database.UserData) bool { return u.Area == "Hackney" }},
+		{name: "area unknown suggestion", state: stateSelectingArea, in: pressed(areaCallbackPrefix + "Atlantis"), want: outcomeUnexpected},
+		{name: "area stale button", state: stateSelectingArea, in: pressed(noiseCallbackPrefix + noiseAny), want: outcomeUnexpected},
+		{name: "area location", state: stateSelectingArea, in: fsm.Input{Location: hackney}, next: stateSelectingRadius,
+			check: func(u *database.UserData) bool { return u.Latitude == hackney.Latitude && u.Area != "" }},
+
+		{name: "radius", state: stateSelectingRadius, in: pressed(radiusCallbackPrefix + "1"), next: stateSearching,
+			check: func(u *database.UserData) bool { return u.RadiusMiles == 1 }},
+		{name: "radius half mile", state: stateSelectingRadius, in: pressed(radiusCallbackPrefix + "0.5"), next: stateSearching,
+			check: func(u *database.UserData) bool { return u.RadiusMiles == 0.5 }},
+		{name: "radius zero", state: stateSelectingRadius, in: pressed(radiusCallbackPrefix + "0"), want: outcomeUnexpected},
+		{name: "radius stale button", state: stateSelectingRadius, in: pressed(areaCallbackPrefix + "Hackney"), want: outcomeUnexpected},
+		{name: "radius typed", state: stateSelectingRadius, in: typed("1"), want: outcomeUnexpected},
+
+		{name: "searching takes no input", state: stateSearching, in: typed("hello"), want: outcomeUnexpected},
+
+		{name: "commute station", state: stateAwaitingCommuteDestination, in: typed("angel"), next: stateSelectingCommuteTime,
+			check: func(u *database.UserData) bool { return u.CommuteDestination == "Angel" }},
+		{name: "commute area", state: stateAwaitingCommuteDestination, in: typed("Hackney"), next: stateSelectingCommuteTime,
+			check: func(u *database.UserData) bool { return u.CommuteDestination == "Hackney" }},
+		{name: "commute unknown", state: stateAwaitingCommuteDestination, in: typed("Xyzzyqwv"), want: outcomeRejected},
+		{name: "commute suggestion", state: stateAwaitingCommuteDestination, in: pressed(areaCallbackPrefix + "Hackney"), next: stateSelectingCommuteTime},
+		{name: "commute location", state: stateAwaitingCommuteDestination, in: fsm.Input{Location: hackney}, next: stateSelectingCommuteTime,
+			check: func(u *database.UserData) bool { return u.CommuteLatitude == hackney.Latitude }},
+		{name: "commute stale button", state: stateAwaitingCommuteDestination, in: pressed(radiusCallbackPrefix + "1"), want: outcomeUnexpected},
+
+		{name: "commute time", state: stateSelectingCommuteTime, in: pressed(commuteCallbackPrefix + "30"), next: fsm.Idle, notice: true,
+			check: func(u *database.UserData) bool { return u.MaxCommuteMinutes == 30 }},
+		{name: "commute filter off", state: stateSelectingCommuteTime, in: pressed(commuteCallbackPrefix + "0"), next: fsm.Idle, notice: true,
+			check: func(u *database.UserData) bool { return u.MaxCommuteMinutes == 0 && u.CommuteDestination == "" }},
+		{name: "commute time stale button", state: stateSelectingCommuteTime, in: pressed(radiusCallbackPrefix + "1"), want: outcomeUnexpected},
+		{name: "commute time typed", state: stateSelectingCommuteTime, in: typed("30"), want: outcomeUnexpected},
+
+		{name: "digest time button", state: stateSelectingDigestTime, in: pressed(digestTimeCallbackPrefix + "08:00"), next: fsm.Idle, notice: true,
+			check: func(u *database.UserData) bool { return u.Delivery == "daily" && u.DigestTime == "08:00" }},
+		{name: "digest time typed", state: stateSelectingDigestTime, in: typed("7.30"), next: fsm.Idle, notice: true,
+			check: func(u *database.UserData) bool { return u.DigestTime == "07:30" }},
+		{name: "digest time invalid", state: stateSelectingDigestTime, in: typed("25:00"), want: outcomeRejected},
+		{name: "digest time stale button", state: stateSelectingDigestTime, in: pressed(commuteCallbackPrefix + "30"), want: outcomeUnexpected},
+
+		{name: "quiet hours button", state: stateSelectingQuietHours, in: pressed(quietHoursCallbackPrefix + "22:00-07:00"), next: fsm.Idle, notice: true,
+			check: func(u *database.UserData) bool { return u.QuietHours == "22:00-07:00" }},
+		{name: "quiet hours typed", state: stateSelectingQuietHours, in: typed("23-6"), next: fsm.Idle, notice: true,
+			check: func(u *database.UserData) bool { return u.QuietHours == "23:00-06:00" }},
+		{name: "quiet hours off", state: stateSelectingQuietHours, in: pressed(quietHoursCallbackPrefix + quietHoursOffAnswer), next: fsm.Idle, notice: true,
+			check: func(u *database.UserData) bool { return u.QuietHours == "" }},
+		{name: "quiet hours typed off", state: stateSelectingQuietHours, in: typed(quietHoursOffAnswer), want: outcomeRejected},
+		{name: "quiet hours invalid", state: stateSelectingQuietHours, in: typed("night"), want: outcomeRejected},
+		{name: "quiet hours stale button", state: stateSelectingQuietHours, in: pressed(digestTimeCallbackPrefix + "08:00"), want: outcomeUnexpected},
+
+		{name: "time zone button", state: stateAwaitingTimezone, in: pressed(timezoneCallbackPrefix + "Europe/Warsaw"), next: fsm.Idle, notice: true,
+			check: func(u *database.UserData) bool { return u.Timezone == "Europe/Warsaw" }},
+		{name: "time zone typed in lower case", state: stateAwaitingTimezone, in: typed("america/new_york"), next: fsm.Idle, notice: true,
+			check: func(u *database.UserData) bool { return u.Timezone == "America/New_York" }},
+		{name: "time zone unknown", state: stateAwaitingTimezone, in: typed("Mars/Base"), want: outcomeRejected},
+		{name: "time zone stale button", state: stateAwaitingTimezone, in: pressed(quietHoursCallbackPrefix + quietHoursOffAnswer), want: outcomeUnexpected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &database.UserData{State: string(tt.state)}
+			outcome, err := flow.Handle(tt.state, u, tt.in)
+			var rejection *fsm.Rejection
+			switch tt.want {
+			case outcomeAccepted:
+				if err != nil {
+					t.Fatalf("Handle() error = %v", err)
+				}
+				if outcome.Next != tt.next {
+					t.Errorf("Next = %q, want %q", outcome.Next, tt.next)
+				}
+				if (outcome.Notice != "") != tt.notice {
+					t.Errorf("Notice = %q, want notice: %v", outcome.Notice, tt.notice)
+				}
+				if tt.check != nil && !tt.check(u) {
+					t.Errorf("answer not stored: %+v", u)
+				}
+				if _, ok := flow.Prompt(outcome.Next, u); !ok && outcome.Next != fsm.Idle && outcome.Next != stateSearching {
+					t.Errorf("state %q has no prompt", outcome.Next)
+				}
+			case outcomeRejected:
+				if !errors.As(err, &rejection) || rejection.Prompt.Text == "" {
+					t.Fatalf("Handle() error = %v, want a rejection", err)
+				}
+			case outcomeUnexpected:
+				if !errors.Is(err, fsm.ErrUnexpectedInput) {
+					t.Fatalf("Handle() error = %v, want ErrUnexpectedInput", err)
+				}
+			}
+			if tt.want != outcomeAccepted && outcome.Next != tt.state {
+				t.Errorf("Next = %q after a refused answer, want %q", outcome.Next, tt.state)
+			}
+		})
+	}
+}
+
+func TestRoommateFlowTransitions(t *testing.T) {
+	b, c := newFlowBot(t)
+	flow := b.newRoommateFlow(c)
+
+	tests := []struct {
+		name   string
+		state  fsm.State
+		in     fsm.Input
+		want   int
+		next   fsm.State
+		notice bool
+		check  func(p *database.RoommateProfile) bool
+	}{
+		{name: "idle takes no input", state: fsm.Idle, in: typed("hello"), want: outcomeUnexpected},
+
+		{name: "budget", state: stateRoommateBudget, in: typed("700-1000"), next: stateRoommateAreas,
+			check: func(p *database.RoommateProfile) bool { return p.MinBudget == 700 && p.MaxBudget == 1000 }},
+		{name: "budget reversed", state: stateRoommateBudget, in: typed("1000-700"), want: outcomeRejected},
+		{name: "budget words", state: stateRoommateBudget, in: typed("not much"), want: outcomeRejected},
+
+		{name: "areas", state: stateRoommateAreas, in: typed("Hackney, E1"), next: stateRoommateMoveIn,
+			check: func(p *database.RoommateProfile) bool { return p.Areas == "Hackney,E1" }},
+		{name: "areas unknown", state: stateRoommateAreas, in: typed("Hackney, Xyzzyqwv"), want: outcomeRejected},
+
+		{name: "move-in date", state: stateRoommateMoveIn, in: typed("2099-01-15"), next: stateRoommateSmoking,
+			check: func(p *database.RoommateProfile) bool { return p.MoveIn.Year() == 2099 }},
+		{name: "move-in words", state: stateRoommateMoveIn, in: typed("soon"), want: outcomeRejected},
+
+		{name: "smoker", state: stateRoommateSmoking, in: pressed(roommateCallbackPrefix + roommateSmokerAction + ":yes"), next: stateRoommatePets,
+			check: func(p *database.RoommateProfile) bool { return p.Smoker }},
+		{name: "smoker stale button", state: stateRoommateSmoking, in: pressed(roommateCallbackPrefix + roommatePetsAction + ":yes"), want: outcomeUnexpected},
+		{name: "smoker typed", state: stateRoommateSmoking, in: typed("yes"), want: outcomeUnexpected},
+
+		{name: "pets", state: stateRoommatePets, in: pressed(roommateCallbackPrefix + roommatePetsAction + ":no"), next: stateRoommateWorkFromHome,
+			check: func(p *database.RoommateProfile) bool { return !p.HasPets }},
+		{name: "pets stale button", state: stateRoommatePets, in: pressed(roommateCallbackPrefix + roommateSmokerAction + ":no"), want: outcomeUnexpected},
+
+		{name: "work from home", state: stateRoommateWorkFromHome, in: pressed(roommateCallbackPrefix + roommateWorkFromHomeAction + ":sometimes"), next: stateRoommateCleanliness,
+			check: func(p *database.RoommateProfile) bool { return p.WorkFromHome == "sometimes" }},
+		{name: "work from home unknown", state: stateRoommateWorkFromHome, in: pressed(roommateCallbackPrefix + roommateWorkFromHomeAction + ":never"), want: outcomeUnexpected},
+
+		{name: "cleanliness", state: stateRoommateCleanliness, in: pressed(roommateCallbackPrefix + roommateCleanlinessAction + ":4"), next: fsm.Idle, notice: true,
+			check: func(p *database.RoommateProfile) bool { return p.Cleanliness == 4 && p.Active }},
+		{name: "cleanliness out of range", state: stateRoommateCleanliness, in: pressed(roommateCallbackPrefix + roommateCleanlinessAction + ":6"), want: outcomeUnexpected},
+		{name: "cleanliness stale button", state: stateRoommateCleanliness, in: pressed(roommateCallbackPrefix + roommatePetsAction + ":no"), want: outcomeUnexpected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &database.RoommateProfile{}
+			outcome, err := flow.Handle(tt.state, p, tt.in)
+			var rejection *fsm.Rejection
+			switch tt.want {
+			case outcomeAccepted:
+				if err != nil {
+					t.Fatalf("Handle() error = %v", err)
+				}
+				if outcome.Next != tt.next {
+					t.Errorf("Next = %q, want %q", outcome.Next, tt.next)
+				}
+				if (outcome.Notice != "") != tt.notice {
+					t.Errorf("Notice = %q, want notice: %v", outcome.Notice, tt.notice)
+				}
+				if tt.check != nil && !tt.check(p) {
+					t.Errorf("answer not stored: %+v", p)
+				}
+			case outcomeRejected:
+				if !errors.As(err, &rejection) || rejection.Prompt.Text == "" {
+					t.Fatalf("Handle() error = %v, want a rejection", err)
+				}
+			case outcomeUnexpected:
+				if !errors.Is(err, fsm.ErrUnexpectedInput) {
+					t.Fatalf("Handle() error = %v, want ErrUnexpectedInput", err)
+				}
+			}
+		})
+	}
+}
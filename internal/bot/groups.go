@@ -0,0 +1,97 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log/slog"
+	"rent_seekerbot/internal/database"
+	"rent_seekerbot/internal/real_estate_api"
+	"strings"
+)
+
+// tallyLimit is the number of listings shown by /tally.
+const tallyLimit = 10
+
+// isGroupChat reports whether the chat is a group. Telegram gives groups and supergroups
+// negative chat IDs, while private chats use the (positive) user ID.
+func isGroupChat(chatID int64) bool {
+	return chatID < 0
+}
+
+// sendShortlistedProperty adds a search result to the group's shortlist and posts it with
+// voting buttons showing the current votes.
+func (b *Bot) sendShortlistedProperty(ctx context.Context, chatID int64, property real_estate_api.Property, text string) {
+	err := b.store.AddToShortlist(chatID, database.ShortlistEntry{
+		ListingID: property.ID,
+		Address:   property.Address,
+		Price:     property.Price,
+		Bedrooms:  property.Bedrooms,
+		URL:       property.URL,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error adding listing to shortlist", "error", err)
+		b.sendMessage(ctx, chatID, text)
+		return
+	}
+	up, down, err := b.store.VoteCounts(chatID, property.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error counting votes", "error", err)
+	}
+	b.sendMessageWithMarkup(ctx, chatID, text, voteButtons(property.ID, up, down))
+}
+
+// handleVote records a member's 👍/👎 on a shortlisted listing and refreshes the counts.
+func (b *Bot) handleVote(ctx context.Context, query *tgbotapi.CallbackQuery, data string) {
+	chatID := query.Message.Chat.ID
+	direction, listingID, ok := strings.Cut(data, ":")
+	if !ok || listingID == "" {
+		b.answerCallback(ctx, query.ID, "")
+		return
+	}
+	vote := 1
+	if direction == voteDown {
+		vote = -1
+	}
+
+	if err := b.store.SaveVote(chatID, listingID, query.From.ID, vote); err != nil {
+		slog.ErrorContext(ctx, "Error saving vote", "error", err)
+		b.answerCallback(ctx, query.ID, errorMessage)
+		return
+	}
+	up, down, err := b.store.VoteCounts(chatID, listingID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error counting votes", "error", err)
+	} else {
+		if err := b.messenger.EditButtons(chatID, query.Message.MessageID, voteButtons(listingID, up, down)); err != nil {
+			slog.ErrorContext(ctx, "Failed to update vote buttons", "error", err)
+		}
+	}
+	b.answerCallback(ctx, query.ID, voteRecordedMessage)
+}
+
+// showTally ranks the chat's shortlisted listings by votes.
+func (b *Bot) showTally(ctx context.Context, chatID int64) error {
+	entries, err := b.store.Tally(chatID, tallyLimit)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error tallying votes", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+	if len(entries) == 0 {
+		b.send(ctx, chatID, tallyEmptyMessage)
+		return nil
+	}
+
+	c := b.catalogue(ctx)
+	var text strings.Builder
+	text.WriteString(c.Text(tallyHeaderMessage))
+	for i, entry := range entries {
+		text.WriteString("\n" + c.Text(tallyLineMessage, i+1, entry.Address, entry.Price, entry.Up, entry.Down))
+		if entry.URL != "" {
+			fmt.Fprintf(&text, "\n   %s", entry.URL)
+		}
+	}
+	b.sendMessage(ctx, chatID, text.String())
+	return nil
+}
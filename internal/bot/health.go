@@ -0,0 +1,193 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log/slog"
+	"net/http"
+	"rent_seekerbot/internal/fsm"
+	"rent_seekerbot/internal/logging"
+	"rent_seekerbot/internal/metrics"
+	"sync"
+	"time"
+)
+
+const (
+	// databaseCheckTimeout bounds the database ping of a readiness check.
+	databaseCheckTimeout = 2 * time.Second
+	// providerCheckTimeout bounds a provider connection test.
+	providerCheckTimeout = 10 * time.Second
+	// providerCheckInterval is how often the provider is tested in the background. Each
+	// test runs a real search, so it isn't done on every readiness probe.
+	providerCheckInterval = 30 * time.Second
+)
+
+// providerCheck holds the result of the last provider connection test.
+type providerCheck struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+	// waiting holds the chats that were told searches are unavailable, to be told when
+	// the provider recovers.
+	waiting map[int64]bool
+}
+
+// readinessReport is the body of a /readyz response.
+type readinessReport struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// HealthHandler serves /healthz, /readyz and /metrics for container orchestrators and
+// Prometheus. /healthz only shows the process is serving; /readyz also checks the
+// database and reports the listings provider's last test.
+func (b *Bot) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		report := b.readiness(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status == "not ready" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+	mux.Handle("/metrics", promhttp.Handler())
+	return mux
+}
+
+// readiness checks the database and reports the provider's last test. The bot still
+// serves users while the provider is down, so that only makes it "degraded".
+func (b *Bot) readiness(ctx context.Context) readinessReport {
+	report := readinessReport{Status: "ready", Checks: map[string]string{"database": "ok", "provider": "ok"}}
+
+	dbCtx, cancel := context.WithTimeout(ctx, databaseCheckTimeout)
+	defer cancel()
+	if err := b.store.PingContext(dbCtx); err != nil {
+		report.Status = "not ready"
+		report.Checks["database"] = err.Error()
+	}
+
+	b.providerCheck.mu.Lock()
+	checkedAt, err := b.providerCheck.checkedAt, b.providerCheck.err
+	b.providerCheck.mu.Unlock()
+	switch {
+	case checkedAt.IsZero():
+		report.Checks["provider"] = "not checked yet"
+	case err != nil:
+		report.Checks["provider"] = err.Error()
+		if report.Status == "ready" {
+			report.Status = "degraded"
+		}
+	}
+	return report
+}
+
+// providerAvailable reports whether the last provider test passed. Before the first test
+// the provider is assumed to work.
+func (b *Bot) providerAvailable() bool {
+	b.providerCheck.mu.Lock()
+	defer b.providerCheck.mu.Unlock()
+	return b.providerCheck.err == nil
+}
+
+// awaitProvider remembers to tell chatID when searches are available again.
+func (b *Bot) awaitProvider(chatID int64) {
+	b.providerCheck.mu.Lock()
+	defer b.providerCheck.mu.Unlock()
+	if b.providerCheck.waiting == nil {
+		b.providerCheck.waiting = make(map[int64]bool)
+	}
+	b.providerCheck.waiting[chatID] = true
+}
+
+// watchProvider tests the provider every providerCheckInterval until ctx is cancelled.
+func (b *Bot) watchProvider(ctx context.Context) {
+	ticker := time.NewTicker(providerCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.probeProvider(ctx)
+		}
+	}
+}
+
+// probeProvider tests the provider and switches between normal and degraded mode. When
+// the provider recovers, the chats waiting for it are told they can search again.
+func (b *Bot) probeProvider(ctx context.Context) {
+	ctx = logging.WithCorrelationID(ctx, logging.NewCorrelationID())
+	checkCtx, cancel := context.WithTimeout(ctx, providerCheckTimeout)
+	err := b.testProvider(checkCtx)
+	cancel()
+	if ctx.Err() != nil {
+		// Shutting down; the failure says nothing about the provider
+		return
+	}
+
+	b.providerCheck.mu.Lock()
+	wasUp := b.providerCheck.checkedAt.IsZero() || b.providerCheck.err == nil
+	b.providerCheck.checkedAt = time.Now()
+	b.providerCheck.err = err
+	var waiting map[int64]bool
+	if err == nil {
+		waiting = b.providerCheck.waiting
+		b.providerCheck.waiting = nil
+	}
+	b.providerCheck.mu.Unlock()
+
+	if err == nil {
+		metrics.ProviderUp.Set(1)
+	} else {
+		metrics.ProviderUp.Set(0)
+	}
+	switch {
+	case wasUp && err != nil:
+		slog.WarnContext(ctx, "Provider unavailable, searches disabled", "error", err)
+	case !wasUp && err == nil:
+		slog.InfoContext(ctx, "Provider recovered, searches enabled", "waiting_chats", len(waiting))
+		for chatID := range waiting {
+			b.notifyProviderRecovered(ctx, chatID)
+		}
+	}
+}
+
+// notifyProviderRecovered tells a chat it can search again in its language, repeating the
+// radius question if the chat is still on it.
+func (b *Bot) notifyProviderRecovered(ctx context.Context, chatID int64) {
+	ctx = b.chatContext(ctx, chatID)
+	b.send(ctx, chatID, providerRecoveredMessage)
+	userData, err := b.store.GetUser(chatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user data", "error", err)
+		return
+	}
+	if userData != nil && fsm.State(userData.State) == stateSelectingRadius {
+		b.repeatPrompt(ctx, chatID, userData)
+	}
+}
+
+// testProvider runs the provider's connection test and records it in the metrics.
+func (b *Bot) testProvider(ctx context.Context) error {
+	start := time.Now()
+	err := b.provider.TestApiConnection(ctx)
+	metrics.ObserveProviderRequest("test_connection", time.Since(start), err)
+	return err
+}
+
+// startHealthServer serves HealthHandler on addr. The server must be shut down by the caller.
+func (b *Bot) startHealthServer(addr string) *http.Server {
+	server := &http.Server{Addr: addr, Handler: b.HealthHandler()}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Health server stopped", "error", err)
+		}
+	}()
+	slog.Info("Serving health checks and metrics", "listen_addr", addr)
+	return server
+}
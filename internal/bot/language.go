@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log/slog"
+	"rent_seekerbot/internal/database"
+	"rent_seekerbot/internal/fsm"
+	"rent_seekerbot/internal/i18n"
+	"strings"
+)
+
+// flows holds the conversations asked in one language. Their states are the same in
+// every language, so a conversation can switch language between two questions.
+type flows struct {
+	search   *fsm.Machine[*database.UserData]
+	roommate *fsm.Machine[*database.RoommateProfile]
+}
+
+// catalogue returns the catalogue of the chat being served, or the default one outside
+// of an update.
+func (b *Bot) catalogue(ctx context.Context) *i18n.Catalogue {
+	if c, ok := i18n.FromContext(ctx); ok {
+		return c
+	}
+	return b.locales.Default()
+}
+
+// text formats the message with the given key in the language of the chat being served.
+func (b *Bot) text(ctx context.Context, key string, args ...any) string {
+	return b.catalogue(ctx).Text(key, args...)
+}
+
+// send formats the message with the given key in the language of the chat being served
+// and sends it.
+func (b *Bot) send(ctx context.Context, chatID int64, key string, args ...any) {
+	b.sendMessage(ctx, chatID, b.text(ctx, key, args...))
+}
+
+// searchFlow returns the search questions in the language of the chat being served.
+func (b *Bot) searchFlow(ctx context.Context) *fsm.Machine[*database.UserData] {
+	return b.flows[b.catalogue(ctx).Tag()].search
+}
+
+// roommateFlow returns the roommate questions in the language of the chat being served.
+func (b *Bot) roommateFlow(ctx context.Context) *fsm.Machine[*database.RoommateProfile] {
+	return b.flows[b.catalogue(ctx).Tag()].roommate
+}
+
+// userCatalogue picks the language of a chat: the one chosen with /language, otherwise
+// the one of the user's Telegram app. An empty languageCode falls back to the last one
+// the chat was seen with.
+func (b *Bot) userCatalogue(userData *database.UserData, languageCode string) *i18n.Catalogue {
+	if userData != nil && userData.Language != "" {
+		if c, ok := b.locales.Lookup(userData.Language); ok {
+			return c
+		}
+	}
+	if languageCode == "" && userData != nil {
+		languageCode = userData.LanguageCode
+	}
+	return b.locales.Match(languageCode)
+}
+
+// withLanguage returns a copy of ctx carrying the catalogue to answer the update with.
+// The language of the sender's app is remembered for messages sent outside of an update,
+// such as roommate matches.
+func (b *Bot) withLanguage(ctx context.Context, update tgbotapi.Update) context.Context {
+	chat, user := update.FromChat(), update.SentFrom()
+	if chat == nil || user == nil {
+		return ctx
+	}
+	userData, err := b.store.GetUser(chat.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user data", "chat_id", chat.ID, "error", err)
+	}
+	if userData != nil && user.LanguageCode != "" && userData.LanguageCode != user.LanguageCode {
+		userData.LanguageCode = user.LanguageCode
+		if err = b.store.SaveUser(chat.ID, userData); err != nil {
+			slog.ErrorContext(ctx, "Error saving language", "chat_id", chat.ID, "error", err)
+		}
+	}
+	return i18n.WithCatalogue(ctx, b.userCatalogue(userData, user.LanguageCode))
+}
+
+// chatContext returns a copy of ctx carrying the catalogue of another chat, to message
+// it outside of its own updates.
+func (b *Bot) chatContext(ctx context.Context, chatID int64) context.Context {
+	userData, err := b.store.GetUser(chatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user data", "chat_id", chatID, "error", err)
+	}
+	return i18n.WithCatalogue(ctx, b.userCatalogue(userData, ""))
+}
+
+// showLanguageMenu handles /language by offering every supported language.
+func (b *Bot) showLanguageMenu(ctx context.Context, chatID int64) error {
+	c := b.catalogue(ctx)
+	b.sendMessageWithMarkup(ctx, chatID, c.Text(languageMenuMessage), languageMenu(c, b.locales.Catalogues()))
+	return nil
+}
+
+// handleLanguageButton stores the language picked from the /language menu and confirms
+// it in that language. It returns the text to answer the button press with.
+func (b *Bot) handleLanguageButton(ctx context.Context, query *tgbotapi.CallbackQuery, userData *database.UserData) string {
+	tag := strings.TrimPrefix(query.Data, languageCallbackPrefix)
+	if tag == languageAutoAction {
+		userData.Language = ""
+		ctx = i18n.WithCatalogue(ctx, b.userCatalogue(userData, query.From.LanguageCode))
+		b.send(ctx, query.Message.Chat.ID, languageAutoMessage)
+		return ""
+	}
+	c, ok := b.locales.Lookup(tag)
+	if !ok {
+		return staleButtonMessage
+	}
+	userData.Language = c.Tag()
+	b.send(i18n.WithCatalogue(ctx, c), query.Message.Chat.ID, languageSetMessage)
+	return ""
+}
@@ -1,11 +1,182 @@
 package bot
 
+// Message keys. The text of each message is in the catalogues in internal/i18n/data;
+// plural messages are formatted with Plural, the others with Text.
 const (
-	welcomeMessage = "Hello! I’m here to assist you in finding your perfect home. " +
-		"I’ll start by asking a few questions to tailor your search preferences."
-	selectPropertyMessage = "🏠 Select the property type."
-	priceRangeMessage     = "💰 Let me know the price range for the monthly price in GBP. Format: 1200 - 1800."
-	selectBedroomsMessage = "Select the number of bedrooms."
-	selectIsFurnished     = "Do you want to search for furnished or unfurnished accommodation?"
-	selectArea            = "Please reply with the area you’d like to follow. It could be a neighbourhood, borough, or postcode area (e.g. Camden or N7)."
+	welcomeMessage           = "search.welcome"
+	selectPropertyMessage    = "search.select_property"
+	priceRangeMessage        = "search.price_range"
+	selectBedroomsMessage    = "search.select_bedrooms"
+	invalidPriceRangeMessage = "search.invalid_price_range"
+	invalidBedroomsMessage   = "search.invalid_bedrooms"
+	selectIsFurnished        = "search.select_furnished"
+	selectPetsMessage        = "search.select_pets"
+	selectNoiseMessage       = "search.select_noise"
+	selectArea               = "search.select_area"
+	selectRadiusMessage      = "search.select_radius"
+	areaCorrectedMessage     = "search.area_corrected"
+	didYouMeanMessage        = "search.did_you_mean"
+	sharedLocationLabel      = "search.shared_location"
+	areaNotFoundMessage      = "search.area_not_found"
+
+	commuteDestinationMessage = "commute.destination"
+	selectCommuteTimeMessage  = "commute.select_time"
+	commuteSavedMessage       = "commute.saved" // plural
+	commuteClearedMessage     = "commute.cleared"
+
+	searchErrorMessage          = "search.error"
+	savedPriceRangeErrorMessage = "search.saved_price_range_error"
+	savedBedroomsErrorMessage   = "search.saved_bedrooms_error"
+	noResultsMessage            = "search.no_results"
+	resultsFoundMessage         = "search.results_found" // plural
+	newSearchMessage            = "search.new_search"
+	listingMessage              = "listing.summary" // plural
+	listingDistanceMessage      = "listing.distance"
+	listingPetsMessage          = "listing.pets"
+	listingNoiseMessage         = "listing.noise"
+	listingCommuteMessage       = "listing.commute"
+	listingScoreMessage         = "listing.score"
+	listingListedMessage        = "listing.listed"
+	petsAllowedLabel            = "listing.pets_allowed"
+	petsNotAllowedLabel         = "listing.pets_not_allowed"
+	petsUnknownLabel            = "listing.pets_unknown"
+	milesMessage                = "units.miles" // plural, for whole miles
+	fractionalMilesMessage      = "units.fractional_miles"
+	minutesMessage              = "units.minutes"
+	dateLayout                  = "format.date"
+
+	roommateIntroMessage             = "roommate.intro"
+	roommateBudgetMessage            = "roommate.budget"
+	invalidBudgetMessage             = "roommate.invalid_budget"
+	roommateAreasMessage             = "roommate.areas"
+	roommateUnknownAreasMessage      = "roommate.unknown_areas"
+	roommateMoveInMessage            = "roommate.move_in"
+	invalidMoveInMessage             = "roommate.invalid_move_in"
+	roommateSmokingMessage           = "roommate.smoking"
+	roommatePetsMessage              = "roommate.pets"
+	roommateWorkFromHomeMessage      = "roommate.work_from_home"
+	roommateCleanlinessMessage       = "roommate.cleanliness"
+	roommateProfileSavedMessage      = "roommate.profile_saved"
+	roommateNotActiveMessage         = "roommate.not_active"
+	roommateStoppedMessage           = "roommate.stopped"
+	roommateNoMatchesMessage         = "roommate.no_matches"
+	roommateDeclinedMessage          = "roommate.declined"
+	roommateWaitingMessage           = "roommate.waiting"
+	roommateMatchedMessage           = "roommate.matched"
+	roommateNoLongerAvailableMessage = "roommate.no_longer_available"
+	roommateCardMessage              = "roommate.card"
+
+	errorMessage                    = "error.generic"
+	preferencesErrorMessage         = "error.preferences"
+	privateOnlyCommandMessage       = "command.private_only"
+	stepTakenMessage                = "button.step_taken"
+	staleButtonMessage              = "button.stale"
+	unknownCommandMessage           = "command.unknown"
+	unknownCommandSuggestionMessage = "command.unknown_suggestion"
+	helpHeaderMessage               = "help.header"
+	helpAdminHeaderMessage          = "help.admin_header"
+	helpGroupNotice                 = "help.group_notice"
+	helpInFlowNotice                = "help.in_flow"
+	searchRateLimitedMessage        = "search.rate_limited" // plural
+	providerUnavailableMessage      = "provider.unavailable"
+	providerRecoveredMessage        = "provider.recovered"
+
+	cancelledMessage         = "navigation.cancelled"
+	nothingToCancelMessage   = "navigation.nothing_to_cancel"
+	finishCurrentStepMessage = "navigation.finish_current_step"
+
+	noPreferencesMessage         = "preferences.none"
+	savedPreferencesMessage      = "preferences.saved_header"
+	preferencesMenuMessage       = "preferences.menu"
+	preferenceSavedMessage       = "preferences.saved"
+	preferencesIncompleteMessage = "preferences.incomplete"
+	propertyTypePreference       = "preferences.property_type"
+	priceRangePreference         = "preferences.price_range"
+	bedroomsPreference           = "preferences.bedrooms"
+	furnishedPreference          = "preferences.furnished"
+	petsPreference               = "preferences.pets"
+	quietOnlyPreference          = "preferences.quiet_only"
+	areaPreference               = "preferences.area"
+	radiusPreference             = "preferences.radius"
+	commutePreference            = "preferences.commute"
+	keywordsPreference           = "preferences.keywords"
+	sortPreference               = "preferences.sort"
+	missingPropertyType          = "preferences.missing_property_type"
+	missingPriceRange            = "preferences.missing_price_range"
+	missingBedrooms              = "preferences.missing_bedrooms"
+	missingArea                  = "preferences.missing_area"
+	searchesDegradedNotice       = "provider.degraded_notice"
+	voteRecordedMessage          = "vote.recorded"
+	tallyEmptyMessage            = "tally.empty"
+	tallyHeaderMessage           = "tally.header"
+	tallyLineMessage             = "tally.line"
+
+	languageMenuMessage = "language.menu"
+	languageSetMessage  = "language.set"
+	languageAutoMessage = "language.auto"
+
+	queryUsageMessage           = "query.usage"
+	queryNotUnderstoodMessage   = "query.not_understood"
+	queryCardHeader             = "query.card_header"
+	queryMissingMessage         = "query.missing"
+	queryCardFooter             = "query.card_footer"
+	queryAreaSuggestionsMessage = "query.area_suggestions"
+	querySavedMessage           = "query.saved"
+	queryCancelledMessage       = "query.cancelled"
+	queryExpiredMessage         = "query.expired"
+
+	sortMenuMessage = "sort.menu"
+	sortSetMessage  = "sort.set"
+
+	alertSettingsMessage     = "alerts.settings"
+	alertsNoSearchMessage    = "alerts.no_search"
+	deliveryInstantLabel     = "alerts.instant"
+	deliveryHourlyLabel      = "alerts.hourly"
+	deliveryDailyLabel       = "alerts.daily"
+	deliveryOffLabel         = "alerts.off"
+	quietHoursNoneLabel      = "alerts.quiet_none"
+	deliverySetMessage       = "alerts.delivery_set"
+	selectDigestTimeMessage  = "alerts.select_digest_time"
+	invalidDigestTimeMessage = "alerts.invalid_digest_time"
+	selectQuietHoursMessage  = "alerts.select_quiet_hours"
+	invalidQuietHoursMessage = "alerts.invalid_quiet_hours"
+	quietHoursSetMessage     = "alerts.quiet_hours_set"
+	quietHoursClearedMessage = "alerts.quiet_hours_cleared"
+	selectTimezoneMessage    = "alerts.select_timezone"
+	invalidTimezoneMessage   = "alerts.invalid_timezone"
+	timezoneSetMessage       = "alerts.timezone_set"
+	digestHeaderMessage      = "alerts.digest_header" // plural
+	digestLineMessage        = "alerts.digest_line"   // plural
+	digestMoreMessage        = "alerts.digest_more"   // plural
+
+	blockUsageMessage     = "admin.block_usage"
+	unblockUsageMessage   = "admin.unblock_usage"
+	userBlockedMessage    = "admin.user_blocked"
+	userUnblockedMessage  = "admin.user_unblocked"
+	userNotBlockedMessage = "admin.user_not_blocked"
+
+	statsMessage              = "admin.stats"
+	broadcastUsageMessage     = "admin.broadcast_usage"
+	broadcastConfirmMessage   = "admin.broadcast_confirm" // plural
+	broadcastNoneMessage      = "admin.broadcast_none"
+	broadcastCancelledMessage = "admin.broadcast_cancelled"
+	broadcastStartedMessage   = "admin.broadcast_started" // plural
+	broadcastDoneMessage      = "admin.broadcast_done"    // plural
+	userUsageMessage          = "admin.user_usage"
+	userNotFoundMessage       = "admin.user_not_found"
+	userDetailsMessage        = "admin.user_details"
+	languageAutoLabel         = "admin.language_auto"
+	answeringMemberMessage    = "admin.answering_member"
+	idleStateLabel            = "admin.state_idle"
+	noProfileLabel            = "admin.profile_none"
+	activeProfileLabel        = "admin.profile_active"
+	inactiveProfileLabel      = "admin.profile_inactive"
+	providerUsageMessage      = "admin.provider_usage"
+	providerStatusMessage     = "admin.provider_status"
+	providerCheckOKLabel      = "admin.provider_check_ok"
+	lastErrorMessage          = "admin.last_error"
+	neverLabel                = "admin.never"
+	noneLabel                 = "admin.none"
+	yesLabel                  = "common.yes"
+	noLabel                   = "common.no"
 )
@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"rent_seekerbot/internal/geo"
+	"rent_seekerbot/internal/i18n"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// messageKeys returns the message keys declared as constants in messages.go, and the
+// button labels declared in buttons.go.
+func messageKeys(t *testing.T) map[string]string {
+	t.Helper()
+	keys := make(map[string]string)
+	for _, file := range []string{"messages.go", "buttons.go"} {
+		f, err := parser.ParseFile(token.NewFileSet(), file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			spec, ok := n.(*ast.ValueSpec)
+			if !ok {
+				return true
+			}
+			for i, name := range spec.Names {
+				if i >= len(spec.Values) || file == "buttons.go" && !strings.HasSuffix(name.Name, "ButtonText") {
+					continue
+				}
+				if lit, ok := spec.Values[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					keys[name.Name], _ = strconv.Unquote(lit.Value)
+				}
+			}
+			return true
+		})
+	}
+	return keys
+}
+
+func TestMessageKeysAreInEveryLocale(t *testing.T) {
+	bundle, err := i18n.NewBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := messageKeys(t)
+	if len(keys) < 100 {
+		t.Fatalf("found %d message keys, expected the constants of messages.go", len(keys))
+	}
+	for _, c := range bundle.Catalogues() {
+		for name, key := range keys {
+			if !c.Has(key) {
+				t.Errorf("%s: %s = %q has no message", c.Tag(), name, key)
+			}
+		}
+	}
+}
+
+func TestPlaceLabelsAreTranslated(t *testing.T) {
+	bundle, err := i18n.NewBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range bundle.Catalogues() {
+		for _, kind := range []string{geo.KindOutcode, geo.KindBorough, geo.KindNeighbourhood, geo.KindTown} {
+			label := placeLabel(c, geo.Place{Name: "Hackney", Kind: kind})
+			if !c.Has(placeLabelPrefix+kind) || !strings.HasPrefix(label, "Hackney (") {
+				t.Errorf("%s: label of a place of kind %q = %q", c.Tag(), kind, label)
+			}
+		}
+	}
+}
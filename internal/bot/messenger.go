@@ -0,0 +1,80 @@
+package bot
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"rent_seekerbot/internal/fsm"
+	"rent_seekerbot/internal/metrics"
+)
+
+// OutgoingMessage is a message sent by the bot.
+type OutgoingMessage struct {
+	ChatID  int64
+	Text    string
+	Buttons [][]fsm.Button
+	// ForceReply asks clients to answer the message with a reply, which is the only way
+	// bots in groups see free text answers.
+	ForceReply bool
+}
+
+// Messenger delivers the bot's messages to a chat platform.
+type Messenger interface {
+	Send(msg OutgoingMessage) error
+	// EditButtons replaces the buttons under an earlier message. No buttons remove them.
+	EditButtons(chatID int64, messageID int, buttons [][]fsm.Button) error
+	// AnswerCallback acknowledges a button press, optionally showing a short notification.
+	AnswerCallback(callbackID, text string) error
+}
+
+// TelegramMessenger sends messages with the Telegram Bot API.
+type TelegramMessenger struct {
+	api *tgbotapi.BotAPI
+}
+
+func NewTelegramMessenger(api *tgbotapi.BotAPI) *TelegramMessenger {
+	return &TelegramMessenger{api: api}
+}
+
+func (m *TelegramMessenger) Send(msg OutgoingMessage) error {
+	message := tgbotapi.NewMessage(msg.ChatID, msg.Text)
+	switch {
+	case len(msg.Buttons) > 0:
+		message.ReplyMarkup = keyboard(msg.Buttons)
+	case msg.ForceReply:
+		message.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true}
+	}
+	_, err := m.api.Send(message)
+	return countFailure("send_message", err)
+}
+
+func (m *TelegramMessenger) EditButtons(chatID int64, messageID int, buttons [][]fsm.Button) error {
+	_, err := m.api.Send(tgbotapi.NewEditMessageReplyMarkup(chatID, messageID, keyboard(buttons)))
+	return countFailure("edit_message_reply_markup", err)
+}
+
+func (m *TelegramMessenger) AnswerCallback(callbackID, text string) error {
+	// Callback answers return a boolean rather than a message, so use Request
+	_, err := m.api.Request(tgbotapi.NewCallback(callbackID, text))
+	return countFailure("answer_callback_query", err)
+}
+
+// countFailure records a failed Telegram API call in the metrics and returns err.
+func countFailure(method string, err error) error {
+	if err != nil {
+		metrics.TelegramSendFailures.WithLabelValues(method).Inc()
+	}
+	return err
+}
+
+// keyboard converts button rows to a Telegram inline keyboard.
+func keyboard(rows [][]fsm.Button) tgbotapi.InlineKeyboardMarkup {
+	// An empty keyboard, rather than a missing one, removes the buttons of an edited message
+	markup := [][]tgbotapi.InlineKeyboardButton{}
+	for _, row := range rows {
+		var buttons []tgbotapi.InlineKeyboardButton
+		for _, button := range row {
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(button.Label, button.Data))
+		}
+		markup = append(markup, buttons)
+	}
+	return tgbotapi.InlineKeyboardMarkup{InlineKeyboard: markup}
+}
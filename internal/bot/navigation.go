@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log/slog"
+	"rent_seekerbot/internal/database"
+	"rent_seekerbot/internal/fsm"
+	"rent_seekerbot/internal/i18n"
+	"slices"
+	"strings"
+)
+
+// withNavigation adds the Back and Cancel buttons to the question of state. Free text
+// questions in groups are sent as forced replies, which can't have buttons, so they go
+// without; /back and /cancel work there instead.
+func withNavigation(c *i18n.Catalogue, chatID int64, state fsm.State, prompt fsm.Prompt) fsm.Prompt {
+	if state == fsm.Idle || len(prompt.Buttons) == 0 && isGroupChat(chatID) {
+		return prompt
+	}
+	// The rows are shared between prompts, so don't append to them in place
+	prompt.Buttons = append(slices.Clip(prompt.Buttons), navigationButtons(c, state))
+	return prompt
+}
+
+// pushHistory records the current state before moving on to next, so Back can return to it.
+func pushHistory(userData *database.UserData, next fsm.State) {
+	state := fsm.State(userData.State)
+	if state == next || state == fsm.Idle || next == fsm.Idle {
+		return
+	}
+	userData.History = append(userData.History, userData.State)
+}
+
+// popHistory removes and returns the state before the current one.
+func popHistory(userData *database.UserData) (fsm.State, bool) {
+	n := len(userData.History)
+	if n == 0 {
+		return fsm.Idle, false
+	}
+	state := userData.History[n-1]
+	userData.History = userData.History[:n-1]
+	return fsm.State(state), true
+}
+
+// handleNavigationButton handles Back and Cancel. Buttons from an earlier question
+// are ignored, and the text to answer the callback with is returned.
+func (b *Bot) handleNavigationButton(ctx context.Context, query *tgbotapi.CallbackQuery, userData *database.UserData) string {
+	action, state, _ := strings.Cut(strings.TrimPrefix(query.Data, navigationCallbackPrefix), ":")
+	if fsm.State(state) != fsm.State(userData.State) {
+		return staleButtonMessage
+	}
+	switch action {
+	case backAction:
+		b.goBack(ctx, query.Message.Chat.ID, userData)
+	case cancelAction:
+		b.cancelFlow(ctx, query.Message.Chat.ID, userData)
+	default:
+		return staleButtonMessage
+	}
+	return ""
+}
+
+// handleNavigationCommand handles /back and /cancel.
+func (b *Bot) handleNavigationCommand(ctx context.Context, chatID int64, command string) error {
+	userData, err := b.getUserData(chatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user data", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+	if command == "/back" {
+		b.goBack(ctx, chatID, userData)
+	} else {
+		b.cancelFlow(ctx, chatID, userData)
+	}
+	if userData.State == "" {
+		userData.StateOwner = 0
+		userData.History = nil
+	}
+	if err = b.store.SaveUser(chatID, userData); err != nil {
+		slog.ErrorContext(ctx, "Error saving user data", "error", err)
+		return err
+	}
+	return nil
+}
+
+// goBack asks the previous question again. On the first question it cancels, and when
+// editing a single preference it returns to the preferences menu or confirmation card.
+func (b *Bot) goBack(ctx context.Context, chatID int64, userData *database.UserData) {
+	if fsm.State(userData.State) == fsm.Idle {
+		b.cancelFlow(ctx, chatID, userData)
+		return
+	}
+	previous, ok := popHistory(userData)
+	if !ok {
+		b.cancelFlow(ctx, chatID, userData)
+		return
+	}
+	if userData.Editing != "" {
+		field, _, ok := editingField(userData)
+		if !ok || !slices.Contains(field.states, previous) {
+			b.cancelFlow(ctx, chatID, userData)
+			return
+		}
+	}
+	userData.State = string(previous)
+	b.repeatPrompt(ctx, chatID, userData)
+}
+
+// cancelFlow leaves the current flow, keeping the answers given so far. Outside a flow
+// it drops a typed search waiting for confirmation.
+func (b *Bot) cancelFlow(ctx context.Context, chatID int64, userData *database.UserData) {
+	if fsm.State(userData.State) == fsm.Idle {
+		if _, ok := b.pendingQuery(chatID); ok {
+			b.dropPendingQuery(chatID)
+			b.send(ctx, chatID, queryCancelledMessage)
+			return
+		}
+		b.send(ctx, chatID, nothingToCancelMessage)
+		return
+	}
+	if userData.Editing != "" {
+		b.finishEditing(ctx, chatID, userData, "")
+		return
+	}
+	userData.State = string(fsm.Idle)
+	userData.History = nil
+	b.send(ctx, chatID, cancelledMessage)
+}
+
+// clearButtons removes the keyboard of an answered question, so it can't be pressed again.
+func (b *Bot) clearButtons(ctx context.Context, message *tgbotapi.Message) {
+	if message == nil {
+		return
+	}
+	if err := b.messenger.EditButtons(message.Chat.ID, message.MessageID, nil); err != nil {
+		slog.WarnContext(ctx, "Failed to remove answered buttons", "error", err)
+	}
+}
@@ -0,0 +1,182 @@
+package bot
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log/slog"
+	"rent_seekerbot/internal/database"
+	"rent_seekerbot/internal/fsm"
+	"rent_seekerbot/internal/i18n"
+	"slices"
+	"strings"
+)
+
+// preferenceField is a preference that can be changed on its own from the /preferences menu.
+type preferenceField struct {
+	key string
+	// label is the message key of the menu button.
+	label string
+	// states are the steps of the search flow that set the preference, first to last.
+	states []fsm.State
+	// done is the step the search flow moves on to once the preference is set. When
+	// editing, the menu is shown again instead.
+	done fsm.State
+}
+
+var preferenceFields = []preferenceField{
+	{"type", "button.preference_type", []fsm.State{stateSelectingProperty}, stateAwaitingPriceRange},
+	{"price", "button.preference_price", []fsm.State{stateAwaitingPriceRange}, stateAwaitingBedrooms},
+	{"beds", "button.preference_beds", []fsm.State{stateAwaitingBedrooms}, stateFurnishedUnfurnished},
+	{"furnished", "button.preference_furnished", []fsm.State{stateFurnishedUnfurnished}, stateSelectingPets},
+	{"pets", "button.preference_pets", []fsm.State{stateSelectingPets}, stateSelectingNoise},
+	{"area", "button.preference_area", []fsm.State{stateSelectingArea, stateSelectingRadius}, stateSearching},
+}
+
+func findPreferenceField(key string) (preferenceField, bool) {
+	for _, field := range preferenceFields {
+		if field.key == key {
+			return field, true
+		}
+	}
+	return preferenceField{}, false
+}
+
+// editingField returns the preference being edited on its own, and whether it belongs to
+// the pending search typed in plain text rather than the saved one.
+func editingField(userData *database.UserData) (preferenceField, bool, bool) {
+	key, draft := strings.CutPrefix(userData.Editing, draftEditingPrefix)
+	field, ok := findPreferenceField(key)
+	return field, draft, ok
+}
+
+// showUserPreferences handles /preferences by showing the saved preferences with a menu
+// to change them.
+func (b *Bot) showUserPreferences(ctx context.Context, chatId int64) error {
+	userData, err := b.getUserData(chatId)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user data", "error", err)
+		b.send(ctx, chatId, preferencesErrorMessage)
+		return err
+	}
+	b.sendPreferencesMenu(ctx, chatId, userData, "")
+	return nil
+}
+
+// sendPreferencesMenu sends the preferences with the edit menu, after the message with
+// the optional header key.
+func (b *Bot) sendPreferencesMenu(ctx context.Context, chatID int64, userData *database.UserData, header string) {
+	c := b.catalogue(ctx)
+	text := c.Text(noPreferencesMessage)
+	if preferences := describePreferences(c, userData); preferences != "" {
+		text = c.Text(savedPreferencesMessage) + "\n\n" + preferences + "\n" + c.Text(preferencesMenuMessage)
+	}
+	if header != "" {
+		text = c.Text(header) + "\n\n" + text
+	}
+	b.sendMessageWithMarkup(ctx, chatID, text, preferencesMenu(c))
+}
+
+// handlePreferenceButton handles the /preferences menu buttons. It returns the text to
+// answer the callback with.
+func (b *Bot) handlePreferenceButton(ctx context.Context, query *tgbotapi.CallbackQuery, userData *database.UserData) string {
+	chatID := query.Message.Chat.ID
+	action := strings.TrimPrefix(query.Data, preferencesCallbackPrefix)
+	if action == preferencesSearchAction {
+		if missing := missingPreferences(b.catalogue(ctx), userData); len(missing) > 0 {
+			b.send(ctx, chatID, preferencesIncompleteMessage, strings.Join(missing, ", "))
+			return ""
+		}
+		b.runSearch(ctx, chatID, query.From.ID, userData)
+		return ""
+	}
+
+	field, ok := findPreferenceField(action)
+	if !ok {
+		return staleButtonMessage
+	}
+	if userData.State != string(fsm.Idle) && userData.Editing == "" {
+		// A menu from an earlier message shouldn't abandon the questions being answered
+		return finishCurrentStepMessage
+	}
+	userData.State = string(field.states[0])
+	userData.Editing = field.key
+	userData.History = nil
+	promptFor(ctx, b, chatID, b.searchFlow(ctx), field.states[0], userData)
+	return ""
+}
+
+// editPreference applies an answer while a single preference is being edited, returning
+// to the menu once it is saved. It reports false if the conversation has since moved to
+// another step, leaving the answer to the normal flow.
+func (b *Bot) editPreference(ctx context.Context, chatID int64, userData *database.UserData, in fsm.Input) (bool, error) {
+	field, draft, ok := editingField(userData)
+	state := fsm.State(userData.State)
+	if !ok || !slices.Contains(field.states, state) {
+		userData.Editing = ""
+		return false, nil
+	}
+	target := userData
+	if draft {
+		if target, ok = b.pendingQuery(chatID); !ok {
+			// The typed search was lost, e.g. by a restart
+			userData.State = string(fsm.Idle)
+			userData.Editing = ""
+			b.send(ctx, chatID, queryExpiredMessage)
+			return true, nil
+		}
+	}
+
+	outcome, err := b.searchFlow(ctx).Handle(state, target, in)
+	if err != nil {
+		return true, err
+	}
+	if outcome.Notice != "" {
+		b.sendMessage(ctx, chatID, outcome.Notice)
+	}
+	if outcome.Next != field.done {
+		pushHistory(userData, outcome.Next)
+		userData.State = string(outcome.Next)
+		promptFor(ctx, b, chatID, b.searchFlow(ctx), outcome.Next, target)
+		return true, nil
+	}
+	b.finishEditing(ctx, chatID, userData, preferenceSavedMessage)
+	return true, nil
+}
+
+// finishEditing returns from editing a single preference to the preferences menu, after
+// the message with the optional header key, or to the confirmation card of the typed
+// search the preference belongs to.
+func (b *Bot) finishEditing(ctx context.Context, chatID int64, userData *database.UserData, header string) {
+	_, draft, _ := editingField(userData)
+	userData.State = string(fsm.Idle)
+	userData.Editing = ""
+	userData.History = nil
+	if !draft {
+		b.sendPreferencesMenu(ctx, chatID, userData, header)
+		return
+	}
+	if pending, ok := b.pendingQuery(chatID); ok {
+		b.sendQueryCard(ctx, chatID, pending, nil)
+		return
+	}
+	b.send(ctx, chatID, queryExpiredMessage)
+}
+
+// missingPreferences names the preferences a search needs that haven't been set, in the
+// language of c.
+func missingPreferences(c *i18n.Catalogue, userData *database.UserData) []string {
+	var missing []string
+	if userData.PropertyType == "" {
+		missing = append(missing, c.Text(missingPropertyType))
+	}
+	if userData.PriceRange == "" {
+		missing = append(missing, c.Text(missingPriceRange))
+	}
+	if userData.Bedrooms == "" {
+		missing = append(missing, c.Text(missingBedrooms))
+	}
+	if userData.Area == "" {
+		missing = append(missing, c.Text(missingArea))
+	}
+	return missing
+}
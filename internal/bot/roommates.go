@@ -0,0 +1,462 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log/slog"
+	"rent_seekerbot/internal/database"
+	"rent_seekerbot/internal/fsm"
+	"rent_seekerbot/internal/geo"
+	"rent_seekerbot/internal/i18n"
+	"rent_seekerbot/internal/query"
+	"rent_seekerbot/internal/roommate"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Roommate profile states, stored in the users table like the search flow states.
+const (
+	stateRoommateBudget       fsm.State = "roommate_budget"
+	stateRoommateAreas        fsm.State = "roommate_areas"
+	stateRoommateMoveIn       fsm.State = "roommate_move_in"
+	stateRoommateSmoking      fsm.State = "roommate_smoking"
+	stateRoommatePets         fsm.State = "roommate_pets"
+	stateRoommateWorkFromHome fsm.State = "roommate_work_from_home"
+	stateRoommateCleanliness  fsm.State = "roommate_cleanliness"
+)
+
+// newRoommateFlow builds the roommate profile questions, asked in the language of c. The
+// profile is activated when the last question is answered.
+func (b *Bot) newRoommateFlow(c *i18n.Catalogue) *fsm.Machine[*database.RoommateProfile] {
+	return fsm.MustNew(map[fsm.State]fsm.Step[*database.RoommateProfile]{
+		fsm.Idle: {},
+		stateRoommateBudget: {
+			Prompt: textPrompt[*database.RoommateProfile](c.Text(roommateBudgetMessage)),
+			OnText: onRoommateBudget(c),
+			Next:   []fsm.State{stateRoommateAreas},
+		},
+		stateRoommateAreas: {
+			Prompt: textPrompt[*database.RoommateProfile](c.Text(roommateAreasMessage)),
+			OnText: b.onRoommateAreas(c),
+			Next:   []fsm.State{stateRoommateMoveIn},
+		},
+		stateRoommateMoveIn: {
+			Prompt: textPrompt[*database.RoommateProfile](c.Text(roommateMoveInMessage)),
+			OnText: onRoommateMoveIn(c),
+			Next:   []fsm.State{stateRoommateSmoking},
+		},
+		stateRoommateSmoking: {
+			Prompt: buttonPrompt[*database.RoommateProfile](c.Text(roommateSmokingMessage), roommateYesNo(c, roommateSmokerAction)),
+			OnButton: onRoommateAnswer(roommateSmokerAction, func(p *database.RoommateProfile, value string) bool {
+				p.Smoker = value == "yes"
+				return true
+			}, stateRoommatePets),
+			Next: []fsm.State{stateRoommatePets},
+		},
+		stateRoommatePets: {
+			Prompt: buttonPrompt[*database.RoommateProfile](c.Text(roommatePetsMessage), roommateYesNo(c, roommatePetsAction)),
+			OnButton: onRoommateAnswer(roommatePetsAction, func(p *database.RoommateProfile, value string) bool {
+				p.HasPets = value == "yes"
+				return true
+			}, stateRoommateWorkFromHome),
+			Next: []fsm.State{stateRoommateWorkFromHome},
+		},
+		stateRoommateWorkFromHome: {
+			Prompt: buttonPrompt[*database.RoommateProfile](c.Text(roommateWorkFromHomeMessage), roommateWorkFromHome(c)),
+			OnButton: onRoommateAnswer(roommateWorkFromHomeAction, func(p *database.RoommateProfile, value string) bool {
+				switch value {
+				case roommate.WorkFromHomeYes, roommate.WorkFromHomeSometimes, roommate.WorkFromHomeNo:
+					p.WorkFromHome = value
+					return true
+				}
+				return false
+			}, stateRoommateCleanliness),
+			Next: []fsm.State{stateRoommateCleanliness},
+		},
+		stateRoommateCleanliness: {
+			Prompt:   buttonPrompt[*database.RoommateProfile](c.Text(roommateCleanlinessMessage), roommateCleanliness),
+			OnButton: onRoommateCleanliness(c),
+			Next:     []fsm.State{fsm.Idle},
+		},
+	})
+}
+
+var moveInLayouts = []string{"2006-01-02", "02/01/2006", "2/1/2006", "2 January 2006", "2 Jan 2006"}
+
+// startRoommateSetup creates or restarts the user's roommate profile. The profile stays
+// hidden from matching until every question has been answered.
+func (b *Bot) startRoommateSetup(ctx context.Context, chatID int64) error {
+	profile, err := b.store.GetRoommateProfile(chatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting roommate profile", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+	if profile == nil {
+		profile = &database.RoommateProfile{ChatID: chatID}
+	}
+	profile.Active = false
+	if err = b.store.SaveRoommateProfile(profile); err != nil {
+		slog.ErrorContext(ctx, "Error saving roommate profile", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+
+	if err = b.setUserState(ctx, chatID, stateRoommateBudget); err != nil {
+		return err
+	}
+	b.send(ctx, chatID, roommateIntroMessage)
+	promptFor(ctx, b, chatID, b.roommateFlow(ctx), stateRoommateBudget, profile)
+	return nil
+}
+
+// stopRoommateMatching hides the user's profile from other people's matches.
+func (b *Bot) stopRoommateMatching(ctx context.Context, chatID int64) error {
+	profile, err := b.store.GetRoommateProfile(chatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting roommate profile", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+	if profile == nil || !profile.Active {
+		b.send(ctx, chatID, roommateNotActiveMessage)
+		return nil
+	}
+	profile.Active = false
+	if err = b.store.SaveRoommateProfile(profile); err != nil {
+		slog.ErrorContext(ctx, "Error saving roommate profile", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+	b.send(ctx, chatID, roommateStoppedMessage)
+	return nil
+}
+
+// setUserState stores the conversation state without touching the search preferences.
+func (b *Bot) setUserState(ctx context.Context, chatID int64, state fsm.State) error {
+	userData, err := b.getUserData(chatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user data", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+	userData.State = string(state)
+	userData.Editing = ""
+	userData.History = nil
+	if err = b.store.SaveUser(chatID, userData); err != nil {
+		slog.ErrorContext(ctx, "Error updating user state", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+	return nil
+}
+
+// inRoommateFlow reports whether the conversation is answering the roommate questions.
+func (b *Bot) inRoommateFlow(ctx context.Context, state fsm.State) bool {
+	return state != fsm.Idle && b.roommateFlow(ctx).Has(state)
+}
+
+// advanceRoommate applies an answer to the user's roommate profile.
+func (b *Bot) advanceRoommate(ctx context.Context, chatID int64, from *tgbotapi.User, userData *database.UserData, in fsm.Input) error {
+	profile, err := b.store.GetRoommateProfile(chatID)
+	if err != nil || profile == nil {
+		slog.ErrorContext(ctx, "Error getting roommate profile", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return nil
+	}
+	outcome, err := step(ctx, b, chatID, b.roommateFlow(ctx), userData, profile, in)
+	if err != nil {
+		return err
+	}
+	if outcome.Next == fsm.Idle {
+		profile.Username = from.UserName
+		profile.FirstName = from.FirstName
+	}
+	if err = b.store.SaveRoommateProfile(profile); err != nil {
+		slog.ErrorContext(ctx, "Error saving roommate profile", "error", err)
+		b.send(ctx, chatID, errorMessage)
+	}
+	return nil
+}
+
+func onRoommateBudget(c *i18n.Catalogue) fsm.Handler[*database.RoommateProfile] {
+	return func(p *database.RoommateProfile, in fsm.Input) (fsm.Outcome, error) {
+		minBudget, maxBudget, err := query.ParsePriceRange(in.Text)
+		if err != nil || minBudget < 0 || minBudget > maxBudget {
+			return fsm.Outcome{}, fsm.Reject(c.Text(invalidBudgetMessage))
+		}
+		p.MinBudget, p.MaxBudget = minBudget, maxBudget
+		return fsm.Go(stateRoommateAreas), nil
+	}
+}
+
+func (b *Bot) onRoommateAreas(c *i18n.Catalogue) fsm.Handler[*database.RoommateProfile] {
+	return func(p *database.RoommateProfile, in fsm.Input) (fsm.Outcome, error) {
+		areas, unknown := b.resolveAreaList(in.Text)
+		if len(unknown) > 0 || len(areas) == 0 {
+			return fsm.Outcome{}, fsm.Reject(c.Text(roommateUnknownAreasMessage, strings.Join(unknown, ", ")))
+		}
+		p.Areas = strings.Join(areas, ",")
+		return fsm.Go(stateRoommateMoveIn), nil
+	}
+}
+
+func onRoommateMoveIn(c *i18n.Catalogue) fsm.Handler[*database.RoommateProfile] {
+	return func(p *database.RoommateProfile, in fsm.Input) (fsm.Outcome, error) {
+		moveIn, err := parseMoveInDate(in.Text, time.Now())
+		if err != nil {
+			return fsm.Outcome{}, fsm.Reject(c.Text(invalidMoveInMessage))
+		}
+		p.MoveIn = moveIn
+		return fsm.Go(stateRoommateSmoking), nil
+	}
+}
+
+// onRoommateAnswer accepts a button for the given action. set stores the value and
+// reports whether it was valid.
+func onRoommateAnswer(action string, set func(p *database.RoommateProfile, value string) bool, next fsm.State) fsm.Handler[*database.RoommateProfile] {
+	return func(p *database.RoommateProfile, in fsm.Input) (fsm.Outcome, error) {
+		value, ok := strings.CutPrefix(in.Data, roommateCallbackPrefix+action+":")
+		if !ok || !set(p, value) {
+			return fsm.Outcome{}, fsm.ErrUnexpectedInput
+		}
+		return fsm.Go(next), nil
+	}
+}
+
+func onRoommateCleanliness(c *i18n.Catalogue) fsm.Handler[*database.RoommateProfile] {
+	return func(p *database.RoommateProfile, in fsm.Input) (fsm.Outcome, error) {
+		value, ok := strings.CutPrefix(in.Data, roommateCallbackPrefix+roommateCleanlinessAction+":")
+		cleanliness, err := strconv.Atoi(value)
+		if !ok || err != nil || cleanliness < 1 || cleanliness > 5 {
+			return fsm.Outcome{}, fsm.ErrUnexpectedInput
+		}
+		p.Cleanliness = cleanliness
+		p.Active = true
+		return fsm.GoWithNotice(fsm.Idle, c.Text(roommateProfileSavedMessage)), nil
+	}
+}
+
+// handleRoommateDecision processes the Accept/Decline buttons under a proposed roommate.
+// They stay valid after the profile questions, so they are handled outside b.roommateFlow.
+func (b *Bot) handleRoommateDecision(ctx context.Context, chatID int64, data string) {
+	action, matchID, _ := strings.Cut(strings.TrimPrefix(data, roommateCallbackPrefix), ":")
+	b.decideRoommateMatch(ctx, chatID, matchID, action == roommateAcceptAction)
+}
+
+// isRoommateDecision reports whether callback data comes from the Accept/Decline buttons.
+func isRoommateDecision(data string) bool {
+	return strings.HasPrefix(data, roommateCallbackPrefix+roommateAcceptAction+":") ||
+		strings.HasPrefix(data, roommateCallbackPrefix+roommateDeclineAction+":")
+}
+
+// showNextRoommateMatch proposes the most compatible person the user hasn't decided on yet.
+func (b *Bot) showNextRoommateMatch(ctx context.Context, chatID int64) error {
+	profile, err := b.store.GetRoommateProfile(chatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting roommate profile", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+	if profile == nil || !profile.Active {
+		b.send(ctx, chatID, roommateNotActiveMessage)
+		return nil
+	}
+
+	candidates, err := b.store.ActiveRoommateProfiles(chatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting roommate profiles", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+
+	type scoredProfile struct {
+		profile database.RoommateProfile
+		score   int
+	}
+	var scored []scoredProfile
+	own := b.toScoringProfile(profile)
+	for _, candidate := range candidates {
+		score, ok := roommate.Score(own, b.toScoringProfile(&candidate))
+		if !ok || score < roommate.MatchThreshold {
+			continue
+		}
+		match, err := b.store.GetRoommateMatch(chatID, candidate.ChatID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error getting roommate match", "error", err)
+			continue
+		}
+		if match != nil && (match.StatusOf(chatID) != database.MatchPending ||
+			match.StatusOf(candidate.ChatID) == database.MatchDeclined) {
+			continue
+		}
+		scored = append(scored, scoredProfile{candidate, score})
+	}
+	if len(scored) == 0 {
+		b.send(ctx, chatID, roommateNoMatchesMessage)
+		return nil
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool { return scored[i].score > scored[j].score })
+	best := scored[0]
+	match, err := b.store.ProposeRoommateMatch(chatID, best.profile.ChatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error saving roommate match", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+	c := b.catalogue(ctx)
+	b.sendMessageWithMarkup(ctx, chatID, roommateCard(c, &best.profile, best.score), roommateDecision(c, match.ID))
+	return nil
+}
+
+// decideRoommateMatch records a decision about the proposed match with the given ID.
+// Buttons for matches that weren't proposed to the user are ignored, and only users with
+// an active profile can decide. Contact details are only exchanged once both sides have
+// accepted; until then the other person is shown this user's card.
+func (b *Bot) decideRoommateMatch(ctx context.Context, chatID int64, matchID string, accepted bool) {
+	proposed, err := b.store.GetRoommateMatchByID(matchID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting roommate match", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return
+	}
+	if proposed == nil || !proposed.Includes(chatID) {
+		slog.WarnContext(ctx, "Ignoring decision about a roommate match not proposed to the user", "chat_id", chatID)
+		return
+	}
+	profile, err := b.store.GetRoommateProfile(chatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting roommate profile", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return
+	}
+	if profile == nil || !profile.Active {
+		b.send(ctx, chatID, roommateNotActiveMessage)
+		return
+	}
+
+	status := database.MatchDeclined
+	if accepted {
+		status = database.MatchAccepted
+	}
+	match, err := b.store.SaveRoommateDecision(matchID, chatID, status)
+	if err != nil || match == nil {
+		slog.ErrorContext(ctx, "Error saving roommate decision", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return
+	}
+	if !accepted {
+		b.send(ctx, chatID, roommateDeclinedMessage)
+		return
+	}
+
+	otherID := match.Other(chatID)
+	other, err := b.store.GetRoommateProfile(otherID)
+	if err != nil || other == nil || !other.Active {
+		slog.ErrorContext(ctx, "Error getting roommate profile", "error", err)
+		b.send(ctx, chatID, roommateNoLongerAvailableMessage)
+		return
+	}
+
+	// The other person is told in their own language
+	otherCtx := b.chatContext(ctx, otherID)
+	switch match.StatusOf(otherID) {
+	case database.MatchAccepted:
+		b.send(ctx, chatID, roommateMatchedMessage, other.FirstName, contactLink(other))
+		b.send(otherCtx, otherID, roommateMatchedMessage, profile.FirstName, contactLink(profile))
+	case database.MatchPending:
+		b.send(ctx, chatID, roommateWaitingMessage)
+		if score, ok := roommate.Score(b.toScoringProfile(other), b.toScoringProfile(profile)); ok {
+			c := b.catalogue(otherCtx)
+			b.sendMessageWithMarkup(otherCtx, otherID, roommateCard(c, profile, score), roommateDecision(c, match.ID))
+		}
+	default:
+		b.send(ctx, chatID, roommateWaitingMessage)
+	}
+}
+
+// toScoringProfile converts a stored profile for the scoring engine. Areas that are no
+// longer in the gazetteer are skipped.
+func (b *Bot) toScoringProfile(profile *database.RoommateProfile) roommate.Profile {
+	scoring := roommate.Profile{
+		MinBudget:    profile.MinBudget,
+		MaxBudget:    profile.MaxBudget,
+		MoveIn:       profile.MoveIn,
+		Smoker:       profile.Smoker,
+		HasPets:      profile.HasPets,
+		WorkFromHome: profile.WorkFromHome,
+		Cleanliness:  profile.Cleanliness,
+	}
+	for _, name := range strings.Split(profile.Areas, ",") {
+		if place, ok := b.gazetteer.Lookup(name); ok {
+			scoring.Areas = append(scoring.Areas, place)
+		}
+	}
+	return scoring
+}
+
+// roommateCard describes a profile in the language of c without revealing who it belongs to.
+func roommateCard(c *i18n.Catalogue, profile *database.RoommateProfile, score int) string {
+	return c.Text(roommateCardMessage, score, profile.MinBudget, profile.MaxBudget,
+		strings.ReplaceAll(profile.Areas, ",", ", "), profile.MoveIn.Format(c.Text(dateLayout)),
+		yesNo(c, profile.Smoker), yesNo(c, profile.HasPets),
+		optionLabel(c, workFromHomeOptions, profile.WorkFromHome), profile.Cleanliness)
+}
+
+// contactLink returns a way to reach the user in Telegram. In private chats the chat ID
+// is the user ID, so a profile link works even without a username.
+func contactLink(profile *database.RoommateProfile) string {
+	if profile.Username != "" {
+		return "@" + profile.Username
+	}
+	return fmt.Sprintf("tg://user?id=%d", profile.ChatID)
+}
+
+func yesNo(c *i18n.Catalogue, value bool) string {
+	if value {
+		return c.Text(yesLabel)
+	}
+	return c.Text(noLabel)
+}
+
+// resolveAreaList resolves comma separated areas. Ambiguous or unknown entries are returned
+// separately so the user can correct them.
+func (b *Bot) resolveAreaList(text string) ([]string, []string) {
+	var areas, unknown []string
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		resolution := b.gazetteer.Resolve(part)
+		if resolution.Place == nil {
+			unknown = append(unknown, part)
+			continue
+		}
+		areas = append(areas, resolution.Place.Name)
+	}
+	return areas, unknown
+}
+
+// parseMoveInDate parses a move-in date, accepting "now", "asap" or "teraz" for today.
+func parseMoveInDate(text string, now time.Time) (time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	text = strings.TrimSpace(text)
+	switch geo.Normalise(text) {
+	case "now", "asap", "today", "teraz":
+		return today, nil
+	}
+	for _, layout := range moveInLayouts {
+		if date, err := time.Parse(layout, text); err == nil {
+			if date.Before(today) {
+				return time.Time{}, fmt.Errorf("move-in date %s is in the past", text)
+			}
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid move-in date %q", text)
+}
@@ -0,0 +1,111 @@
+package bot
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log/slog"
+	"rent_seekerbot/internal/database"
+	"rent_seekerbot/internal/i18n"
+	"rent_seekerbot/internal/ranking"
+	"slices"
+	"strings"
+)
+
+// keywordLabelPrefix followed by a keyword, with underscores for spaces, is the message
+// key of its label.
+const keywordLabelPrefix = "keyword."
+
+// sortOptions are the orders offered by /sort. Quickest commute first is only offered
+// when the commute filter is on, see userSortOptions.
+var sortOptions = []option{
+	{ranking.BestMatch, sortBestButtonText},
+	{ranking.Cheapest, sortCheapestButtonText},
+	{ranking.Newest, sortNewestButtonText},
+	{ranking.Nearest, sortNearestButtonText},
+	{ranking.Quickest, sortQuickestButtonText},
+}
+
+// userSortOptions returns the orders the user can pick from.
+func userSortOptions(userData *database.UserData) []option {
+	if userData.MaxCommuteMinutes > 0 {
+		return sortOptions
+	}
+	var options []option
+	for _, o := range sortOptions {
+		if o.value != ranking.Quickest {
+			options = append(options, o)
+		}
+	}
+	return options
+}
+
+// sortOrder returns the order results are shown in: the one chosen with /sort, or else
+// defaultSortOrder.
+func sortOrder(userData *database.UserData) string {
+	if !ranking.IsOrder(userData.SortOrder) || userData.SortOrder == ranking.Quickest && userData.MaxCommuteMinutes == 0 {
+		return defaultSortOrder(userData)
+	}
+	return userData.SortOrder
+}
+
+// defaultSortOrder is the quickest commute first when the commute filter is on, as the
+// user has said how far they will travel, and the best match first otherwise.
+func defaultSortOrder(userData *database.UserData) string {
+	if userData.MaxCommuteMinutes > 0 {
+		return ranking.Quickest
+	}
+	return ranking.BestMatch
+}
+
+// rankingSearch describes the saved search to the ranking engine.
+func rankingSearch(userData *database.UserData, minPrice, maxPrice int) ranking.Search {
+	return ranking.Search{
+		MinPrice:    minPrice,
+		MaxPrice:    maxPrice,
+		Latitude:    userData.Latitude,
+		Longitude:   userData.Longitude,
+		RadiusMiles: userData.RadiusMiles,
+		Keywords:    userData.Keywords,
+	}
+}
+
+// keywordLabels translates the keywords of a search, keeping unknown ones as they are.
+func keywordLabels(c *i18n.Catalogue, keywords []string) string {
+	labels := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		key := keywordLabelPrefix + strings.ReplaceAll(keyword, " ", "_")
+		if c.Has(key) {
+			labels = append(labels, c.Text(key))
+		} else {
+			labels = append(labels, keyword)
+		}
+	}
+	return strings.Join(labels, ", ")
+}
+
+// showSortMenu handles /sort by offering the orders results can be shown in.
+func (b *Bot) showSortMenu(ctx context.Context, chatID int64) error {
+	userData, err := b.getUserData(chatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user data", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+	c := b.catalogue(ctx)
+	order := sortOrder(userData)
+	b.sendMessageWithMarkup(ctx, chatID, c.Text(sortMenuMessage, optionLabel(c, sortOptions, order)), sortMenu(c, userSortOptions(userData), order))
+	return nil
+}
+
+// handleSortButton stores the order picked from the /sort menu with the saved search.
+// It returns the text to answer the button press with.
+func (b *Bot) handleSortButton(ctx context.Context, query *tgbotapi.CallbackQuery, userData *database.UserData) string {
+	order := strings.TrimPrefix(query.Data, sortCallbackPrefix)
+	if !slices.ContainsFunc(userSortOptions(userData), func(o option) bool { return o.value == order }) {
+		return staleButtonMessage
+	}
+	userData.SortOrder = order
+	c := b.catalogue(ctx)
+	b.sendMessage(ctx, query.Message.Chat.ID, c.Text(sortSetMessage, optionLabel(c, sortOptions, order)))
+	return ""
+}
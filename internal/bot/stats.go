@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"sync"
+	"time"
+)
+
+// providerStats counts provider searches and failures since the bot started.
+type providerStats struct {
+	mu            sync.Mutex
+	calls         int
+	errors        int
+	totalLatency  time.Duration
+	lastError     string
+	lastErrorAt   time.Time
+	lastSuccessAt time.Time
+}
+
+// providerSnapshot is a copy of providerStats for reporting.
+type providerSnapshot struct {
+	Calls         int
+	Errors        int
+	AvgLatency    time.Duration
+	LastError     string
+	LastErrorAt   time.Time
+	LastSuccessAt time.Time
+}
+
+func (s *providerStats) record(latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	s.totalLatency += latency
+	if err != nil {
+		s.errors++
+		s.lastError = err.Error()
+		s.lastErrorAt = time.Now()
+		return
+	}
+	s.lastSuccessAt = time.Now()
+}
+
+func (s *providerStats) snapshot() providerSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := providerSnapshot{
+		Calls:         s.calls,
+		Errors:        s.errors,
+		LastError:     s.lastError,
+		LastErrorAt:   s.lastErrorAt,
+		LastSuccessAt: s.lastSuccessAt,
+	}
+	if s.calls > 0 {
+		snapshot.AvgLatency = s.totalLatency / time.Duration(s.calls)
+	}
+	return snapshot
+}
+
+// ErrorRate returns the share of failed calls as a percentage.
+func (s providerSnapshot) ErrorRate() float64 {
+	if s.Calls == 0 {
+		return 0
+	}
+	return 100 * float64(s.Errors) / float64(s.Calls)
+}
@@ -1,110 +1,278 @@
 package bot
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"log"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"rent_seekerbot/internal/commute"
+	"rent_seekerbot/internal/config"
 	"rent_seekerbot/internal/database"
+	"rent_seekerbot/internal/fsm"
+	"rent_seekerbot/internal/geo"
+	"rent_seekerbot/internal/i18n"
+	"rent_seekerbot/internal/metrics"
+	"rent_seekerbot/internal/noise"
+	"rent_seekerbot/internal/query"
+	"rent_seekerbot/internal/ranking"
 	"rent_seekerbot/internal/real_estate_api"
 	"strconv"
 	"strings"
-)
-
-var (
-	bot          *tgbotapi.BotAPI
-	zooplaClient real_estate_api.ZooplaClientInterface
-	db           *database.DB
+	"syscall"
+	"time"
 )
 
 const (
-	stateAwaitingPriceRange   = "awaiting_price_range"
-	stateAwaitingBedrooms     = "awaiting_bedrooms"
-	stateFurnishedUnfurnished = "furnished_unfurnished"
-	stateSelectingArea        = "selecting_area"
+	// shutdownTimeout is how long the webhook server waits for requests in flight when stopping.
+	shutdownTimeout = 10 * time.Second
+	// drainTimeout is how long shutdown waits for updates that are being handled.
+	drainTimeout = 20 * time.Second
 )
 
-// StartBot initializes and starts the Telegram bot.
-func StartBot(token string, zClient real_estate_api.ZooplaClientInterface, database *database.DB) error {
-	var err error
-	bot, err = tgbotapi.NewBotAPI(token)
+// Options selects how the bot receives updates, and who administers it.
+type Options struct {
+	// Mode is config.ModePolling (the default) or config.ModeWebhook.
+	Mode string
+	// WebhookURL is the public https URL Telegram posts updates to.
+	WebhookURL string
+	// ListenAddr is the address the webhook server listens on, e.g. ":8443".
+	ListenAddr string
+	// SecretToken is sent by Telegram with every webhook request.
+	SecretToken string
+	// TLSCertFile and TLSKeyFile serve the webhook over HTTPS. Leave them empty when a
+	// reverse proxy terminates TLS.
+	TLSCertFile string
+	TLSKeyFile  string
+	// AdminIDs are the Telegram user IDs allowed to use admin commands such as /block.
+	AdminIDs []int64
+	// HealthAddr is the address serving /healthz, /readyz and /metrics, e.g. ":9090".
+	// Leave it empty to turn the endpoints off.
+	HealthAddr string
+	// PollTimeout is how long a long polling request waits for updates. Zero means 60 seconds.
+	PollTimeout time.Duration
+	// Workers is the number of updates handled at the same time. Zero means workerCount.
+	Workers int
+	// SearchBurst and SearchInterval limit each user's searches. Zero means the defaults.
+	SearchBurst    int
+	SearchInterval time.Duration
+	// AlertInterval is how often saved searches are run for new listings. Zero means
+	// defaultAlertInterval.
+	AlertInterval time.Duration
+}
+
+// StartBot initializes and starts the Telegram bot. It returns after SIGINT or SIGTERM,
+// once in-flight updates have been handled and the database has been closed.
+func StartBot(token string, zClient real_estate_api.ZooplaClientInterface, database *database.DB, opts Options) error {
+	api, err := tgbotapi.NewBotAPI(token)
+	if err != nil {
+		// The request URL contains the token, so leave it out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("error connecting to Telegram: %w", err)
+	}
+	messenger := NewThrottledMessenger(NewTelegramMessenger(api))
+	b, err := New(messenger, database, zClient)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
-
-	zooplaClient = zClient
-	if zooplaClient == nil {
-		return fmt.Errorf("zooplaClient is nil")
+	b.SetAdmins(opts.AdminIDs...)
+	if opts.SearchBurst > 0 && opts.SearchInterval > 0 {
+		b.SetSearchQuota(opts.SearchBurst, opts.SearchInterval)
+	}
+	if opts.AlertInterval > 0 {
+		b.SetAlertInterval(opts.AlertInterval)
 	}
-	db = database
 	// Set this to true to log all interactions with telegram servers
-	bot.Debug = false
-
-	log.Printf("Authorised on account %s", bot.Self.UserName)
+	api.Debug = false
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	slog.Info("Authorised on account", "bot", api.Self.UserName)
+	b.registerCommands(api)
 
-	// Create a new cancellable background context. Calling `cancel()` leads to the cancellation of the context
-	ctx := context.Background()
-	ctx, cancel := context.WithCancel(ctx)
-
-	// `updates` is a golang channel which receives telegram updates
-	updates := bot.GetUpdatesChan(u)
+	var updates tgbotapi.UpdatesChannel
+	var hook *webhook
+	switch opts.Mode {
+	case config.ModeWebhook:
+		hook, err = startWebhook(api, opts)
+		if err != nil {
+			return err
+		}
+		updates = hook.updates
+	case config.ModePolling, "":
+		// getUpdates fails while a webhook is registered, e.g. by an earlier run in webhook mode
+		if _, err = api.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+			return fmt.Errorf("error removing webhook: %w", err)
+		}
+		u := tgbotapi.NewUpdate(0)
+		u.Timeout = 60
+		if opts.PollTimeout > 0 {
+			u.Timeout = int(opts.PollTimeout.Seconds())
+		}
 
-	// Pass cancellable context to goroutine
-	go receiveUpdates(ctx, updates)
+		// `updates` is a golang channel which receives telegram updates
+		updates = api.GetUpdatesChan(u)
+	default:
+		return fmt.Errorf("unknown bot mode %q", opts.Mode)
+	}
+
+	var healthServer *http.Server
+	if opts.HealthAddr != "" {
+		healthServer = b.startHealthServer(opts.HealthAddr)
+	}
+
+	// Stop on Ctrl+C, or when systemd or Docker ask the process to terminate
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	workerTotal := workerCount
+	if opts.Workers > 0 {
+		workerTotal = opts.Workers
+	}
+	// A provider outage at startup only disables searches until it recovers
+	b.probeProvider(ctx)
+	b.background.Add(1)
+	go func() {
+		defer b.background.Done()
+		b.watchProvider(ctx)
+	}()
+	b.background.Add(1)
+	go func() {
+		defer b.background.Done()
+		b.watchAlerts(ctx)
+	}()
+
+	if hook == nil {
+		updates = pollUntilDone(ctx, updates)
+	}
+	workers := newDispatcher(workerTotal, workerQueueSize, b.HandleUpdate)
+	done := make(chan struct{})
+	go func() {
+		receiveUpdates(updates, workers)
+		workers.close()
+		b.background.Wait()
+		// Deliver the replies still queued behind the send limits
+		messenger.Close()
+		close(done)
+	}()
 
 	// Tell the user the bot is online
-	log.Println("Start listening for updates. Press enter to stop")
+	slog.Info("Start listening for updates. Press Ctrl+C to stop", "mode", opts.Mode)
+
+	<-ctx.Done()
+	// A second signal kills the process straight away
+	stop()
+	slog.Info("Shutting down...")
+
+	// Stop receiving first. The updates channel is closed once every update received has
+	// been put on it, then the workers handle what is queued and stop.
+	if hook != nil {
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancelShutdown()
+		if err := hook.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Error stopping webhook server", "error", err)
+		}
+	} else {
+		api.StopReceivingUpdates()
+	}
 
-	// Wait for a newline symbol, then cancel handling updates
-	bufio.NewReader(os.Stdin).ReadBytes('\n')
-	cancel()
+	select {
+	case <-done:
+	case <-time.After(drainTimeout):
+		slog.Warn("Gave up waiting for handlers", "timeout", drainTimeout)
+	}
 
+	if healthServer != nil {
+		// Kept up while draining so orchestrators can still probe the process
+		healthServer.Close()
+	}
+	if err := database.Close(); err != nil {
+		return fmt.Errorf("error closing database: %w", err)
+	}
+	slog.Info("Bot stopped")
 	return nil
 }
 
-// receiveUpdates listens for incoming updates and handles them.
-func receiveUpdates(ctx context.Context, updates tgbotapi.UpdatesChannel) {
-	// for {` means the loop is infinite until we manually stop it
-	for {
-		select {
-		// stop looping if ctx is cancelled
-		case <-ctx.Done():
-			return
-		// receive update from channel and then handle it
-		case update := <-updates:
-			handleUpdate(update)
+// pollUntilDone passes on polled updates until ctx ends, then the ones already received,
+// and closes the channel it returns. It doesn't wait for the poll in progress: its
+// updates aren't confirmed to Telegram, which sends them again on the next start.
+func pollUntilDone(ctx context.Context, updates tgbotapi.UpdatesChannel) tgbotapi.UpdatesChannel {
+	out := make(chan tgbotapi.Update)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case update, ok := <-updates:
+				if !ok {
+					return
+				}
+				out <- update
+			case <-ctx.Done():
+				for {
+					select {
+					case update, ok := <-updates:
+						if !ok {
+							return
+						}
+						out <- update
+					default:
+						return
+					}
+				}
+			}
 		}
+	}()
+	return out
+}
+
+// receiveUpdates passes updates to the workers until the channel is closed, which
+// happens at shutdown once no more updates can arrive.
+func receiveUpdates(updates tgbotapi.UpdatesChannel, workers *dispatcher) {
+	for update := range updates {
+		workers.dispatch(update)
 	}
 }
 
-// handleUpdate processes incoming updates based on their type.
-func handleUpdate(update tgbotapi.Update) {
+// HandleUpdate processes incoming updates based on their type.
+func (b *Bot) HandleUpdate(ctx context.Context, update tgbotapi.Update) {
+	if user := update.SentFrom(); user != nil && !b.isAdmin(user.ID) {
+		blocked, err := b.store.IsBlocked(user.ID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error checking blocklist", "error", err)
+		}
+		if blocked {
+			return
+		}
+	}
+	ctx = b.withLanguage(ctx, update)
+
 	switch {
 	// Handle messages
 	case update.Message != nil:
-		handleMessage(update.Message)
+		b.handleMessage(ctx, update.Message)
 		break
 	// Handle button clicks
 	case update.CallbackQuery != nil:
-		handleButton(update.CallbackQuery)
+		b.handleButton(ctx, update.CallbackQuery)
 		break
 	}
 }
 
-func getUserData(chatID int64) (*database.UserData, error) {
-	userData, err := db.GetUser(chatID)
+func (b *Bot) getUserData(chatID int64) (*database.UserData, error) {
+	userData, err := b.store.GetUser(chatID)
 	if err != nil {
 		return nil, err
 	}
 	if userData == nil {
 		// User doesn't exist, create a new one
 		userData = &database.UserData{State: ""}
-		err = db.SaveUser(chatID, "", "", "", "", "", "")
+		err = b.store.SaveUser(chatID, userData)
 		if err != nil {
 			return nil, err
 		}
@@ -113,7 +281,7 @@ func getUserData(chatID int64) (*database.UserData, error) {
 }
 
 // handleMessage processes incoming messages.
-func handleMessage(message *tgbotapi.Message) {
+func (b *Bot) handleMessage(ctx context.Context, message *tgbotapi.Message) {
 	user := message.From
 	text := message.Text
 	chatID := message.Chat.ID
@@ -122,15 +290,14 @@ func handleMessage(message *tgbotapi.Message) {
 		return
 	}
 
-	// Print to console
-	log.Printf("%s wrote %s", user.FirstName, text)
+	slog.DebugContext(ctx, "Received message", "chat_id", chatID, "user_id", user.ID, "first_name", user.FirstName, "text", text)
 
 	var err error
 
-	userData, err := getUserData(chatID)
+	userData, err := b.getUserData(chatID)
 	if err != nil {
-		log.Printf("Error getting user data (handleMessage func): %v", err)
-		sendMessage(message.Chat.ID, "Sorry, an error occurred. Please try again.")
+		slog.ErrorContext(ctx, "Error getting user data (handleMessage func)", "error", err)
+		b.send(ctx, message.Chat.ID, errorMessage)
 		return
 	}
 
@@ -139,225 +306,610 @@ func handleMessage(message *tgbotapi.Message) {
 	}
 
 	if strings.HasPrefix(text, "/") {
-		handleCommand(message.Chat.ID, text)
+		command, args := text, ""
+		if message.IsCommand() {
+			// In groups commands can be addressed to the bot as /start@BotName
+			command = "/" + message.Command()
+			args = message.CommandArguments()
+		}
+		b.handleCommand(ctx, message.Chat.ID, user.ID, command, args)
 		return
 	}
-	log.Printf("User state: %s", userData.State)
-	switch userData.State {
-	case stateAwaitingPriceRange:
-		userData.PriceRange = text
-		userData.State = stateAwaitingBedrooms
-
-		// Ask for the number of bedrooms
-		sendMessageWithMarkup(message.Chat.ID, selectBedroomsMessage, selectBedrooms)
-	case stateAwaitingBedrooms:
-		userData.Bedrooms = text
-		userData.State = stateSelectingArea
-		sendMessage(message.Chat.ID, selectArea)
-	case stateSelectingArea:
-		userData.Area = text
-		searchProperties(message.Chat.ID, userData)
-	default:
-		sendMessage(message.Chat.ID, "I’m sorry, but I don’t recognize this command. Please type /help to see the available list of commands.")
+	if isGroupChat(chatID) && (userData.State == "" || userData.StateOwner != 0 && userData.StateOwner != user.ID) {
+		// Ignore group chatter, and answers from members who aren't answering the current step
+		return
 	}
-
-	if err != nil {
-		log.Printf("An error occured: %s", err.Error())
+	slog.DebugContext(ctx, "Advancing conversation", "chat_id", chatID, "state", userData.State)
+	in := fsm.Input{Text: text}
+	if message.Location != nil {
+		in.Location = &fsm.Location{Latitude: message.Location.Latitude, Longitude: message.Location.Longitude}
+	}
+	err = b.advance(ctx, chatID, user, userData, in)
+	if errors.Is(err, fsm.ErrUnexpectedInput) {
+		// Repeat the current question. When there isn't one, read the text as a search,
+		// or point to /help
+		if !b.repeatPrompt(ctx, chatID, userData) && !b.offerTypedSearch(ctx, chatID, userData, text) {
+			b.send(ctx, chatID, unknownCommandMessage)
+		}
+	} else if err != nil {
+		slog.ErrorContext(ctx, "Error handling update", "chat_id", chatID, "error", err)
 	}
 
-	err = db.SaveUser(message.Chat.ID, userData.State, userData.PropertyType, userData.PriceRange,
-		userData.Bedrooms, userData.Furnished, userData.Area)
+	if userData.State == "" {
+		userData.StateOwner = 0
+		userData.History = nil
+	}
+	err = b.store.SaveUser(message.Chat.ID, userData)
 	if err != nil {
-		log.Printf("Error saving user data: %v", err)
+		slog.ErrorContext(ctx, "Error saving user data", "error", err)
 	}
 }
 
-// handleCommand processes bot commands.
-func handleCommand(chatId int64, command string) error {
-	var err error
-
-	switch command {
-	case "/start":
-		userData, err := getUserData(chatId)
-		if err != nil {
-			log.Printf("Error getting user data: %v", err)
-			sendMessage(chatId, "Sorry, an error occurred. Please try again.")
-			return err
-		}
-		if userData == nil {
-			userData = &database.UserData{State: ""}
-			err = db.SaveUser(chatId, userData.State, "", "", "", "", "")
-			if err != nil {
-				log.Printf("Error saving new user: %v", err)
-				sendMessage(chatId, "Sorry, an error occurred. Please try again.")
-				return err
-			}
-		}
-		userData.State = ""
-		err = db.SaveUser(chatId, userData.State, userData.PropertyType, userData.PriceRange,
-			userData.Bedrooms, userData.Furnished, userData.Area)
+// start handles /start by leaving any flow and offering to set up a new search.
+func (b *Bot) start(ctx context.Context, chatID int64) error {
+	userData, err := b.getUserData(chatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user data", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+	if userData == nil {
+		userData = &database.UserData{State: ""}
+		err = b.store.SaveUser(chatID, userData)
 		if err != nil {
-			log.Printf("Error updating user state: %v", err)
-			sendMessage(chatId, "Sorry, an error occurred. Please try again.")
+			slog.ErrorContext(ctx, "Error saving new user", "error", err)
+			b.send(ctx, chatID, errorMessage)
 			return err
 		}
-		msg := tgbotapi.NewMessage(chatId, welcomeMessage)
-		msg.ReplyMarkup = goButton
-		_, err = bot.Send(msg)
-	case "/help":
-		msg := tgbotapi.NewMessage(chatId, "Hello! I’m here to assist you in finding your perfect home.")
-		_, err = bot.Send(msg)
-	// ADD MENU OPTION LATER
-	case "/preferences":
-		err = showUserPreferences(chatId)
-	default:
-		sendMessage(chatId, "I’m sorry, but I don’t recognize this command. Please type /help to see the available list of commands.")
 	}
-
-	return err
-}
-
-func showUserPreferences(chatId int64) error {
-	userData, err := getUserData(chatId)
+	userData.State = ""
+	userData.StateOwner = 0
+	userData.Editing = ""
+	userData.History = nil
+	// Starting over forgets a typed search waiting for confirmation
+	b.dropPendingQuery(chatID)
+	err = b.store.SaveUser(chatID, userData)
 	if err != nil {
-		log.Printf("Error getting user data: %v", err)
-		sendMessage(chatId, "Sorry, an error occurred while retrieving your preferences. Please try again.")
+		slog.ErrorContext(ctx, "Error updating user state", "error", err)
+		b.send(ctx, chatID, errorMessage)
 		return err
 	}
-
-	if userData == nil || (userData.PropertyType == "" && userData.PriceRange == "" && userData.Bedrooms == "" && userData.Furnished == "" && userData.Area == "") {
-		sendMessage(chatId, "You don't have any saved preferences yet. Start a new search to set your preferences!")
-		return nil
+	c := b.catalogue(ctx)
+	text := c.Text(welcomeMessage)
+	if !b.providerAvailable() {
+		text += "\n\n" + c.Text(searchesDegradedNotice)
 	}
+	return b.messenger.Send(OutgoingMessage{ChatID: chatID, Text: text, Buttons: goButton(c)})
+}
 
-	preferencesMsg := "Your saved preferences:\n\n"
+// describePreferences lists the search preferences that have been set, one per line, in
+// the language of c.
+func describePreferences(c *i18n.Catalogue, userData *database.UserData) string {
+	preferencesMsg := ""
 	if userData.PropertyType != "" {
-		preferencesMsg += fmt.Sprintf("Property Type: %s\n", userData.PropertyType)
+		preferencesMsg += c.Text(propertyTypePreference, optionLabel(c, propertyOptions, userData.PropertyType)) + "\n"
 	}
 	if userData.PriceRange != "" {
-		preferencesMsg += fmt.Sprintf("Price Range: %s\n", userData.PriceRange)
+		preferencesMsg += c.Text(priceRangePreference, userData.PriceRange) + "\n"
 	}
 	if userData.Bedrooms != "" {
-		preferencesMsg += fmt.Sprintf("Bedrooms: %s\n", userData.Bedrooms)
+		bedrooms := optionLabel(c, bedroomOptions, userData.Bedrooms)
+		if minBedrooms, err := bedroomCount(userData.Bedrooms); err == nil && userData.MaxBedrooms > minBedrooms {
+			bedrooms += "–" + strconv.Itoa(userData.MaxBedrooms)
+		}
+		preferencesMsg += c.Text(bedroomsPreference, bedrooms) + "\n"
 	}
 	if userData.Furnished != "" {
-		preferencesMsg += fmt.Sprintf("Furnished: %s\n", userData.Furnished)
+		preferencesMsg += c.Text(furnishedPreference, optionLabel(c, furnishedOptions, userData.Furnished)) + "\n"
+	}
+	if userData.Pets != "" {
+		preferencesMsg += c.Text(petsPreference, optionLabel(c, petOptions, userData.Pets)) + "\n"
+	}
+	if userData.QuietOnly {
+		preferencesMsg += c.Text(quietOnlyPreference) + "\n"
 	}
 	if userData.Area != "" {
-		preferencesMsg += fmt.Sprintf("Area: %s\n", userData.Area)
+		preferencesMsg += c.Text(areaPreference, userData.Area) + "\n"
+	}
+	if userData.RadiusMiles > 0 {
+		preferencesMsg += c.Text(radiusPreference, formatDistance(c, userData.RadiusMiles)) + "\n"
+	}
+	if userData.MaxCommuteMinutes > 0 {
+		preferencesMsg += c.Text(commutePreference, userData.MaxCommuteMinutes, userData.CommuteDestination) + "\n"
+	}
+	if len(userData.Keywords) > 0 {
+		preferencesMsg += c.Text(keywordsPreference, keywordLabels(c, userData.Keywords)) + "\n"
+	}
+	if order := sortOrder(userData); order != defaultSortOrder(userData) {
+		preferencesMsg += c.Text(sortPreference, optionLabel(c, sortOptions, order)) + "\n"
 	}
 
-	sendMessage(chatId, preferencesMsg)
-	return nil
+	return preferencesMsg
 }
 
 // handleButton proceses callback queries from inline buttons.
-func handleButton(query *tgbotapi.CallbackQuery) {
-	userData, err := getUserData(query.Message.Chat.ID)
+func (b *Bot) handleButton(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	userData, err := b.getUserData(query.Message.Chat.ID)
 	if err != nil {
-		log.Printf("Error getting user data (handleMessage func): %v", err)
-		sendMessage(query.Message.Chat.ID, "Sorry, an error occurred. Please try again.")
+		slog.ErrorContext(ctx, "Error getting user data (handleMessage func)", "error", err)
+		b.send(ctx, query.Message.Chat.ID, errorMessage)
+		return
+	}
+	if strings.HasPrefix(query.Data, voteCallbackPrefix) {
+		b.handleVote(ctx, query, strings.TrimPrefix(query.Data, voteCallbackPrefix))
 		return
 	}
-	switch query.Data {
-	case goButtonText:
-		sendMessageWithMarkup(query.Message.Chat.ID, selectPropertyMessage, selectProperty)
-	case flatButtonText, houseButtonText:
-		userData.PropertyType = query.Data
-		userData.State = stateAwaitingPriceRange
-		sendMessage(query.Message.Chat.ID, priceRangeMessage)
-	case studioButtonText, oneBedButtonText, twoBedButtonText, threeBedButtonText, fourBedButtonText, fiveBedButtonText:
-		userData.Bedrooms = query.Data
-		userData.State = stateFurnishedUnfurnished
-		sendMessageWithMarkup(query.Message.Chat.ID, selectIsFurnished, isFurnished)
-	case furnished, unfurnished:
-		userData.Furnished = query.Data
-		userData.State = stateSelectingArea
-		sendMessage(query.Message.Chat.ID, selectArea)
-	}
-
-	err = db.SaveUser(query.Message.Chat.ID, userData.State, userData.PropertyType, userData.PriceRange,
-		userData.Bedrooms, userData.Furnished, userData.Area)
+	if strings.HasPrefix(query.Data, adminCallbackPrefix) {
+		b.handleAdminButton(ctx, query)
+		return
+	}
+	if isRoommateDecision(query.Data) {
+		b.handleRoommateDecision(ctx, query.Message.Chat.ID, query.Data)
+		b.answerCallback(ctx, query.ID, "")
+		return
+	}
+	if isGroupChat(query.Message.Chat.ID) {
+		if userData.State != "" && userData.StateOwner != 0 && userData.StateOwner != query.From.ID {
+			b.answerCallback(ctx, query.ID, stepTakenMessage)
+			return
+		}
+		userData.StateOwner = query.From.ID
+	}
+
+	answer := ""
+	switch {
+	case strings.HasPrefix(query.Data, navigationCallbackPrefix):
+		answer = b.handleNavigationButton(ctx, query, userData)
+	case strings.HasPrefix(query.Data, preferencesCallbackPrefix):
+		answer = b.handlePreferenceButton(ctx, query, userData)
+	case strings.HasPrefix(query.Data, queryCallbackPrefix):
+		answer = b.handleQueryButton(ctx, query, userData)
+	case strings.HasPrefix(query.Data, sortCallbackPrefix):
+		answer = b.handleSortButton(ctx, query, userData)
+	case strings.HasPrefix(query.Data, alertsCallbackPrefix):
+		answer = b.handleAlertsButton(ctx, query, userData)
+	case strings.HasPrefix(query.Data, languageCallbackPrefix):
+		answer = b.handleLanguageButton(ctx, query, userData)
+	default:
+		err = b.advance(ctx, query.Message.Chat.ID, query.From, userData, fsm.Input{Data: query.Data})
+	}
+	if errors.Is(err, fsm.ErrUnexpectedInput) {
+		// The button belongs to an earlier or unrelated question
+		answer = staleButtonMessage
+	} else if err != nil {
+		slog.ErrorContext(ctx, "Error handling update", "chat_id", query.Message.Chat.ID, "error", err)
+	}
+
+	if userData.State == "" {
+		userData.StateOwner = 0
+		userData.History = nil
+	}
+	err = b.store.SaveUser(query.Message.Chat.ID, userData)
 	if err != nil {
-		log.Printf("Error saving user data: %v", err)
+		slog.ErrorContext(ctx, "Error saving user data", "error", err)
 	}
 
-	bot.Send(tgbotapi.NewCallback(query.ID, ""))
+	// A question's buttons work once, and stale ones are removed too. The preferences menu
+	// stays usable for searching again.
+	if answer != finishCurrentStepMessage && query.Data != preferencesCallbackPrefix+preferencesSearchAction {
+		b.clearButtons(ctx, query.Message)
+	}
+	b.answerCallback(ctx, query.ID, answer)
 }
 
-func searchProperties(chatID int64, userData *database.UserData) {
-	if zooplaClient == nil {
-		log.Println("Error: zooplaClient is nil")
-		sendMessage(chatID, "Sorry, I encountered an error while searching for properties. Please try again later.")
-		return
+// advance applies an answer to the flow the conversation is in, then shows any notice
+// and the next question. Invalid answers are explained to the user and keep the current
+// state. It returns fsm.ErrUnexpectedInput when the answer doesn't fit the current step.
+func (b *Bot) advance(ctx context.Context, chatID int64, from *tgbotapi.User, userData *database.UserData, in fsm.Input) error {
+	state := fsm.State(userData.State)
+	if !b.searchFlow(ctx).Has(state) && !b.roommateFlow(ctx).Has(state) {
+		slog.WarnContext(ctx, "Resetting unknown state", "chat_id", chatID, "state", state)
+		userData.State = string(fsm.Idle)
 	}
 
-	minPrice, maxPrice, err := parsePriceRange(userData.PriceRange)
-	if err != nil {
-		sendMessage(chatID, "I'm sorry, I couldn't understand the price range. Please try again.")
-		return
+	var err error
+	editing := false
+	if userData.Editing != "" {
+		editing, err = b.editPreference(ctx, chatID, userData, in)
+	}
+	switch {
+	case editing:
+	case b.inRoommateFlow(ctx, state):
+		err = b.advanceRoommate(ctx, chatID, from, userData, in)
+	default:
+		if state == fsm.Idle && in.Data == goCallbackData {
+			// Answering the questions replaces a typed search waiting for confirmation
+			b.dropPendingQuery(chatID)
+		}
+		var outcome fsm.Outcome
+		outcome, err = step(ctx, b, chatID, b.searchFlow(ctx), userData, userData, in)
+		if err == nil && outcome.Next == stateSearching {
+			if b.runSearch(ctx, chatID, from.ID, userData) {
+				userData.State = string(fsm.Idle)
+			} else {
+				// Return to the last question so the user can run the search later
+				previous, _ := popHistory(userData)
+				userData.State = string(previous)
+			}
+		}
+	}
+
+	var rejection *fsm.Rejection
+	if errors.As(err, &rejection) {
+		b.sendFlowPrompt(ctx, chatID, withNavigation(b.catalogue(ctx), chatID, fsm.State(userData.State), rejection.Prompt))
+		return nil
 	}
-	bedrooms, err := strconv.Atoi(userData.Bedrooms)
+	return err
+}
+
+// runSearch searches with the user's preferences, unless the provider is down or userID
+// has run out of searches. It reports whether the search ran.
+func (b *Bot) runSearch(ctx context.Context, chatID, userID int64, userData *database.UserData) bool {
+	if !b.providerAvailable() {
+		// The user is told when searches work again
+		b.send(ctx, chatID, providerUnavailableMessage)
+		b.awaitProvider(chatID)
+		return false
+	}
+	if allowed, wait := b.searchQuota.Allow(userID, time.Now()); !allowed {
+		seconds := int(math.Ceil(wait.Seconds()))
+		b.sendMessage(ctx, chatID, b.catalogue(ctx).Plural(searchRateLimitedMessage, seconds, seconds))
+		return false
+	}
+	b.searchProperties(ctx, chatID, userData)
+	return true
+}
+
+// step runs one transition of a flow and stores the new state in userData.
+func step[T any](ctx context.Context, b *Bot, chatID int64, flow *fsm.Machine[T], userData *database.UserData, data T, in fsm.Input) (fsm.Outcome, error) {
+	outcome, err := flow.Handle(fsm.State(userData.State), data, in)
 	if err != nil {
-		sendMessage(chatID, "I'm sorry, I couldn't understand the number of bedrooms. Please try again.")
+		return outcome, err
+	}
+	pushHistory(userData, outcome.Next)
+	userData.State = string(outcome.Next)
+	if outcome.Notice != "" {
+		b.sendMessage(ctx, chatID, outcome.Notice)
+	}
+	promptFor(ctx, b, chatID, flow, outcome.Next, data)
+	return outcome, nil
+}
+
+// promptFor asks the question of the given state with the navigation buttons. It
+// reports false if the state has no question.
+func promptFor[T any](ctx context.Context, b *Bot, chatID int64, flow *fsm.Machine[T], state fsm.State, data T) bool {
+	prompt, ok := flow.Prompt(state, data)
+	if ok {
+		b.sendFlowPrompt(ctx, chatID, withNavigation(b.catalogue(ctx), chatID, state, prompt))
+	}
+	return ok
+}
+
+// repeatPrompt asks the current question again. It returns false when the conversation
+// isn't waiting for an answer.
+func (b *Bot) repeatPrompt(ctx context.Context, chatID int64, userData *database.UserData) bool {
+	state := fsm.State(userData.State)
+	if !b.inRoommateFlow(ctx, state) {
+		return promptFor(ctx, b, chatID, b.searchFlow(ctx), state, userData)
+	}
+	profile, err := b.store.GetRoommateProfile(chatID)
+	if err != nil || profile == nil {
+		slog.ErrorContext(ctx, "Error getting roommate profile", "error", err)
+		return false
+	}
+	promptFor(ctx, b, chatID, b.roommateFlow(ctx), state, profile)
+	return true
+}
+
+// sendFlowPrompt sends a question with its buttons, or as a free text prompt when it has none.
+func (b *Bot) sendFlowPrompt(ctx context.Context, chatID int64, prompt fsm.Prompt) {
+	if len(prompt.Buttons) > 0 {
+		b.sendMessageWithMarkup(ctx, chatID, prompt.Text, prompt.Buttons)
 		return
 	}
-	properties, err := zooplaClient.SearchProperties(userData.Area, minPrice, maxPrice, bedrooms, userData.PropertyType)
+	b.sendPrompt(ctx, chatID, prompt.Text)
+}
+
+// startCommuteSetup asks the user where they commute to. In group chats, ownerID is the
+// member who answers.
+func (b *Bot) startCommuteSetup(ctx context.Context, chatID, ownerID int64) error {
+	userData, err := b.getUserData(chatID)
 	if err != nil {
-		log.Printf("Error searching properties: %v", err)
-		sendMessage(chatID, "Sorry, I encountered an error while searching for properties. Please try again later.")
+		slog.ErrorContext(ctx, "Error getting user data", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+	userData.State = string(stateAwaitingCommuteDestination)
+	userData.StateOwner = ownerID
+	userData.Editing = ""
+	userData.History = nil
+	if err = b.store.SaveUser(chatID, userData); err != nil {
+		slog.ErrorContext(ctx, "Error updating user state", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+	promptFor(ctx, b, chatID, b.searchFlow(ctx), stateAwaitingCommuteDestination, userData)
+	return nil
+}
+
+// maxResults is the number of listings a search sends, from the top of the ranking.
+const maxResults = 5
+
+// searchProperties runs the search described by the user's preferences and sends the
+// top results in the order the user chose with /sort. Every result is recorded as shown,
+// so only listings that appear later are alerted.
+func (b *Bot) searchProperties(ctx context.Context, chatID int64, userData *database.UserData) {
+	results, failure := b.findListings(ctx, userData)
+	if failure != "" {
+		b.send(ctx, chatID, failure)
 		return
 	}
-	if len(properties) == 0 {
-		sendMessage(chatID, "I'm sorry, but I couldn't find any properties matching your criteria. Please try broadening your search.")
+	if len(results) == 0 {
+		b.send(ctx, chatID, noResultsMessage)
 		return
 	}
 
-	sendMessage(chatID, fmt.Sprintf("Great! I found %d properties matching your criteria. Here are the top results:", len(properties)))
+	c := b.catalogue(ctx)
+	b.sendMessage(ctx, chatID, c.Plural(resultsFoundMessage, len(results), len(results)))
 
-	for i, property := range properties {
-		if i >= 5 {
+	pet := petType(userData.Pets)
+	for i, result := range results {
+		if i >= maxResults {
 			break
 		}
-		propertyMsg := fmt.Sprintf("🏠 %s\n 💰 £%d\n 🛏 %d bedrooms", property.Address, property.Price, property.Bedrooms)
-		sendMessage(chatID, propertyMsg)
+		property := result.Property
+		propertyMsg := c.Plural(listingMessage, property.Bedrooms, property.Address, property.Price, property.Bedrooms)
+		propertyMsg += "\n " + c.Text(listingScoreMessage, result.Score)
+		if result.Miles >= 0 && (userData.RadiusMiles > 0 || sortOrder(userData) == ranking.Nearest) {
+			propertyMsg += "\n " + c.Text(listingDistanceMessage, formatDistance(c, result.Miles))
+		}
+		if !result.Listed.IsZero() {
+			propertyMsg += "\n " + c.Text(listingListedMessage, result.Listed.Format(c.Text(dateLayout)))
+		}
+		if pet != "" {
+			propertyMsg += "\n " + c.Text(listingPetsMessage, petsLabel(c, property.Pets))
+		}
+		if property.Latitude != 0 || property.Longitude != 0 {
+			if score, ok := b.noise.Score(property.Latitude, property.Longitude); ok {
+				propertyMsg += "\n " + noiseBadge(c, score)
+			}
+		}
+		if result.Minutes >= 0 {
+			propertyMsg += "\n " + c.Text(listingCommuteMessage, result.Minutes, userData.CommuteDestination)
+		}
+		if isGroupChat(chatID) {
+			b.sendShortlistedProperty(ctx, chatID, property, propertyMsg)
+		} else {
+			b.sendMessage(ctx, chatID, propertyMsg)
+		}
+		b.listingsSent.Add(1)
+		metrics.SearchResultsSent.Inc()
+	}
+	if !isGroupChat(chatID) {
+		if err := b.store.RecordShown(chatID, notifications(results), time.Now()); err != nil {
+			slog.ErrorContext(ctx, "Error recording shown listings", "error", err)
+		}
 	}
-	sendMessage(chatID, "To start a new search, just type /start")
-	userData.State = "" // Reset state after completing the search
+	b.send(ctx, chatID, newSearchMessage)
 }
 
-func parsePriceRange(priceRange string) (int, int, error) {
-	parts := strings.Split(priceRange, "-")
-	if len(parts) != 2 {
-		return 0, 0, fmt.Errorf("invalid price range format")
+// findListings runs the search described by the user's preferences, applies the filters
+// providers don't, and ranks the results in the order the user chose with /sort. When the
+// commute filter is on, results carry their commute time. If the search can't be run,
+// failure is the message key explaining why.
+func (b *Bot) findListings(ctx context.Context, userData *database.UserData) (results []ranking.Result, failure string) {
+	if b.provider == nil {
+		slog.ErrorContext(ctx, "Provider is nil")
+		return nil, searchErrorMessage
 	}
 
-	minPrice, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	minPrice, maxPrice, err := query.ParsePriceRange(userData.PriceRange)
 	if err != nil {
-		return 0, 0, err
+		return nil, savedPriceRangeErrorMessage
 	}
-
-	maxPrice, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	bedrooms, err := bedroomCount(userData.Bedrooms)
+	if err != nil {
+		return nil, savedBedroomsErrorMessage
+	}
+	pet := petType(userData.Pets)
+	var properties []real_estate_api.Property
+	start := time.Now()
+	if petFilterer, ok := b.provider.(real_estate_api.PetFilterer); ok && pet != "" {
+		properties, err = petFilterer.SearchPropertiesWithPets(ctx, userData.Area, minPrice, maxPrice, bedrooms, userData.PropertyType, pet)
+	} else {
+		properties, err = b.provider.SearchProperties(ctx, userData.Area, minPrice, maxPrice, bedrooms, userData.PropertyType)
+	}
+	b.providerStats.record(time.Since(start), err)
+	metrics.ObserveProviderRequest("search", time.Since(start), err)
 	if err != nil {
-		return 0, 0, err
+		slog.ErrorContext(ctx, "Error searching properties", "error", err)
+		return nil, searchErrorMessage
+	}
+	if userData.MaxBedrooms > 0 {
+		properties = filterByBedrooms(properties, userData.MaxBedrooms)
+	}
+	if pet != "" {
+		properties = filterByPets(properties, pet)
+	}
+	if userData.RadiusMiles > 0 {
+		properties = filterByRadius(properties, userData.Latitude, userData.Longitude, userData.RadiusMiles)
+	}
+	if userData.QuietOnly {
+		properties = b.filterQuiet(properties)
+	}
+	search := rankingSearch(userData, minPrice, maxPrice)
+	if userData.MaxCommuteMinutes > 0 {
+		destination := b.network.To(userData.CommuteLatitude, userData.CommuteLongitude)
+		properties = filterByCommute(properties, destination, userData.MaxCommuteMinutes)
+		search.Commute = destination.Minutes
 	}
+	return ranking.Rank(properties, search, sortOrder(userData), time.Now()), ""
+}
+
+// petType maps the pets answer to the pet type passed to providers, or "" if the user has no pets.
+func petType(answer string) string {
+	switch answer {
+	case petsCat:
+		return "cat"
+	case petsDog:
+		return "dog"
+	case petsOther:
+		return "other"
+	}
+	return ""
+}
+
+// filterByBedrooms drops listings with more than maxBedrooms bedrooms. Providers only
+// take the minimum.
+func filterByBedrooms(properties []real_estate_api.Property, maxBedrooms int) []real_estate_api.Property {
+	var filtered []real_estate_api.Property
+	for _, property := range properties {
+		if property.Bedrooms <= maxBedrooms {
+			filtered = append(filtered, property)
+		}
+	}
+	return filtered
+}
+
+// filterByPets drops listings that refuse pets. Listings whose policy isn't known from the
+// provider are classified from their description, and kept if it is still unknown.
+func filterByPets(properties []real_estate_api.Property, pet string) []real_estate_api.Property {
+	var filtered []real_estate_api.Property
+	for _, property := range properties {
+		if property.Pets == "" {
+			property.Pets = real_estate_api.ClassifyPets(property.Description, pet)
+		}
+		if property.Pets != real_estate_api.PetsNotAllowed {
+			filtered = append(filtered, property)
+		}
+	}
+	return filtered
+}
 
-	return minPrice, maxPrice, nil
+// filterByRadius keeps the listings within radiusMiles of the given point. Listings
+// without coordinates can't be placed and are dropped.
+func filterByRadius(properties []real_estate_api.Property, lat, lon, radiusMiles float64) []real_estate_api.Property {
+	var filtered []real_estate_api.Property
+	for _, property := range properties {
+		if property.Latitude == 0 && property.Longitude == 0 {
+			continue
+		}
+		if geo.DistanceMiles(lat, lon, property.Latitude, property.Longitude) <= radiusMiles {
+			filtered = append(filtered, property)
+		}
+	}
+	return filtered
+}
+
+// filterQuiet keeps the listings with a noise score of at most noise.QuietScore.
+// Listings without coordinates can't be scored and are dropped. Listings outside the
+// noise data's coverage are kept: their score is unknown, so it can't rule them out.
+func (b *Bot) filterQuiet(properties []real_estate_api.Property) []real_estate_api.Property {
+	var filtered []real_estate_api.Property
+	for _, property := range properties {
+		if property.Latitude == 0 && property.Longitude == 0 {
+			continue
+		}
+		if score, ok := b.noise.Score(property.Latitude, property.Longitude); !ok || score <= noise.QuietScore {
+			filtered = append(filtered, property)
+		}
+	}
+	return filtered
+}
+
+// petsLabel translates a listing's pet policy.
+func petsLabel(c *i18n.Catalogue, pets real_estate_api.PetPolicy) string {
+	switch pets {
+	case real_estate_api.PetsAllowed:
+		return c.Text(petsAllowedLabel)
+	case real_estate_api.PetsNotAllowed:
+		return c.Text(petsNotAllowedLabel)
+	}
+	return c.Text(petsUnknownLabel)
 }
 
-// sendMessageWithMarkup edits a message with new text and markup/
-func sendMessageWithMarkup(chatID int64, text string, markup tgbotapi.InlineKeyboardMarkup) {
-	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ReplyMarkup = markup
-	if _, err := bot.Send(msg); err != nil {
-		log.Printf("Failed to send message with new text and markup: %v", err)
+// noiseBadge renders a noise score as a short label, e.g. "🔉 noise 3/5".
+func noiseBadge(c *i18n.Catalogue, score int) string {
+	icon := "🔈"
+	switch {
+	case score > 3:
+		icon = "🔊"
+	case score > noise.QuietScore:
+		icon = "🔉"
+	}
+	return c.Text(listingNoiseMessage, icon, score, noise.MaxScore)
+}
+
+// filterByCommute keeps the listings within maxMinutes of the destination.
+// Listings without coordinates, or too far from any station, are dropped.
+func filterByCommute(properties []real_estate_api.Property, destination *commute.Destination, maxMinutes int) []real_estate_api.Property {
+	var filtered []real_estate_api.Property
+	for _, property := range properties {
+		if property.Latitude == 0 && property.Longitude == 0 {
+			continue
+		}
+		if minutes, ok := destination.Minutes(property.Latitude, property.Longitude); ok && minutes <= maxMinutes {
+			filtered = append(filtered, property)
+		}
+	}
+	return filtered
+}
+
+// formatMiles formats a distance with one decimal place, dropping a trailing ".0".
+func formatMiles(miles float64) string {
+	return strings.TrimSuffix(strconv.FormatFloat(miles, 'f', 1, 64), ".0")
+}
+
+// formatDistance formats a distance with its unit in the language of c, e.g. "1 mile"
+// or "0.5 miles".
+func formatDistance(c *i18n.Catalogue, miles float64) string {
+	text := formatMiles(miles)
+	if whole, err := strconv.Atoi(text); err == nil {
+		return c.Plural(milesMessage, whole, whole)
+	}
+	return c.Text(fractionalMilesMessage, text)
+}
+
+// deliver sends msg and waits until it has been delivered, for background work that acts
+// on the outcome. Messengers that queue messages, such as ThrottledMessenger, return from
+// Send before the message is delivered.
+func (b *Bot) deliver(msg OutgoingMessage) error {
+	if queued, ok := b.messenger.(interface{ Deliver(OutgoingMessage) error }); ok {
+		return queued.Deliver(msg)
+	}
+	return b.messenger.Send(msg)
+}
+
+// sendMessageWithMarkup sends a message with inline buttons.
+func (b *Bot) sendMessageWithMarkup(ctx context.Context, chatID int64, text string, buttons [][]fsm.Button) {
+	if err := b.messenger.Send(OutgoingMessage{ChatID: chatID, Text: text, Buttons: buttons}); err != nil {
+		slog.ErrorContext(ctx, "Failed to send message with new text and markup", "error", err)
+	}
+}
+
+// sendPrompt sends a question answered with free text. Bots in groups only see replies
+// to their own messages, so in groups the prompt forces a reply.
+func (b *Bot) sendPrompt(ctx context.Context, chatID int64, text string) {
+	if err := b.messenger.Send(OutgoingMessage{ChatID: chatID, Text: text, ForceReply: isGroupChat(chatID)}); err != nil {
+		slog.ErrorContext(ctx, "Failed to send prompt", "error", err)
 	}
 }
 
 // sendMessage sends a message with new text
-func sendMessage(chatID int64, text string) {
-	msg := tgbotapi.NewMessage(chatID, text)
-	if _, err := bot.Send(msg); err != nil {
-		log.Printf("Failed to send message with new text and markup: %v", err)
+func (b *Bot) sendMessage(ctx context.Context, chatID int64, text string) {
+	if err := b.messenger.Send(OutgoingMessage{ChatID: chatID, Text: text}); err != nil {
+		slog.ErrorContext(ctx, "Failed to send message with new text and markup", "error", err)
+	}
+}
+
+// answerCallback acknowledges a button press so the client stops showing a spinner,
+// showing the message with the given key if it isn't empty.
+func (b *Bot) answerCallback(ctx context.Context, callbackID, key string) {
+	text := ""
+	if key != "" {
+		text = b.text(ctx, key)
+	}
+	if err := b.messenger.AnswerCallback(callbackID, text); err != nil {
+		slog.ErrorContext(ctx, "Failed to answer callback", "error", err)
 	}
 }
@@ -0,0 +1,220 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log/slog"
+	"rent_seekerbot/internal/database"
+	"rent_seekerbot/internal/fsm"
+	"rent_seekerbot/internal/query"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// draftEditingPrefix marks userData.Editing when the preference being edited belongs to
+// the pending typed search rather than the saved one.
+const draftEditingPrefix = "draft:"
+
+// pendingQueryTTL is how long a typed search waits on its confirmation card.
+const pendingQueryTTL = time.Hour
+
+// pendingQuery is a typed search waiting for confirmation.
+type pendingQuery struct {
+	draft   *database.UserData
+	expires time.Time
+}
+
+// The answers the search questions store for what the query parser reads.
+var (
+	queryPropertyTypes = map[string]string{query.PropertyFlat: propertyFlat, query.PropertyHouse: propertyHouse}
+	queryFurnishing    = map[string]string{query.Furnished: furnishedAnswer, query.Unfurnished: unfurnishedAnswer}
+	queryPets          = map[string]string{query.PetsNone: petsNone, query.PetsCat: petsCat, query.PetsDog: petsDog, query.PetsOther: petsOther}
+)
+
+// startTypedSearch handles /search <text>, e.g. /search 2 bed flat in Hackney under 2k.
+func (b *Bot) startTypedSearch(ctx context.Context, chatID int64, text string) error {
+	if strings.TrimSpace(text) == "" {
+		b.send(ctx, chatID, queryUsageMessage)
+		return nil
+	}
+	userData, err := b.getUserData(chatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user data", "error", err)
+		b.send(ctx, chatID, errorMessage)
+		return err
+	}
+	if !b.offerTypedSearch(ctx, chatID, userData, text) {
+		b.send(ctx, chatID, queryNotUnderstoodMessage)
+	}
+	return nil
+}
+
+// offerTypedSearch reads a search from text and shows it on a confirmation card, where
+// it can be corrected before it replaces the saved search. It reports false if nothing
+// in text describes a search.
+func (b *Bot) offerTypedSearch(ctx context.Context, chatID int64, userData *database.UserData, text string) bool {
+	q := b.queryParser.Parse(text)
+	if q.Empty() {
+		return false
+	}
+	draft := draftFromQuery(userData, q)
+	b.keepPendingQuery(chatID, draft, time.Now())
+
+	c := b.catalogue(ctx)
+	var notes []string
+	switch {
+	case q.Area != nil && !q.AreaExact:
+		notes = append(notes, c.Text(areaCorrectedMessage, q.Area.Name))
+	case q.Area == nil && len(q.AreaSuggestions) > 0:
+		var labels []string
+		for _, place := range q.AreaSuggestions {
+			labels = append(labels, placeLabel(c, place))
+		}
+		notes = append(notes, c.Text(queryAreaSuggestionsMessage, q.AreaText, strings.Join(labels, ", ")))
+	}
+	b.sendQueryCard(ctx, chatID, draft, notes)
+	return true
+}
+
+// draftFromQuery turns a typed search into the answers the search questions would have
+// stored. Settings the parser doesn't read, such as the commute, are kept from userData.
+func draftFromQuery(userData *database.UserData, q query.Query) *database.UserData {
+	draft := &database.UserData{
+		PropertyType:       queryPropertyTypes[q.PropertyType],
+		Furnished:          queryFurnishing[q.Furnished],
+		Pets:               queryPets[q.Pets],
+		Keywords:           q.Keywords,
+		QuietOnly:          userData.QuietOnly,
+		CommuteDestination: userData.CommuteDestination,
+		CommuteLatitude:    userData.CommuteLatitude,
+		CommuteLongitude:   userData.CommuteLongitude,
+		MaxCommuteMinutes:  userData.MaxCommuteMinutes,
+	}
+	if q.Studio {
+		draft.Bedrooms = bedroomsStudio
+	} else if q.MinBedrooms > 0 {
+		draft.Bedrooms = strconv.Itoa(q.MinBedrooms)
+		if q.MaxBedrooms > q.MinBedrooms {
+			draft.MaxBedrooms = q.MaxBedrooms
+		}
+	}
+	if q.MaxPrice > 0 {
+		draft.PriceRange = fmt.Sprintf("%d - %d", q.MinPrice, q.MaxPrice)
+	}
+	if q.Area != nil {
+		draft.Area, draft.Latitude, draft.Longitude = q.Area.Name, q.Area.Latitude, q.Area.Longitude
+	}
+	return draft
+}
+
+// sendQueryCard shows a typed search with the buttons to correct, save or drop it, after
+// the notes about how it was read.
+func (b *Bot) sendQueryCard(ctx context.Context, chatID int64, draft *database.UserData, notes []string) {
+	c := b.catalogue(ctx)
+	text := c.Text(queryCardHeader) + "\n\n" + describePreferences(c, draft)
+	if missing := missingPreferences(c, draft); len(missing) > 0 {
+		text += "\n" + c.Text(queryMissingMessage, strings.Join(missing, ", ")) + "\n"
+	}
+	text += "\n" + c.Text(queryCardFooter)
+	if len(notes) > 0 {
+		text = strings.Join(notes, "\n") + "\n\n" + text
+	}
+	b.sendMessageWithMarkup(ctx, chatID, text, queryCard(c))
+}
+
+// keepPendingQuery keeps a typed search until it is confirmed, replacing the chat's
+// earlier one. Searches that have expired in other chats are forgotten at the same time.
+func (b *Bot) keepPendingQuery(chatID int64, draft *database.UserData, now time.Time) {
+	b.queryMu.Lock()
+	defer b.queryMu.Unlock()
+	for id, pending := range b.pendingQueries {
+		if !now.Before(pending.expires) {
+			delete(b.pendingQueries, id)
+		}
+	}
+	b.pendingQueries[chatID] = pendingQuery{draft: draft, expires: now.Add(pendingQueryTTL)}
+}
+
+// pendingQuery returns the typed search waiting for confirmation in the chat, if any
+// that hasn't expired.
+func (b *Bot) pendingQuery(chatID int64) (*database.UserData, bool) {
+	b.queryMu.Lock()
+	defer b.queryMu.Unlock()
+	pending, ok := b.pendingQueries[chatID]
+	if ok && !time.Now().Before(pending.expires) {
+		delete(b.pendingQueries, chatID)
+		return nil, false
+	}
+	return pending.draft, ok
+}
+
+// dropPendingQuery forgets the typed search waiting for confirmation in the chat.
+func (b *Bot) dropPendingQuery(chatID int64) {
+	b.queryMu.Lock()
+	delete(b.pendingQueries, chatID)
+	b.queryMu.Unlock()
+}
+
+// handleQueryButton handles the buttons of the confirmation card. It returns the text to
+// answer the callback with.
+func (b *Bot) handleQueryButton(ctx context.Context, query *tgbotapi.CallbackQuery, userData *database.UserData) string {
+	chatID := query.Message.Chat.ID
+	action := strings.TrimPrefix(query.Data, queryCallbackPrefix)
+	draft, ok := b.pendingQuery(chatID)
+	if !ok {
+		return staleButtonMessage
+	}
+	if action == queryCancelAction {
+		b.dropPendingQuery(chatID)
+		b.send(ctx, chatID, queryCancelledMessage)
+		return ""
+	}
+	if userData.State != string(fsm.Idle) && userData.Editing == "" {
+		// A card from an earlier message shouldn't abandon the questions being answered
+		return finishCurrentStepMessage
+	}
+
+	if action == querySaveAction {
+		c := b.catalogue(ctx)
+		if missing := missingPreferences(c, draft); len(missing) > 0 {
+			b.send(ctx, chatID, preferencesIncompleteMessage, strings.Join(missing, ", "))
+			b.sendQueryCard(ctx, chatID, draft, nil)
+			return ""
+		}
+		b.dropPendingQuery(chatID)
+		applyDraft(userData, draft)
+		userData.State = string(fsm.Idle)
+		userData.Editing = ""
+		userData.History = nil
+		b.send(ctx, chatID, querySavedMessage)
+		b.runSearch(ctx, chatID, query.From.ID, userData)
+		return ""
+	}
+
+	field, ok := findPreferenceField(action)
+	if !ok {
+		return staleButtonMessage
+	}
+	userData.State = string(field.states[0])
+	userData.Editing = draftEditingPrefix + field.key
+	userData.History = nil
+	promptFor(ctx, b, chatID, b.searchFlow(ctx), field.states[0], draft)
+	return ""
+}
+
+// applyDraft replaces the saved search with a typed one.
+func applyDraft(userData, draft *database.UserData) {
+	userData.PropertyType = draft.PropertyType
+	userData.PriceRange = draft.PriceRange
+	userData.Bedrooms = draft.Bedrooms
+	userData.MaxBedrooms = draft.MaxBedrooms
+	userData.Furnished = draft.Furnished
+	userData.Pets = draft.Pets
+	userData.Area = draft.Area
+	userData.Latitude = draft.Latitude
+	userData.Longitude = draft.Longitude
+	userData.RadiusMiles = draft.RadiusMiles
+	userData.Keywords = draft.Keywords
+}
@@ -0,0 +1,98 @@
+package bot
+
+import (
+	"rent_seekerbot/internal/database"
+	"testing"
+	"time"
+)
+
+func TestTypedSearchDraft(t *testing.T) {
+	tb := newTestBot(t)
+	saved := &database.UserData{
+		PropertyType:       propertyHouse,
+		Area:               "Croydon",
+		QuietOnly:          true,
+		CommuteDestination: "Liverpool Street",
+		MaxCommuteMinutes:  45,
+	}
+	tests := []struct {
+		text string
+		want database.UserData
+	}{
+		{"2 bed flat in Hackney under 2k", database.UserData{
+			PropertyType: propertyFlat, Bedrooms: "2", PriceRange: "0 - 2000", Area: "Hackney"}},
+		{"Studio in Shoreditch, max £1,500 pcm", database.UserData{
+			PropertyType: propertyFlat, Bedrooms: bedroomsStudio, PriceRange: "0 - 1500", Area: "Shoreditch"}},
+		{"2-3 bed flat in Islington £1800-£2400", database.UserData{
+			PropertyType: propertyFlat, Bedrooms: "2", MaxBedrooms: 3, PriceRange: "1800 - 2400", Area: "Islington"}},
+		{"two bed apartment in Camden, furnished, pets ok", database.UserData{
+			PropertyType: propertyFlat, Bedrooms: "2", Furnished: furnishedAnswer, Pets: petsOther, Area: "Camden"}},
+		{"unfurnished house with a dog in Peckham", database.UserData{
+			PropertyType: propertyHouse, Furnished: unfurnishedAnswer, Pets: petsDog, Area: "Peckham"}},
+		// A minimum alone isn't a price range
+		{"2+ beds in Brixton over 1500", database.UserData{Bedrooms: "2", Area: "Brixton"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got := draftFromQuery(saved, tb.bot.queryParser.Parse(tt.text))
+			if got.PropertyType != tt.want.PropertyType || got.Bedrooms != tt.want.Bedrooms ||
+				got.MaxBedrooms != tt.want.MaxBedrooms || got.PriceRange != tt.want.PriceRange ||
+				got.Furnished != tt.want.Furnished || got.Pets != tt.want.Pets || got.Area != tt.want.Area {
+				t.Errorf("draft = %+v, want %+v", got, tt.want)
+			}
+			if got.Area != "" && (got.Latitude == 0 || got.Longitude == 0) {
+				t.Errorf("area %q has no coordinates", got.Area)
+			}
+			// Settings the parser doesn't read are kept
+			if !got.QuietOnly || got.CommuteDestination != saved.CommuteDestination || got.MaxCommuteMinutes != saved.MaxCommuteMinutes {
+				t.Errorf("draft = %+v, want the saved commute and noise settings", got)
+			}
+		})
+	}
+}
+
+func TestPendingQueryIsDropped(t *testing.T) {
+	tests := []struct {
+		name string
+		do   func(tb *testBot)
+	}{
+		{name: "cancel button", do: func(tb *testBot) { tb.press(queryCallbackPrefix + queryCancelAction) }},
+		{name: "/cancel", do: func(tb *testBot) { tb.send("/cancel") }},
+		{name: "/back", do: func(tb *testBot) { tb.send("/back") }},
+		{name: "/start", do: func(tb *testBot) { tb.send("/start") }},
+		{name: "answering the questions", do: func(tb *testBot) { tb.press(goCallbackData) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := newTestBot(t)
+			tb.send("/start")
+			tb.send("2 bed flat in Hackney under 2k")
+			if _, ok := tb.bot.pendingQuery(testChatID); !ok {
+				t.Fatal("the typed search isn't waiting for confirmation")
+			}
+			tt.do(tb)
+			if _, ok := tb.bot.pendingQuery(testChatID); ok {
+				t.Error("the typed search is still waiting for confirmation")
+			}
+		})
+	}
+}
+
+func TestPendingQueryExpires(t *testing.T) {
+	tb := newTestBot(t)
+	draft := &database.UserData{Area: "Hackney"}
+	tb.bot.keepPendingQuery(1, draft, time.Now().Add(-pendingQueryTTL))
+	tb.bot.keepPendingQuery(2, draft, time.Now().Add(-pendingQueryTTL/2))
+	if _, ok := tb.bot.pendingQuery(1); ok {
+		t.Error("an expired typed search is still waiting for confirmation")
+	}
+	if _, ok := tb.bot.pendingQuery(2); !ok {
+		t.Error("a typed search expired early")
+	}
+
+	// Keeping a search forgets the ones that expired in other chats
+	tb.bot.keepPendingQuery(3, draft, time.Now().Add(pendingQueryTTL))
+	if n := len(tb.bot.pendingQueries); n != 1 {
+		t.Errorf("%d typed searches kept, want only the new one", n)
+	}
+}
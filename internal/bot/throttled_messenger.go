@@ -0,0 +1,184 @@
+package bot
+
+import (
+	"errors"
+	"log/slog"
+	"rent_seekerbot/internal/fsm"
+	"rent_seekerbot/internal/ratelimit"
+	"sync"
+	"time"
+)
+
+// Telegram's documented send limits: about 30 messages per second overall, one per
+// second in a private chat and 20 per minute in a group. Short bursts are tolerated.
+const (
+	globalSendRate  = 30
+	globalSendBurst = 30
+	privateSendRate = 1
+	groupSendRate   = 20.0 / 60
+	chatSendBurst   = 3
+)
+
+// maxQueuedPerChat bounds the messages waiting to be sent to a single chat.
+const maxQueuedPerChat = 100
+
+var (
+	// ErrSendQueueFull is returned when a chat has too many messages waiting to be sent.
+	ErrSendQueueFull = errors.New("too many messages waiting to be sent to the chat")
+	// ErrMessengerClosed is returned for messages sent after Close.
+	ErrMessengerClosed = errors.New("messenger is closed")
+)
+
+// sendLimits are the rates and bursts a ThrottledMessenger keeps to.
+type sendLimits struct {
+	globalRate  float64
+	globalBurst int
+	privateRate float64
+	groupRate   float64
+	chatBurst   int
+}
+
+var telegramSendLimits = sendLimits{
+	globalRate:  globalSendRate,
+	globalBurst: globalSendBurst,
+	privateRate: privateSendRate,
+	groupRate:   groupSendRate,
+	chatBurst:   chatSendBurst,
+}
+
+// ThrottledMessenger delays messages so they stay within Telegram's send limits. Each
+// chat has a queue of outgoing messages, delivered in order by a goroutine of its own
+// while the queue isn't empty, so callers never wait for the limits: a chat that is
+// being sent a lot doesn't hold up the update handlers or other chats.
+type ThrottledMessenger struct {
+	next Messenger
+
+	mu      sync.Mutex
+	global  *ratelimit.Bucket
+	private *ratelimit.Keyed
+	groups  *ratelimit.Keyed
+	queues  map[int64][]outgoing
+	closed  bool
+	senders sync.WaitGroup
+}
+
+// outgoing is a queued message or button edit.
+type outgoing struct {
+	send func() error
+	// done receives the delivery error, when the caller waits for it.
+	done chan error
+}
+
+func NewThrottledMessenger(next Messenger) *ThrottledMessenger {
+	return newThrottledMessenger(next, telegramSendLimits)
+}
+
+func newThrottledMessenger(next Messenger, limits sendLimits) *ThrottledMessenger {
+	return &ThrottledMessenger{
+		next:    next,
+		global:  ratelimit.NewBucket(limits.globalRate, limits.globalBurst),
+		private: ratelimit.NewKeyed(limits.privateRate, limits.chatBurst),
+		groups:  ratelimit.NewKeyed(limits.groupRate, limits.chatBurst),
+		queues:  make(map[int64][]outgoing),
+	}
+}
+
+// Send queues msg and returns without waiting for it to be delivered. Delivery failures
+// are logged.
+func (m *ThrottledMessenger) Send(msg OutgoingMessage) error {
+	return m.enqueue(msg.ChatID, outgoing{send: func() error { return m.next.Send(msg) }})
+}
+
+// Deliver queues msg like Send, then waits until it has been delivered and returns the
+// delivery error. It suits background work that acts on the outcome, such as alerts.
+func (m *ThrottledMessenger) Deliver(msg OutgoingMessage) error {
+	done := make(chan error, 1)
+	if err := m.enqueue(msg.ChatID, outgoing{send: func() error { return m.next.Send(msg) }, done: done}); err != nil {
+		return err
+	}
+	return <-done
+}
+
+// EditButtons queues the edit behind the chat's earlier messages.
+func (m *ThrottledMessenger) EditButtons(chatID int64, messageID int, buttons [][]fsm.Button) error {
+	return m.enqueue(chatID, outgoing{send: func() error { return m.next.EditButtons(chatID, messageID, buttons) }})
+}
+
+// AnswerCallback isn't throttled: answers aren't messages and must arrive quickly.
+func (m *ThrottledMessenger) AnswerCallback(callbackID, text string) error {
+	return m.next.AnswerCallback(callbackID, text)
+}
+
+// Close stops accepting messages and waits until the queued ones have been delivered.
+func (m *ThrottledMessenger) Close() {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+	m.senders.Wait()
+}
+
+// enqueue adds a message to the chat's queue, starting the chat's sender if it is idle.
+func (m *ThrottledMessenger) enqueue(chatID int64, item outgoing) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrMessengerClosed
+	}
+	queue, sending := m.queues[chatID]
+	if len(queue) >= maxQueuedPerChat {
+		return ErrSendQueueFull
+	}
+	m.queues[chatID] = append(queue, item)
+	if !sending {
+		m.senders.Add(1)
+		go m.drain(chatID)
+	}
+	return nil
+}
+
+// drain delivers the chat's queued messages in order, and stops once the queue is empty.
+// A chat has a queue, possibly empty, for as long as its sender runs.
+func (m *ThrottledMessenger) drain(chatID int64) {
+	defer m.senders.Done()
+	for {
+		m.mu.Lock()
+		queue := m.queues[chatID]
+		if len(queue) == 0 {
+			delete(m.queues, chatID)
+			m.mu.Unlock()
+			return
+		}
+		item := queue[0]
+		m.queues[chatID] = queue[1:]
+		m.mu.Unlock()
+
+		m.wait(chatID)
+		err := item.send()
+		switch {
+		case item.done != nil:
+			item.done <- err
+		case err != nil:
+			slog.Warn("Failed to deliver message", "chat_id", chatID, "error", err)
+		}
+	}
+}
+
+// wait sleeps until the chat may be sent another message, then reserves a slot in the
+// global bucket and sleeps until that is free too. The global slot is only taken once the
+// chat's own delay has passed, so a throttled chat doesn't hold global capacity meanwhile.
+func (m *ThrottledMessenger) wait(chatID int64) {
+	chats := m.private
+	if isGroupChat(chatID) {
+		chats = m.groups
+	}
+	if delay := chats.Take(chatID, time.Now()); delay > 0 {
+		time.Sleep(delay)
+	}
+
+	m.mu.Lock()
+	delay := m.global.Take(time.Now())
+	m.mu.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
@@ -0,0 +1,157 @@
+package bot
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fastLimits keep the tests quick: ten messages a second per chat, one at a time.
+var fastLimits = sendLimits{globalRate: 1000, globalBurst: 1000, privateRate: 10, groupRate: 10, chatBurst: 1}
+
+// gatedMessenger records messages, failing with err, once gate lets each one through.
+type gatedMessenger struct {
+	*RecordingMessenger
+	gate chan struct{}
+	err  error
+}
+
+func (m *gatedMessenger) Send(msg OutgoingMessage) error {
+	if m.gate != nil {
+		<-m.gate
+	}
+	if m.err != nil {
+		return m.err
+	}
+	return m.RecordingMessenger.Send(msg)
+}
+
+// waitFor polls until done reports true, failing the test after a second.
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !done(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestThrottledSendDoesntWaitForTheLimits(t *testing.T) {
+	recorder := NewRecordingMessenger()
+	m := newThrottledMessenger(recorder, fastLimits)
+
+	start := time.Now()
+	for i := range 5 {
+		if err := m.Send(OutgoingMessage{ChatID: 1, Text: strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("queueing 5 messages took %v, want no waiting", elapsed)
+	}
+
+	// Another chat isn't held up by the first one's queue
+	if err := m.Send(OutgoingMessage{ChatID: 2, Text: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	sentTo := func(chatID int64) int {
+		n := 0
+		for _, message := range recorder.Messages() {
+			if message.ChatID == chatID {
+				n++
+			}
+		}
+		return n
+	}
+	waitFor(t, "the other chat's message", func() bool { return sentTo(2) == 1 })
+	if n := sentTo(1); n == 5 {
+		t.Error("the other chat's message waited for the first chat's queue")
+	}
+
+	m.Close()
+	var texts []string
+	for _, message := range recorder.Messages() {
+		if message.ChatID == 1 {
+			texts = append(texts, message.Text)
+		}
+	}
+	for i, text := range texts {
+		if text != strconv.Itoa(i) {
+			t.Fatalf("chat 1 got %q, want the messages in order", texts)
+		}
+	}
+	if len(texts) != 5 {
+		t.Errorf("chat 1 got %d messages after Close, want 5", len(texts))
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("5 messages were delivered in %v, faster than 10 a second", elapsed)
+	}
+}
+
+func TestThrottledDeliverReturnsTheDeliveryError(t *testing.T) {
+	failure := errors.New("chat not found")
+	m := newThrottledMessenger(&gatedMessenger{RecordingMessenger: NewRecordingMessenger(), err: failure}, fastLimits)
+	defer m.Close()
+
+	if err := m.Send(OutgoingMessage{ChatID: 1}); err != nil {
+		t.Errorf("Send() = %v, want nil once queued", err)
+	}
+	if err := m.Deliver(OutgoingMessage{ChatID: 1}); !errors.Is(err, failure) {
+		t.Errorf("Deliver() = %v, want %v", err, failure)
+	}
+}
+
+func TestThrottledQueueIsBounded(t *testing.T) {
+	next := &gatedMessenger{RecordingMessenger: NewRecordingMessenger(), gate: make(chan struct{})}
+	m := newThrottledMessenger(next, sendLimits{globalRate: 1e6, globalBurst: 1000, privateRate: 1e6, groupRate: 1e6, chatBurst: 1000})
+
+	// The first message is taken off the queue and held at the gate
+	if err := m.Send(OutgoingMessage{ChatID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the first message to leave the queue", func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return len(m.queues[1]) == 0
+	})
+	for range maxQueuedPerChat {
+		if err := m.Send(OutgoingMessage{ChatID: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Send(OutgoingMessage{ChatID: 1}); !errors.Is(err, ErrSendQueueFull) {
+		t.Errorf("Send() = %v, want ErrSendQueueFull", err)
+	}
+	if err := m.Send(OutgoingMessage{ChatID: 2}); err != nil {
+		t.Errorf("Send() to another chat = %v", err)
+	}
+
+	close(next.gate)
+	m.Close()
+	if n := len(next.Messages()); n != maxQueuedPerChat+2 {
+		t.Errorf("%d messages delivered, want %d", n, maxQueuedPerChat+2)
+	}
+	if err := m.Send(OutgoingMessage{ChatID: 1}); !errors.Is(err, ErrMessengerClosed) {
+		t.Errorf("Send() after Close = %v, want ErrMessengerClosed", err)
+	}
+}
+
+func TestThrottledGlobalLimitCoversAllChats(t *testing.T) {
+	recorder := NewRecordingMessenger()
+	m := newThrottledMessenger(recorder, sendLimits{globalRate: 10, globalBurst: 1, privateRate: 1000, groupRate: 1000, chatBurst: 10})
+
+	start := time.Now()
+	for chatID := range int64(4) {
+		if err := m.Send(OutgoingMessage{ChatID: chatID + 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Close()
+	if n := len(recorder.Messages()); n != 4 {
+		t.Fatalf("%d messages delivered, want 4", n)
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("4 chats were sent to in %v, faster than 10 messages a second overall", elapsed)
+	}
+}
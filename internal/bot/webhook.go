@@ -0,0 +1,117 @@
+package bot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+// secretTokenHeader carries the secret token Telegram sends with every webhook request.
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// maxUpdateBytes bounds the size of a webhook request body.
+const maxUpdateBytes = 1 << 20
+
+// WebhookHandler returns a handler for the updates Telegram pushes to the webhook. It
+// rejects requests without the secret token and passes decoded updates to updates. The
+// caller owns updates, and closes it once the server has stopped, see webhook.Shutdown.
+func WebhookHandler(secretToken string, updates chan<- tgbotapi.Update) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token := r.Header.Get(secretTokenHeader)
+		// An empty secret would let requests without the header through
+		if secretToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secretToken)) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		var update tgbotapi.Update
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUpdateBytes)).Decode(&update); err != nil {
+			slog.WarnContext(r.Context(), "Error decoding webhook update", "error", err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		select {
+		case updates <- update:
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+			// Telegram retries updates that aren't acknowledged
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// webhook is a webhook server and the channel it delivers updates on.
+type webhook struct {
+	server  *http.Server
+	updates chan tgbotapi.Update
+}
+
+// newWebhook returns a webhook serving path on addr, not yet started. Up to buffer
+// updates wait on the channel before requests block.
+func newWebhook(addr, path, secretToken string, buffer int) *webhook {
+	h := &webhook{updates: make(chan tgbotapi.Update, buffer)}
+	mux := http.NewServeMux()
+	mux.Handle(path, WebhookHandler(secretToken, h.updates))
+	h.server = &http.Server{Addr: addr, Handler: mux}
+	return h
+}
+
+// Shutdown stops accepting requests and waits for those in flight, then closes the
+// updates channel, so every update acknowledged to Telegram is on it before it closes.
+// If ctx ends first the channel is left open, as requests may still write to it.
+func (h *webhook) Shutdown(ctx context.Context) error {
+	if err := h.server.Shutdown(ctx); err != nil {
+		return err
+	}
+	close(h.updates)
+	return nil
+}
+
+// startWebhook registers the webhook with Telegram and starts serving it. Updates are
+// delivered on the webhook's channel until it is shut down by the caller.
+func startWebhook(api *tgbotapi.BotAPI, opts Options) (*webhook, error) {
+	webhookURL, err := url.Parse(opts.WebhookURL)
+	if err != nil || webhookURL.Scheme != "https" || webhookURL.Host == "" {
+		return nil, fmt.Errorf("webhook URL must be an https URL, got %q", opts.WebhookURL)
+	}
+	path := webhookURL.Path
+	if path == "" {
+		path = "/"
+	}
+
+	hook := newWebhook(opts.ListenAddr, path, opts.SecretToken, api.Buffer)
+	go func() {
+		var err error
+		if opts.TLSCertFile != "" {
+			err = hook.server.ListenAndServeTLS(opts.TLSCertFile, opts.TLSKeyFile)
+		} else {
+			// Without a certificate the server is expected to sit behind a TLS terminating proxy
+			err = hook.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			slog.Error("Webhook server stopped", "error", err)
+		}
+	}()
+
+	// The library's WebhookConfig has no secret_token field, so call setWebhook directly
+	_, err = api.MakeRequest("setWebhook", tgbotapi.Params{
+		"url":          webhookURL.String(),
+		"secret_token": opts.SecretToken,
+	})
+	if err != nil {
+		hook.server.Close()
+		return nil, fmt.Errorf("error registering webhook: %w", err)
+	}
+	slog.Info("Webhook registered", "url", webhookURL.Redacted(), "listen_addr", opts.ListenAddr)
+	return hook, nil
+}
@@ -0,0 +1,157 @@
+package bot
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const testSecretToken = "s3cret_token-1"
+
+// Updates as Telegram posts them to the webhook.
+const (
+	messageUpdateJSON = `{"update_id":815000001,"message":{"message_id":42,"from":{"id":100,"is_bot":false,` +
+		`"first_name":"Ann","language_code":"en"},"chat":{"id":100,"first_name":"Ann","type":"private"},` +
+		`"date":1760875200,"text":"/start","entities":[{"offset":0,"length":6,"type":"bot_command"}]}}`
+	callbackUpdateJSON = `{"update_id":815000002,"callback_query":{"id":"4382bfdwdsb323b2d9","from":{"id":100,` +
+		`"is_bot":false,"first_name":"Ann"},"message":{"message_id":43,"chat":{"id":100,"type":"private"},` +
+		`"date":1760875210,"text":"What are you looking for?"},"chat_instance":"-1234","data":"go"}}`
+)
+
+func TestWebhookHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		body       string
+		wantStatus int
+		wantUpdate int
+	}{
+		{name: "message", method: http.MethodPost, token: testSecretToken, body: messageUpdateJSON, wantStatus: http.StatusOK, wantUpdate: 815000001},
+		{name: "callback query", method: http.MethodPost, token: testSecretToken, body: callbackUpdateJSON, wantStatus: http.StatusOK, wantUpdate: 815000002},
+		{name: "wrong method", method: http.MethodGet, token: testSecretToken, wantStatus: http.StatusMethodNotAllowed},
+		{name: "no secret token", method: http.MethodPost, body: messageUpdateJSON, wantStatus: http.StatusForbidden},
+		{name: "bad secret token", method: http.MethodPost, token: "s3cret_token-2", body: messageUpdateJSON, wantStatus: http.StatusForbidden},
+		{name: "malformed body", method: http.MethodPost, token: testSecretToken, body: `{"update_id":`, wantStatus: http.StatusBadRequest},
+		{name: "wrong types", method: http.MethodPost, token: testSecretToken, body: `{"update_id":"one"}`, wantStatus: http.StatusBadRequest},
+		{name: "body too large", method: http.MethodPost, token: testSecretToken, body: `{"x":"` + strings.Repeat("a", maxUpdateBytes) + `"}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updates := make(chan tgbotapi.Update, 1)
+			request := httptest.NewRequest(tt.method, "/webhook", strings.NewReader(tt.body))
+			if tt.token != "" {
+				request.Header.Set(secretTokenHeader, tt.token)
+			}
+			response := httptest.NewRecorder()
+			WebhookHandler(testSecretToken, updates).ServeHTTP(response, request)
+
+			if response.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", response.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusMethodNotAllowed && response.Header().Get("Allow") != http.MethodPost {
+				t.Errorf("Allow = %q, want POST", response.Header().Get("Allow"))
+			}
+			select {
+			case update := <-updates:
+				if update.UpdateID != tt.wantUpdate {
+					t.Errorf("update_id = %d, want %d", update.UpdateID, tt.wantUpdate)
+				}
+				if updateChatID(update) != 100 {
+					t.Errorf("chat ID = %d, want 100", updateChatID(update))
+				}
+			default:
+				if tt.wantUpdate != 0 {
+					t.Error("no update was delivered")
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerWithoutSecretRejectsEverything(t *testing.T) {
+	updates := make(chan tgbotapi.Update, 1)
+	request := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(messageUpdateJSON))
+	response := httptest.NewRecorder()
+	WebhookHandler("", updates).ServeHTTP(response, request)
+
+	if response.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", response.Code, http.StatusForbidden)
+	}
+	if len(updates) != 0 {
+		t.Error("an update was delivered without a secret token")
+	}
+}
+
+func TestWebhookHandlerGivesUpWhenRequestEnds(t *testing.T) {
+	// Nobody reads the channel, so the update can't be delivered
+	updates := make(chan tgbotapi.Update)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	request := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(messageUpdateJSON)).WithContext(ctx)
+	request.Header.Set(secretTokenHeader, testSecretToken)
+	response := httptest.NewRecorder()
+	WebhookHandler(testSecretToken, updates).ServeHTTP(response, request)
+
+	// Telegram retries updates that aren't acknowledged with 200
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", response.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestWebhookShutdownDeliversUpdatesInFlight(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An unbuffered channel keeps the request in flight until the update is read
+	hook := newWebhook(listener.Addr().String(), "/webhook", testSecretToken, 0)
+	active := make(chan struct{}, 1)
+	hook.server.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateActive {
+			active <- struct{}{}
+		}
+	}
+	go hook.server.Serve(listener)
+
+	status := make(chan int, 1)
+	go func() {
+		request, _ := http.NewRequest(http.MethodPost, "http://"+listener.Addr().String()+"/webhook", strings.NewReader(messageUpdateJSON))
+		request.Header.Set(secretTokenHeader, testSecretToken)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			status <- 0
+			return
+		}
+		response.Body.Close()
+		status <- response.StatusCode
+	}()
+	<-active
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- hook.Shutdown(ctx)
+	}()
+
+	update, ok := <-hook.updates
+	if !ok || update.UpdateID != 815000001 {
+		t.Fatalf("first receive = %+v, %v, want the update in flight", update, ok)
+	}
+	if _, ok := <-hook.updates; ok {
+		t.Error("updates channel wasn't closed after shutdown")
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	if code := <-status; code != http.StatusOK {
+		t.Errorf("status = %d, want %d", code, http.StatusOK)
+	}
+}
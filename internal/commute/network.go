@@ -0,0 +1,235 @@
+package commute
+
+import (
+	"container/heap"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"rent_seekerbot/internal/geo"
+	"strconv"
+	"strings"
+)
+
+//go:embed data/stations.csv
+var stationsCSV string
+
+//go:embed data/links.csv
+var linksCSV string
+
+const (
+	// walkMinutesPerMile assumes a walking speed of 3 mph.
+	walkMinutesPerMile = 20.0
+	// walkDetourFactor accounts for streets not following a straight line.
+	walkDetourFactor = 1.25
+	// maxWalkMiles is the furthest anyone is assumed to walk to or from a station.
+	maxWalkMiles = 1.0
+	// boardingMinutes is the average wait for the first train.
+	boardingMinutes = 3.0
+	// interchangeMinutes is the penalty for changing lines at a station.
+	interchangeMinutes = 5.0
+)
+
+// Station is a stop on the embedded transit network.
+type Station struct {
+	ID        string
+	Name      string
+	Latitude  float64
+	Longitude float64
+}
+
+type link struct {
+	to      int
+	minutes float64
+	line    int
+}
+
+// Network is an offline transit graph used to estimate door-to-door travel times.
+type Network struct {
+	stations []Station
+	index    map[string]int
+	links    [][]link
+	lines    []string
+}
+
+// NewNetwork parses the embedded station and link datasets.
+func NewNetwork() (*Network, error) {
+	stationRecords, err := readCSV(stationsCSV, 4)
+	if err != nil {
+		return nil, fmt.Errorf("error reading stations dataset: %w", err)
+	}
+	linkRecords, err := readCSV(linksCSV, 4)
+	if err != nil {
+		return nil, fmt.Errorf("error reading links dataset: %w", err)
+	}
+
+	n := &Network{index: make(map[string]int)}
+	for _, record := range stationRecords {
+		lat, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("station %s: invalid latitude: %w", record[0], err)
+		}
+		lon, err := strconv.ParseFloat(record[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("station %s: invalid longitude: %w", record[0], err)
+		}
+		n.index[record[0]] = len(n.stations)
+		n.stations = append(n.stations, Station{ID: record[0], Name: record[1], Latitude: lat, Longitude: lon})
+	}
+
+	n.links = make([][]link, len(n.stations))
+	lineIndex := make(map[string]int)
+	for _, record := range linkRecords {
+		from, ok := n.index[record[0]]
+		if !ok {
+			return nil, fmt.Errorf("link references unknown station %s", record[0])
+		}
+		to, ok := n.index[record[1]]
+		if !ok {
+			return nil, fmt.Errorf("link references unknown station %s", record[1])
+		}
+		minutes, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("link %s-%s: invalid minutes: %w", record[0], record[1], err)
+		}
+		line, ok := lineIndex[record[3]]
+		if !ok {
+			line = len(n.lines)
+			lineIndex[record[3]] = line
+			n.lines = append(n.lines, record[3])
+		}
+		n.links[from] = append(n.links[from], link{to: to, minutes: minutes, line: line})
+		n.links[to] = append(n.links[to], link{to: from, minutes: minutes, line: line})
+	}
+	return n, nil
+}
+
+func readCSV(data string, fields int) ([][]string, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = fields
+	return reader.ReadAll()
+}
+
+// FindStation returns the station whose name matches the input, ignoring case and punctuation.
+func (n *Network) FindStation(name string) (Station, bool) {
+	query := geo.Normalise(name)
+	query = strings.TrimSuffix(query, " station")
+	for _, station := range n.stations {
+		if geo.Normalise(station.Name) == query {
+			return station, true
+		}
+	}
+	return Station{}, false
+}
+
+// Destination holds the travel time from every station to a fixed destination.
+type Destination struct {
+	network   *Network
+	latitude  float64
+	longitude float64
+	minutes   []float64
+}
+
+// To computes travel times from every station to the given point. The result can be
+// reused to estimate the commute from any number of listings.
+func (n *Network) To(lat, lon float64) *Destination {
+	// Dijkstra over (station, line) pairs so that changing lines can be penalised.
+	numLines := len(n.lines)
+	best := make([]float64, len(n.stations)*numLines)
+	for i := range best {
+		best[i] = math.Inf(1)
+	}
+
+	queue := &stateQueue{}
+	for i, station := range n.stations {
+		walk, ok := walkMinutes(lat, lon, station.Latitude, station.Longitude)
+		if !ok {
+			continue
+		}
+		for _, l := range n.links[i] {
+			s := i*numLines + l.line
+			if walk < best[s] {
+				best[s] = walk
+				heap.Push(queue, state{node: s, minutes: walk})
+			}
+		}
+	}
+
+	for queue.Len() > 0 {
+		current := heap.Pop(queue).(state)
+		if current.minutes > best[current.node] {
+			continue
+		}
+		station, line := current.node/numLines, current.node%numLines
+		for _, l := range n.links[station] {
+			cost := current.minutes + l.minutes
+			if l.line != line {
+				cost += interchangeMinutes
+			}
+			next := l.to*numLines + l.line
+			if cost < best[next] {
+				best[next] = cost
+				heap.Push(queue, state{node: next, minutes: cost})
+			}
+		}
+	}
+
+	minutes := make([]float64, len(n.stations))
+	for i := range n.stations {
+		minutes[i] = math.Inf(1)
+		for line := 0; line < numLines; line++ {
+			minutes[i] = math.Min(minutes[i], best[i*numLines+line])
+		}
+		minutes[i] += boardingMinutes
+	}
+	return &Destination{network: n, latitude: lat, longitude: lon, minutes: minutes}
+}
+
+// Minutes estimates the door-to-door travel time from the given point to the destination.
+// It returns false if the point is too far from both the destination and any station.
+func (d *Destination) Minutes(lat, lon float64) (int, bool) {
+	best := math.Inf(1)
+	if walk, ok := walkMinutes(lat, lon, d.latitude, d.longitude); ok {
+		best = walk
+	}
+	for i, station := range d.network.stations {
+		walk, ok := walkMinutes(lat, lon, station.Latitude, station.Longitude)
+		if !ok {
+			continue
+		}
+		best = math.Min(best, walk+d.minutes[i])
+	}
+	if math.IsInf(best, 1) {
+		return 0, false
+	}
+	return int(math.Round(best)), true
+}
+
+// walkMinutes returns the walking time between two points, or false if it is beyond maxWalkMiles.
+func walkMinutes(lat1, lon1, lat2, lon2 float64) (float64, bool) {
+	miles := geo.DistanceMiles(lat1, lon1, lat2, lon2) * walkDetourFactor
+	if miles > maxWalkMiles {
+		return 0, false
+	}
+	return miles * walkMinutesPerMile, true
+}
+
+type state struct {
+	node    int
+	minutes float64
+}
+
+// stateQueue is a min-heap of states ordered by travel time.
+type stateQueue []state
+
+func (q stateQueue) Len() int           { return len(q) }
+func (q stateQueue) Less(i, j int) bool { return q[i].minutes < q[j].minutes }
+func (q stateQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *stateQueue) Push(x any)        { *q = append(*q, x.(state)) }
+func (q *stateQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
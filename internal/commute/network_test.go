@@ -0,0 +1,120 @@
+package commute
+
+import (
+	"math"
+	"testing"
+)
+
+// testNetwork is a small hand-built network with stations about 3.5 miles apart, so
+// nobody walks between them:
+//
+//	A -4- B -6- C   on the red line
+//	          C -5- D   on the blue line
+//	E -2- F         on the green line, unconnected to the rest
+func testNetwork(t *testing.T) *Network {
+	t.Helper()
+	n := &Network{index: make(map[string]int)}
+	for i, id := range []string{"A", "B", "C", "D", "E", "F"} {
+		n.index[id] = i
+		n.stations = append(n.stations, Station{ID: id, Name: "Station " + id, Latitude: 51.0 + 0.05*float64(i), Longitude: 0})
+	}
+	n.links = make([][]link, len(n.stations))
+	for _, l := range []struct {
+		from, to string
+		minutes  float64
+		line     int
+	}{
+		{"A", "B", 4, 0},
+		{"B", "C", 6, 0},
+		{"C", "D", 5, 1},
+		{"E", "F", 2, 2},
+	} {
+		from, to := n.index[l.from], n.index[l.to]
+		n.links[from] = append(n.links[from], link{to: to, minutes: l.minutes, line: l.line})
+		n.links[to] = append(n.links[to], link{to: from, minutes: l.minutes, line: l.line})
+	}
+	n.lines = []string{"red", "blue", "green"}
+	return n
+}
+
+func TestMinutes(t *testing.T) {
+	n := testNetwork(t)
+	station := func(id string) Station { return n.stations[n.index[id]] }
+	a := station("A")
+	destination := n.To(a.Latitude, a.Longitude)
+
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     int
+		wantOK   bool
+	}{
+		// Boarding (3) and the ride from B to A (4)
+		{"direct", station("B").Latitude, 0, 7, true},
+		// Boarding (3), D to C on the blue line (5), changing (5) and C to A on the red line (10)
+		{"with a change", station("D").Latitude, 0, 23, true},
+		// 0.35 miles to B, 0.43 with the detour, is 8.6 minutes on foot before the 7 from B
+		{"walk to the station", station("B").Latitude + 0.005, 0, 16, true},
+		// 0.14 miles from the destination, 0.17 with the detour, beats walking to A and boarding
+		{"walking only", a.Latitude - 0.002, 0, 3, true},
+		{"no route", station("E").Latitude, 0, 0, false},
+		{"too far from any station", 52.0, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := destination.Minutes(tt.lat, tt.lon)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Minutes() = %d, %v; want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestToAwayFromStations(t *testing.T) {
+	n := testNetwork(t)
+	// Nowhere near a station, so only walking can reach the destination
+	destination := n.To(52.0, 0)
+	for i, minutes := range destination.minutes {
+		if !math.IsInf(minutes, 1) {
+			t.Errorf("station %s is %v minutes away, want unreachable", n.stations[i].ID, minutes)
+		}
+	}
+	// 0.69 miles, 0.86 with the detour
+	if got, ok := destination.Minutes(52.01, 0); got != 17 || !ok {
+		t.Errorf("Minutes() on foot = %d, %v; want 17, true", got, ok)
+	}
+}
+
+func TestFindStation(t *testing.T) {
+	n, err := NewNetwork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		input  string
+		wantID string
+	}{
+		{"Bank", "bank"},
+		{"bank", "bank"},
+		{"  BAKER STREET ", "baker_street"},
+		{"Kings Cross St Pancras", "kings_cross"},
+		{"King's Cross St Pancras station", "kings_cross"},
+		{"St. Paul's", "st_pauls"},
+		{"Earls Court", "earls_court"},
+		{"Kings Cross", ""},
+		{"Hogwarts", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		station, ok := n.FindStation(tt.input)
+		if tt.wantID == "" {
+			if ok {
+				t.Errorf("FindStation(%q) = %s, want no station", tt.input, station.ID)
+			}
+			continue
+		}
+		if !ok || station.ID != tt.wantID {
+			t.Errorf("FindStation(%q) = %s, %v; want %s", tt.input, station.ID, ok, tt.wantID)
+		}
+	}
+}
@@ -1,17 +1,385 @@
+// Package config loads the bot's settings. Each setting has a default and can be set in a
+// YAML file, an environment variable or a command line flag, in increasing precedence.
+// Secrets can also be read from the file named by the variable with a _FILE suffix, e.g.
+// TELEGRAM_BOT_TOKEN_FILE.
 package config
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"github.com/joho/godotenv"
-	"log"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/fs"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func LoadConfig() {
-	err := godotenv.Load()
+// Providers of listings.
+const (
+	ProviderZoopla = "zoopla"
+	ProviderMock   = "mock"
+)
+
+// Ways of receiving updates from Telegram.
+const (
+	ModePolling = "polling"
+	ModeWebhook = "webhook"
+)
+
+// Telegram only accepts 1-256 letters, digits, underscores and hyphens as a secret token.
+var secretTokenPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+type Config struct {
+	TelegramToken string `yaml:"telegram_token"`
+	// DatabaseDSN is the SQLite database file or DSN.
+	DatabaseDSN string `yaml:"database_dsn"`
+	// AdminIDs are the Telegram user IDs allowed to use admin commands.
+	AdminIDs []int64 `yaml:"admin_ids"`
+	// HealthAddr serves /healthz, /readyz and /metrics. Empty turns them off.
+	HealthAddr string `yaml:"health_addr"`
+
+	Provider ProviderConfig `yaml:"provider"`
+	Updates  UpdatesConfig  `yaml:"updates"`
+	Limits   LimitsConfig   `yaml:"limits"`
+	Log      LogConfig      `yaml:"log"`
+}
+
+type ProviderConfig struct {
+	// Name is ProviderZoopla or ProviderMock.
+	Name         string `yaml:"name"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	AgencyRef    string `yaml:"agency_ref"`
+}
+
+type UpdatesConfig struct {
+	// Mode is ModePolling or ModeWebhook.
+	Mode string `yaml:"mode"`
+	// PollTimeout is how long a long polling request waits for updates.
+	PollTimeout time.Duration `yaml:"poll_timeout"`
+	WebhookURL  string        `yaml:"webhook_url"`
+	ListenAddr  string        `yaml:"listen_addr"`
+	SecretToken string        `yaml:"secret_token"`
+	TLSCertFile string        `yaml:"tls_cert_file"`
+	TLSKeyFile  string        `yaml:"tls_key_file"`
+}
+
+type LimitsConfig struct {
+	// Workers is the number of updates handled at the same time.
+	Workers int `yaml:"workers"`
+	// SearchBurst searches can be run in a row, then one every SearchInterval.
+	SearchBurst    int           `yaml:"search_burst"`
+	SearchInterval time.Duration `yaml:"search_interval"`
+	// AlertInterval is how often saved searches are run for new listings to alert.
+	AlertInterval time.Duration `yaml:"alert_interval"`
+}
+
+type LogConfig struct {
+	// Level is "debug", "info", "warn" or "error".
+	Level string `yaml:"level"`
+	// PersonalData logs message contents and personal data instead of redacting them.
+	PersonalData bool `yaml:"personal_data"`
+}
+
+// Default returns the settings used when nothing else is configured.
+func Default() Config {
+	return Config{
+		DatabaseDSN: "rent_seeker.db",
+		HealthAddr:  ":9090",
+		Provider:    ProviderConfig{Name: ProviderZoopla},
+		Updates: UpdatesConfig{
+			Mode:        ModePolling,
+			PollTimeout: 60 * time.Second,
+			ListenAddr:  ":8443",
+		},
+		Limits: LimitsConfig{
+			Workers:        16,
+			SearchBurst:    3,
+			SearchInterval: 30 * time.Second,
+			AlertInterval:  30 * time.Minute,
+		},
+		Log: LogConfig{Level: "info"},
+	}
+}
+
+// setting binds a Config field to its environment variable and flag.
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	// secret settings can be read from the file named by env+"_FILE".
+	secret bool
+	set    func(c *Config, value string) error
+}
+
+func settings() []setting {
+	return []setting{
+		{"TELEGRAM_BOT_TOKEN", "telegram-token", "Telegram bot token", true, setString(func(c *Config) *string { return &c.TelegramToken })},
+		{"DATABASE_DSN", "database", "SQLite database file", false, setString(func(c *Config) *string { return &c.DatabaseDSN })},
+		{"ADMIN_USER_IDS", "admins", "comma separated Telegram user IDs of admins", false, setIDs(func(c *Config) *[]int64 { return &c.AdminIDs })},
+		{"HEALTH_LISTEN_ADDR", "health-addr", `address serving health checks and metrics, or "off"`, false, setHealthAddr},
+
+		{"PROVIDER", "provider", `listings provider, "zoopla" or "mock"`, false, setString(func(c *Config) *string { return &c.Provider.Name })},
+		{"ZOOPLA_CLIENT_ID", "zoopla-client-id", "Zoopla API client ID", false, setString(func(c *Config) *string { return &c.Provider.ClientID })},
+		{"ZOOPLA_CLIENT_SECRET", "zoopla-client-secret", "Zoopla API client secret", true, setString(func(c *Config) *string { return &c.Provider.ClientSecret })},
+		{"ZOOPLA_AGENCY_REF", "zoopla-agency-ref", "Zoopla agency reference", false, setString(func(c *Config) *string { return &c.Provider.AgencyRef })},
+
+		{"BOT_MODE", "mode", `how updates are received, "polling" or "webhook"`, false, setString(func(c *Config) *string { return &c.Updates.Mode })},
+		{"POLL_TIMEOUT", "poll-timeout", "long polling timeout, e.g. 60s", false, setDuration(func(c *Config) *time.Duration { return &c.Updates.PollTimeout })},
+		{"WEBHOOK_URL", "webhook-url", "public https URL Telegram posts updates to", false, setString(func(c *Config) *string { return &c.Updates.WebhookURL })},
+		{"WEBHOOK_LISTEN_ADDR", "webhook-addr", "address the webhook server listens on", false, setString(func(c *Config) *string { return &c.Updates.ListenAddr })},
+		{"WEBHOOK_SECRET_TOKEN", "webhook-secret-token", "secret token Telegram sends with webhook requests", true, setString(func(c *Config) *string { return &c.Updates.SecretToken })},
+		{"WEBHOOK_TLS_CERT", "webhook-tls-cert", "TLS certificate file for the webhook server", false, setString(func(c *Config) *string { return &c.Updates.TLSCertFile })},
+		{"WEBHOOK_TLS_KEY", "webhook-tls-key", "TLS key file for the webhook server", false, setString(func(c *Config) *string { return &c.Updates.TLSKeyFile })},
+
+		{"WORKERS", "workers", "number of updates handled at the same time", false, setInt(func(c *Config) *int { return &c.Limits.Workers })},
+		{"SEARCH_BURST", "search-burst", "searches a user can run in a row", false, setInt(func(c *Config) *int { return &c.Limits.SearchBurst })},
+		{"SEARCH_INTERVAL", "search-interval", "time between searches once the burst is used, e.g. 30s", false, setDuration(func(c *Config) *time.Duration { return &c.Limits.SearchInterval })},
+		{"ALERT_INTERVAL", "alert-interval", "how often saved searches are run for new listings, e.g. 30m", false, setDuration(func(c *Config) *time.Duration { return &c.Limits.AlertInterval })},
+
+		{"LOG_LEVEL", "log-level", `"debug", "info", "warn" or "error"`, false, setString(func(c *Config) *string { return &c.Log.Level })},
+		{"LOG_PERSONAL_DATA", "log-personal-data", "log message contents and personal data, for local debugging only", false, setBool(func(c *Config) *bool { return &c.Log.PersonalData })},
+	}
+}
+
+// ValidationError lists every problem found in the configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Load reads the configuration from the defaults, the YAML file given by -config or
+// CONFIG_FILE, the environment (including a .env file if there is one) and args, in
+// increasing precedence. All problems are reported together in a *ValidationError.
+func Load(args []string) (*Config, error) {
+	// Variables already set in the environment take precedence over .env
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error loading .env file: %w", err)
+	}
+
+	var problems []string
+	flags := flag.NewFlagSet("rent_seekerbot", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration file")
+	var fromFlags []func(c *Config)
+	for _, s := range settings() {
+		flags.Func(s.flag, s.usage+" (env "+s.env+")", func(value string) error {
+			fromFlags = append(fromFlags, func(c *Config) {
+				if err := s.set(c, value); err != nil {
+					problems = append(problems, fmt.Sprintf("-%s: %v", s.flag, err))
+				}
+			})
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		problems = append(problems, fmt.Sprintf("unexpected arguments: %s", strings.Join(flags.Args(), " ")))
+	}
+
+	c := Default()
+	if *configFile != "" {
+		if err := loadFile(&c, *configFile); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	problems = append(problems, loadEnv(&c)...)
+	for _, apply := range fromFlags {
+		apply(&c)
+	}
+	problems = append(problems, c.validate()...)
+
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return &c, nil
+}
+
+func loadFile(c *Config, path string) error {
+	f, err := os.Open(path)
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		return fmt.Errorf("error opening config file: %w", err)
+	}
+	defer f.Close()
+	decoder := yaml.NewDecoder(f)
+	// Catch misspelt keys rather than silently ignoring them
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("error reading config file %s: %w", path, err)
+	}
+	// Settings read from YAML mean the same as when set in the environment or a flag
+	return setHealthAddr(c, c.HealthAddr)
+}
+
+func loadEnv(c *Config) []string {
+	var problems []string
+	// USE_MOCK_ZOOPLA predates PROVIDER and is still honoured, with PROVIDER taking precedence
+	if os.Getenv("USE_MOCK_ZOOPLA") == "true" {
+		c.Provider.Name = ProviderMock
+	}
+	for _, s := range settings() {
+		value, ok := os.LookupEnv(s.env)
+		if s.secret {
+			if path := os.Getenv(s.env + "_FILE"); path != "" {
+				if ok {
+					problems = append(problems, fmt.Sprintf("%s and %s_FILE are both set", s.env, s.env))
+					continue
+				}
+				secret, err := os.ReadFile(path)
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("%s_FILE: %v", s.env, err))
+					continue
+				}
+				value, ok = strings.TrimSpace(string(secret)), true
+			}
+		}
+		if !ok {
+			continue
+		}
+		if err := s.set(c, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", s.env, err))
+		}
+	}
+	return problems
+}
+
+func (c *Config) validate() []string {
+	var problems []string
+	if c.TelegramToken == "" {
+		problems = append(problems, "the Telegram bot token is required (TELEGRAM_BOT_TOKEN or -telegram-token)")
+	}
+	if c.DatabaseDSN == "" {
+		problems = append(problems, "the database DSN must not be empty")
+	}
+
+	switch c.Provider.Name {
+	case ProviderMock:
+	case ProviderZoopla:
+		if c.Provider.ClientID == "" || c.Provider.ClientSecret == "" || c.Provider.AgencyRef == "" {
+			problems = append(problems, "the zoopla provider needs a client ID, client secret and agency reference")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown provider %q, want %q or %q", c.Provider.Name, ProviderZoopla, ProviderMock))
+	}
+
+	switch c.Updates.Mode {
+	case ModePolling:
+		if c.Updates.PollTimeout < time.Second {
+			problems = append(problems, "the poll timeout must be at least 1s")
+		}
+	case ModeWebhook:
+		if u, err := url.Parse(c.Updates.WebhookURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("the webhook URL must be an https URL, got %q", c.Updates.WebhookURL))
+		}
+		if c.Updates.SecretToken == "" {
+			problems = append(problems, "webhook mode needs a secret token")
+		} else if !secretTokenPattern.MatchString(c.Updates.SecretToken) {
+			problems = append(problems, "the webhook secret token must be 1-256 letters, digits, _ or -")
+		}
+		if c.Updates.ListenAddr == "" {
+			problems = append(problems, "webhook mode needs a listen address")
+		}
+		if (c.Updates.TLSCertFile == "") != (c.Updates.TLSKeyFile == "") {
+			problems = append(problems, "the webhook TLS certificate and key must be set together")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown mode %q, want %q or %q", c.Updates.Mode, ModePolling, ModeWebhook))
+	}
+
+	if c.Limits.Workers < 1 {
+		problems = append(problems, "there must be at least one worker")
+	}
+	if c.Limits.SearchBurst < 1 {
+		problems = append(problems, "the search burst must be at least 1")
+	}
+	if c.Limits.SearchInterval <= 0 {
+		problems = append(problems, "the search interval must be positive")
+	}
+	if c.Limits.AlertInterval < time.Minute {
+		problems = append(problems, "the alert interval must be at least a minute")
+	}
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "warning", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("unknown log level %q", c.Log.Level))
+	}
+	return problems
+}
+
+func setString(field func(c *Config) *string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func setInt(field func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func setBool(field func(c *Config) *bool) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func setDuration(field func(c *Config) *time.Duration) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		*field(c) = d
+		return nil
 	}
 }
-func GetEnv(key string) string {
-	return os.Getenv(key)
+
+// setIDs parses a comma separated list of Telegram IDs, e.g. "12345,67890".
+func setIDs(field func(c *Config) *[]int64) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		var ids []int64
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			id, err := strconv.ParseInt(part, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid ID %q", part)
+			}
+			ids = append(ids, id)
+		}
+		*field(c) = ids
+		return nil
+	}
+}
+
+func setHealthAddr(c *Config, value string) error {
+	if value == "off" {
+		value = ""
+	}
+	c.HealthAddr = value
+	return nil
 }
@@ -0,0 +1,247 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func webhookConfig(secretToken string) Config {
+	c := Default()
+	c.TelegramToken = "123456:ABC"
+	c.Provider.Name = ProviderMock
+	c.Updates.Mode = ModeWebhook
+	c.Updates.WebhookURL = "https://bot.example.com/webhook"
+	c.Updates.SecretToken = secretToken
+	return c
+}
+
+func TestValidateWebhookSecretToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		secretToken string
+		wantProblem string
+	}{
+		{name: "valid", secretToken: "s3cret_token-1"},
+		{name: "longest", secretToken: strings.Repeat("a", 256)},
+		{name: "missing", wantProblem: "webhook mode needs a secret token"},
+		{name: "too long", secretToken: strings.Repeat("a", 257), wantProblem: "the webhook secret token must be 1-256 letters, digits, _ or -"},
+		{name: "bad characters", secretToken: "s3cret token!", wantProblem: "the webhook secret token must be 1-256 letters, digits, _ or -"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := webhookConfig(tt.secretToken)
+			problems := c.validate()
+			if tt.wantProblem == "" {
+				if len(problems) != 0 {
+					t.Errorf("validate() = %q, want no problems", problems)
+				}
+				return
+			}
+			if !slices.Contains(problems, tt.wantProblem) {
+				t.Errorf("validate() = %q, want %q", problems, tt.wantProblem)
+			}
+		})
+	}
+}
+
+func TestValidateIgnoresSecretTokenWhenPolling(t *testing.T) {
+	c := webhookConfig("not a token!")
+	c.Updates.Mode = ModePolling
+	if problems := c.validate(); len(problems) != 0 {
+		t.Errorf("validate() = %q, want no problems", problems)
+	}
+}
+
+// isolateEnv unsets the variables Load reads, so the tests don't depend on the
+// environment they run in. They are restored when the test ends.
+func isolateEnv(t *testing.T) {
+	t.Helper()
+	names := []string{"CONFIG_FILE", "USE_MOCK_ZOOPLA"}
+	for _, s := range settings() {
+		names = append(names, s.env, s.env+"_FILE")
+	}
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+// writeFile writes content to a file in a temporary directory and returns its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	isolateEnv(t)
+	configFile := writeFile(t, "config.yaml", `
+telegram_token: "123456:yaml"
+database_dsn: yaml.db
+health_addr: "off"
+provider:
+  name: mock
+limits:
+  workers: 4
+  search_burst: 5
+log:
+  level: warn
+`)
+	t.Setenv("CONFIG_FILE", configFile)
+	t.Setenv("DATABASE_DSN", "env.db")
+	t.Setenv("WORKERS", "8")
+	t.Setenv("ALERT_INTERVAL", "10m")
+
+	c, err := Load([]string{"-database", "flag.db", "-alert-interval", "5m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := []struct {
+		name      string
+		got, want any
+	}{
+		{"default poll timeout", c.Updates.PollTimeout, 60 * time.Second},
+		{"default search interval", c.Limits.SearchInterval, 30 * time.Second},
+		{"token from YAML", c.TelegramToken, "123456:yaml"},
+		{"provider from YAML", c.Provider.Name, ProviderMock},
+		{"search burst from YAML", c.Limits.SearchBurst, 5},
+		{"log level from YAML", c.Log.Level, "warn"},
+		{`"off" health address from YAML`, c.HealthAddr, ""},
+		{"workers from the environment over YAML", c.Limits.Workers, 8},
+		{"alert interval from a flag over the environment", c.Limits.AlertInterval, 5 * time.Minute},
+		{"database from a flag over the environment and YAML", c.DatabaseDSN, "flag.db"},
+	}
+	for _, check := range checks {
+		if check.got != check.want {
+			t.Errorf("%s: got %v, want %v", check.name, check.got, check.want)
+		}
+	}
+}
+
+func TestLoadHealthAddrOff(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		env  string
+		args []string
+	}{
+		{name: "environment", env: "off"},
+		{name: "flag", args: []string{"-health-addr", "off"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateEnv(t)
+			t.Setenv("TELEGRAM_BOT_TOKEN", "123456:env")
+			t.Setenv("PROVIDER", ProviderMock)
+			if tt.env != "" {
+				t.Setenv("HEALTH_LISTEN_ADDR", tt.env)
+			}
+			c, err := Load(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.HealthAddr != "" {
+				t.Errorf("HealthAddr = %q, want it off", c.HealthAddr)
+			}
+		})
+	}
+}
+
+func TestLoadSecretFromFile(t *testing.T) {
+	isolateEnv(t)
+	t.Setenv("PROVIDER", ProviderMock)
+	t.Setenv("TELEGRAM_BOT_TOKEN_FILE", writeFile(t, "token", "  123456:file\n"))
+
+	c, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.TelegramToken != "123456:file" {
+		t.Errorf("TelegramToken = %q, want the trimmed file contents", c.TelegramToken)
+	}
+
+	// Only secrets can come from files
+	t.Setenv("DATABASE_DSN_FILE", writeFile(t, "dsn", "file.db"))
+	if c, err = Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	if c.DatabaseDSN != Default().DatabaseDSN {
+		t.Errorf("DatabaseDSN = %q, want the default", c.DatabaseDSN)
+	}
+}
+
+func TestLoadSecretFileProblems(t *testing.T) {
+	tests := []struct {
+		name        string
+		token       string
+		file        func(t *testing.T) string
+		wantProblem string
+	}{
+		{
+			name:        "both set",
+			token:       "123456:env",
+			file:        func(t *testing.T) string { return writeFile(t, "token", "123456:file") },
+			wantProblem: "TELEGRAM_BOT_TOKEN and TELEGRAM_BOT_TOKEN_FILE are both set",
+		},
+		{
+			name:        "missing file",
+			file:        func(t *testing.T) string { return filepath.Join(t.TempDir(), "missing") },
+			wantProblem: "TELEGRAM_BOT_TOKEN_FILE: ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateEnv(t)
+			t.Setenv("PROVIDER", ProviderMock)
+			if tt.token != "" {
+				t.Setenv("TELEGRAM_BOT_TOKEN", tt.token)
+			}
+			t.Setenv("TELEGRAM_BOT_TOKEN_FILE", tt.file(t))
+
+			_, err := Load(nil)
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("Load() = %v, want a *ValidationError", err)
+			}
+			if !slices.ContainsFunc(invalid.Problems, func(p string) bool { return strings.HasPrefix(p, tt.wantProblem) }) {
+				t.Errorf("problems = %q, want one starting %q", invalid.Problems, tt.wantProblem)
+			}
+		})
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	isolateEnv(t)
+	t.Setenv("WORKERS", "lots")
+	t.Setenv("SEARCH_BURST", "0")
+	t.Setenv("LOG_LEVEL", "loud")
+
+	_, err := Load([]string{"-mode", "carrier-pigeon", "stray"})
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Load() = %v, want a *ValidationError", err)
+	}
+	want := []string{
+		"unexpected arguments: stray",
+		`WORKERS: invalid number "lots"`,
+		"the Telegram bot token is required (TELEGRAM_BOT_TOKEN or -telegram-token)",
+		"the zoopla provider needs a client ID, client secret and agency reference",
+		`unknown mode "carrier-pigeon", want "polling" or "webhook"`,
+		"the search burst must be at least 1",
+		`unknown log level "loud"`,
+	}
+	if !slices.Equal(invalid.Problems, want) {
+		t.Errorf("problems = %q, want %q", invalid.Problems, want)
+	}
+	for _, problem := range want {
+		if !strings.Contains(err.Error(), "\n  - "+problem) {
+			t.Errorf("Error() = %q, want it to list %q", err.Error(), problem)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package database
+
+// UserStats summarises the bot's users for operators.
+type UserStats struct {
+	Users int
+	// InConversation counts chats that are part way through a question flow.
+	InConversation int
+	// SavedSearches counts chats that have chosen an area to search.
+	SavedSearches    int
+	Groups           int
+	RoommateProfiles int
+	Blocked          int
+}
+
+func (db *DB) createAdminAuditTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS admin_audit (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		admin_id INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		details TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	_, err := db.Exec(query)
+	return err
+}
+
+// LogAdminAction records an admin command in the audit table.
+func (db *DB) LogAdminAction(adminID int64, action, details string) error {
+	_, err := db.Exec(`INSERT INTO admin_audit (admin_id, action, details) VALUES (?, ?, ?)`, adminID, action, details)
+	return err
+}
+
+// UserStats counts users, conversations in progress and saved searches.
+func (db *DB) UserStats() (UserStats, error) {
+	query := `
+	SELECT
+		COUNT(*),
+		COALESCE(SUM(state IS NOT NULL AND state != ''), 0),
+		COALESCE(SUM(area IS NOT NULL AND area != ''), 0),
+		COALESCE(SUM(chat_id < 0), 0),
+		(SELECT COUNT(*) FROM roommate_profiles WHERE active = 1),
+		(SELECT COUNT(*) FROM blocklist)
+	FROM users
+	`
+	var stats UserStats
+	err := db.QueryRow(query).Scan(&stats.Users, &stats.InConversation, &stats.SavedSearches, &stats.Groups,
+		&stats.RoommateProfiles, &stats.Blocked)
+	return stats, err
+}
+
+// PrivateChatIDs returns the chat IDs of every private chat with the bot, leaving out
+// blocked users.
+func (db *DB) PrivateChatIDs() ([]int64, error) {
+	rows, err := db.Query(`
+	SELECT chat_id FROM users
+	WHERE chat_id > 0 AND chat_id NOT IN (SELECT user_id FROM blocklist)
+	ORDER BY chat_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
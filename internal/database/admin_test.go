@@ -0,0 +1,33 @@
+package database
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPrivateChatIDsLeaveOutBlockedUsers(t *testing.T) {
+	db := newTestDB(t)
+	for _, chatID := range []int64{3, 1, 2, -100} {
+		if err := db.SaveUser(chatID, &UserData{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.BlockUser(2, "spam"); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := db.PrivateChatIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{1, 3}; !slices.Equal(ids, want) {
+		t.Errorf("PrivateChatIDs() = %v, want %v", ids, want)
+	}
+
+	if _, err := db.UnblockUser(2); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := db.PrivateChatIDs(); !slices.Equal(ids, []int64{1, 2, 3}) {
+		t.Errorf("PrivateChatIDs() = %v after unblocking, want 2 back", ids)
+	}
+}
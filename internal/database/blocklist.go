@@ -0,0 +1,41 @@
+package database
+
+func (db *DB) createBlocklistTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS blocklist (
+		user_id INTEGER PRIMARY KEY,
+		reason TEXT NOT NULL DEFAULT '',
+		blocked_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	_, err := db.Exec(query)
+	return err
+}
+
+// BlockUser stops the bot from answering a user. Blocking an already blocked user
+// updates the reason.
+func (db *DB) BlockUser(userID int64, reason string) error {
+	query := `
+	INSERT INTO blocklist (user_id, reason) VALUES (?, ?)
+	ON CONFLICT(user_id) DO UPDATE SET reason = excluded.reason
+	`
+	_, err := db.Exec(query, userID, reason)
+	return err
+}
+
+// UnblockUser removes a user from the blocklist. It reports whether they were blocked.
+func (db *DB) UnblockUser(userID int64) (bool, error) {
+	result, err := db.Exec(`DELETE FROM blocklist WHERE user_id = ?`, userID)
+	if err != nil {
+		return false, err
+	}
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
+
+// IsBlocked reports whether the user is on the blocklist.
+func (db *DB) IsBlocked(userID int64) (bool, error) {
+	var blocked bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM blocklist WHERE user_id = ?)`, userID).Scan(&blocked)
+	return blocked, err
+}
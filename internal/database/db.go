@@ -2,7 +2,9 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
 	_ "github.com/mattn/go-sqlite3"
+	"strings"
 )
 
 type DB struct {
@@ -14,6 +16,9 @@ func NewDB(dataSourceName string) (*DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Updates are handled concurrently. SQLite allows a single writer, so share one
+	// connection rather than failing with "database is locked".
+	db.SetMaxOpenConns(1)
 	if err = db.Ping(); err != nil {
 		return nil, err
 	}
@@ -29,42 +34,194 @@ func (db *DB) CreateTables() error {
 		property_type TEXT,
 		price_range TEXT,
 		bedrooms TEXT,
+		max_bedrooms INTEGER NOT NULL DEFAULT 0,
 		furnished TEXT,
-		area TEXT
+		area TEXT,
+		latitude REAL NOT NULL DEFAULT 0,
+		longitude REAL NOT NULL DEFAULT 0,
+		radius_miles REAL NOT NULL DEFAULT 0,
+		commute_destination TEXT NOT NULL DEFAULT '',
+		commute_latitude REAL NOT NULL DEFAULT 0,
+		commute_longitude REAL NOT NULL DEFAULT 0,
+		max_commute_minutes INTEGER NOT NULL DEFAULT 0,
+		pets TEXT NOT NULL DEFAULT '',
+		quiet_only INTEGER NOT NULL DEFAULT 0,
+		state_owner INTEGER NOT NULL DEFAULT 0,
+		editing TEXT NOT NULL DEFAULT '',
+		history TEXT NOT NULL DEFAULT '',
+		language TEXT NOT NULL DEFAULT '',
+		language_code TEXT NOT NULL DEFAULT '',
+		keywords TEXT NOT NULL DEFAULT '',
+		sort_order TEXT NOT NULL DEFAULT '',
+		delivery TEXT NOT NULL DEFAULT '',
+		digest_time TEXT NOT NULL DEFAULT '',
+		quiet_hours TEXT NOT NULL DEFAULT '',
+		timezone TEXT NOT NULL DEFAULT ''
 	);
 	`
 	_, err := db.Exec(query)
-	return err
+	if err != nil {
+		return err
+	}
+
+	err = db.addMissingColumns("users", []column{
+		{"latitude", "REAL NOT NULL DEFAULT 0"},
+		{"longitude", "REAL NOT NULL DEFAULT 0"},
+		{"radius_miles", "REAL NOT NULL DEFAULT 0"},
+		{"commute_destination", "TEXT NOT NULL DEFAULT ''"},
+		{"commute_latitude", "REAL NOT NULL DEFAULT 0"},
+		{"commute_longitude", "REAL NOT NULL DEFAULT 0"},
+		{"max_commute_minutes", "INTEGER NOT NULL DEFAULT 0"},
+		{"pets", "TEXT NOT NULL DEFAULT ''"},
+		{"quiet_only", "INTEGER NOT NULL DEFAULT 0"},
+		{"state_owner", "INTEGER NOT NULL DEFAULT 0"},
+		{"editing", "TEXT NOT NULL DEFAULT ''"},
+		{"history", "TEXT NOT NULL DEFAULT ''"},
+		{"language", "TEXT NOT NULL DEFAULT ''"},
+		{"language_code", "TEXT NOT NULL DEFAULT ''"},
+		{"max_bedrooms", "INTEGER NOT NULL DEFAULT 0"},
+		{"keywords", "TEXT NOT NULL DEFAULT ''"},
+		{"sort_order", "TEXT NOT NULL DEFAULT ''"},
+		{"delivery", "TEXT NOT NULL DEFAULT ''"},
+		{"digest_time", "TEXT NOT NULL DEFAULT ''"},
+		{"quiet_hours", "TEXT NOT NULL DEFAULT ''"},
+		{"timezone", "TEXT NOT NULL DEFAULT ''"},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = db.createRoommateTables(); err != nil {
+		return err
+	}
+	if err = db.createShortlistTables(); err != nil {
+		return err
+	}
+	if err = db.createBlocklistTable(); err != nil {
+		return err
+	}
+	if err = db.createOutboxTable(); err != nil {
+		return err
+	}
+	return db.createAdminAuditTable()
+}
+
+type column struct {
+	name       string
+	definition string
 }
 
-func (db *DB) SaveUser(chatID int64, state, propertyType, priceRange, bedrooms, furnished, area string) error {
+// addMissingColumns adds columns introduced after a table was first created, so that
+// databases created by older versions of the bot keep working.
+func (db *DB) addMissingColumns(table string, columns []column) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, c := range columns {
+		if existing[c.name] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, c.name, c.definition)); err != nil {
+			return fmt.Errorf("error adding column %s.%s: %w", table, c.name, err)
+		}
+	}
+	return nil
+}
+
+func (db *DB) SaveUser(chatID int64, userData *UserData) error {
 	query := `
-	INSERT INTO users (chat_id, state, property_type, price_range, bedrooms, furnished, area)
-	VALUES (?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO users (chat_id, state, property_type, price_range, bedrooms, max_bedrooms, furnished, area,
+		latitude, longitude, radius_miles,
+		commute_destination, commute_latitude, commute_longitude, max_commute_minutes, pets, quiet_only,
+		state_owner, editing, history, language, language_code, keywords, sort_order,
+		delivery, digest_time, quiet_hours, timezone)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	ON CONFLICT(chat_id) DO UPDATE SET
-		state = ?,
-		property_type = ?,
-		price_range = ?,
-		bedrooms = ?,
-		furnished = ?,
-		area = ?
+		state = excluded.state,
+		property_type = excluded.property_type,
+		price_range = excluded.price_range,
+		bedrooms = excluded.bedrooms,
+		max_bedrooms = excluded.max_bedrooms,
+		furnished = excluded.furnished,
+		area = excluded.area,
+		latitude = excluded.latitude,
+		longitude = excluded.longitude,
+		radius_miles = excluded.radius_miles,
+		commute_destination = excluded.commute_destination,
+		commute_latitude = excluded.commute_latitude,
+		commute_longitude = excluded.commute_longitude,
+		max_commute_minutes = excluded.max_commute_minutes,
+		pets = excluded.pets,
+		quiet_only = excluded.quiet_only,
+		state_owner = excluded.state_owner,
+		editing = excluded.editing,
+		history = excluded.history,
+		language = excluded.language,
+		language_code = excluded.language_code,
+		keywords = excluded.keywords,
+		sort_order = excluded.sort_order,
+		delivery = excluded.delivery,
+		digest_time = excluded.digest_time,
+		quiet_hours = excluded.quiet_hours,
+		timezone = excluded.timezone
 	`
-	_, err := db.Exec(query, chatID, state, propertyType, priceRange, bedrooms, furnished, area,
-		state, propertyType, priceRange, bedrooms, furnished, area)
+	_, err := db.Exec(query, chatID, userData.State, userData.PropertyType, userData.PriceRange,
+		userData.Bedrooms, userData.MaxBedrooms, userData.Furnished, userData.Area,
+		userData.Latitude, userData.Longitude, userData.RadiusMiles,
+		userData.CommuteDestination, userData.CommuteLatitude, userData.CommuteLongitude, userData.MaxCommuteMinutes,
+		userData.Pets, userData.QuietOnly, userData.StateOwner, userData.Editing,
+		strings.Join(userData.History, ","), userData.Language, userData.LanguageCode,
+		strings.Join(userData.Keywords, ","), userData.SortOrder,
+		userData.Delivery, userData.DigestTime, userData.QuietHours, userData.Timezone)
 	return err
 }
 
 func (db *DB) GetUser(chatID int64) (*UserData, error) {
-	query := `SELECT state, property_type, price_range, bedrooms, furnished, area FROM users WHERE chat_id = ?`
+	query := `SELECT state, property_type, price_range, bedrooms, max_bedrooms, furnished, area,
+		latitude, longitude, radius_miles,
+		commute_destination, commute_latitude, commute_longitude, max_commute_minutes, pets, quiet_only,
+		state_owner, editing, history, language, language_code, keywords, sort_order,
+		delivery, digest_time, quiet_hours, timezone FROM users WHERE chat_id = ?`
 	var userData UserData
+	var history, keywords string
 	err := db.QueryRow(query, chatID).Scan(&userData.State, &userData.PropertyType, &userData.PriceRange,
-		&userData.Bedrooms, &userData.Furnished, &userData.Area)
+		&userData.Bedrooms, &userData.MaxBedrooms, &userData.Furnished, &userData.Area,
+		&userData.Latitude, &userData.Longitude, &userData.RadiusMiles,
+		&userData.CommuteDestination, &userData.CommuteLatitude, &userData.CommuteLongitude, &userData.MaxCommuteMinutes,
+		&userData.Pets, &userData.QuietOnly, &userData.StateOwner, &userData.Editing, &history,
+		&userData.Language, &userData.LanguageCode, &keywords, &userData.SortOrder,
+		&userData.Delivery, &userData.DigestTime, &userData.QuietHours, &userData.Timezone)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
 	}
+	if history != "" {
+		userData.History = strings.Split(history, ",")
+	}
+	if keywords != "" {
+		userData.Keywords = strings.Split(keywords, ",")
+	}
 	return &userData, nil
 }
 
@@ -73,6 +230,54 @@ type UserData struct {
 	PropertyType string
 	PriceRange   string
 	Bedrooms     string
-	Furnished    string
-	Area         string
+	// MaxBedrooms caps the number of bedrooms of a range such as "2-3 bed". Zero means
+	// no cap: Bedrooms is the minimum providers search for.
+	MaxBedrooms int
+	Furnished   string
+	Area        string
+	// Latitude and Longitude are the centre of a radius search, set when RadiusMiles > 0.
+	Latitude    float64
+	Longitude   float64
+	RadiusMiles float64
+	// MaxCommuteMinutes limits results by estimated travel time to the commute
+	// destination. Zero means no commute filter.
+	CommuteDestination string
+	CommuteLatitude    float64
+	CommuteLongitude   float64
+	MaxCommuteMinutes  int
+	Pets               string
+	// QuietOnly hides listings with a noise score above noise.QuietScore.
+	QuietOnly bool
+	// Keywords are features such as "garden" that rank listings mentioning them higher.
+	Keywords []string
+	// SortOrder is the order results are shown in, one of ranking.Orders, or "" for the
+	// best match first.
+	SortOrder string
+	// Delivery is how new listings for the saved search are sent, one of delivery.Modes,
+	// or "" for instant alerts.
+	Delivery string
+	// DigestTime is the local time of the daily digest, e.g. "09:00", or "" for
+	// delivery.DefaultDigestTime.
+	DigestTime string
+	// QuietHours holds back instant alerts and hourly digests, e.g. "22:00-07:00", or ""
+	// for none.
+	QuietHours string
+	// Timezone is the IANA time zone of DigestTime and QuietHours, or "" for
+	// delivery.DefaultTimezone.
+	Timezone string
+	// StateOwner is the member answering the current step in a group chat. Answers from
+	// other members are ignored until the step is finished.
+	StateOwner int64
+	// Editing is the preference being changed from the /preferences menu, prefixed with
+	// "draft:" when it belongs to a search typed in plain text, or "" during a full
+	// search setup.
+	Editing string
+	// History holds the states answered before the current one, most recent last, so the
+	// user can go back a step.
+	History []string
+	// Language is the language chosen with /language, or "" to follow LanguageCode.
+	Language string
+	// LanguageCode is the language last reported by the Telegram app of whoever wrote
+	// in the chat, used for messages sent without an update, such as notifications.
+	LanguageCode string
 }
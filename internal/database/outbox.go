@@ -0,0 +1,182 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Notification is a listing queued in a chat's outbox, sent by itself or in a digest.
+type Notification struct {
+	ID        int64
+	ListingID string
+	Address   string
+	Price     int
+	Bedrooms  int
+	URL       string
+	QueuedAt  time.Time
+}
+
+// The outbox holds every listing a chat has been sent or has waiting, so a listing is
+// never alerted twice. Alerts wait with sent_at NULL until the chat's schedule is due.
+// Listings a chat was shown by a search are recorded with alert = 0 so they aren't
+// alerted later, and alerts taken out of the outbox without being sent with dropped = 1.
+func (db *DB) createOutboxTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		listing_id TEXT NOT NULL,
+		address TEXT NOT NULL DEFAULT '',
+		price INTEGER NOT NULL DEFAULT 0,
+		bedrooms INTEGER NOT NULL DEFAULT 0,
+		url TEXT NOT NULL DEFAULT '',
+		alert INTEGER NOT NULL DEFAULT 1,
+		dropped INTEGER NOT NULL DEFAULT 0,
+		queued_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		sent_at DATETIME,
+		UNIQUE (chat_id, listing_id)
+	);
+	CREATE INDEX IF NOT EXISTS outbox_pending ON outbox (chat_id) WHERE sent_at IS NULL;
+	`
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+	return db.addMissingColumns("outbox", []column{
+		{"dropped", "INTEGER NOT NULL DEFAULT 0"},
+	})
+}
+
+// QueueNotifications adds listings to a chat's outbox to be alerted, skipping those it
+// has already been sent or has waiting. It returns how many were queued.
+func (db *DB) QueueNotifications(chatID int64, notifications []Notification) (int, error) {
+	return db.addNotifications(chatID, notifications, true, sql.NullTime{})
+}
+
+// RecordShown records listings a search has shown the chat at the given time, so they
+// aren't alerted later.
+func (db *DB) RecordShown(chatID int64, notifications []Notification, at time.Time) error {
+	_, err := db.addNotifications(chatID, notifications, false, sql.NullTime{Time: at.UTC(), Valid: true})
+	return err
+}
+
+func (db *DB) addNotifications(chatID int64, notifications []Notification, alert bool, sentAt sql.NullTime) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT OR IGNORE INTO outbox (chat_id, listing_id, address, price, bedrooms, url, alert, queued_at, sent_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	added := 0
+	now := time.Now().UTC()
+	for _, n := range notifications {
+		result, err := tx.Exec(query, chatID, n.ListingID, n.Address, n.Price, n.Bedrooms, n.URL, alert, now, sentAt)
+		if err != nil {
+			return 0, err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		added += int(rows)
+	}
+	return added, tx.Commit()
+}
+
+// PendingNotifications returns the alerts waiting in a chat's outbox, oldest first.
+func (db *DB) PendingNotifications(chatID int64) ([]Notification, error) {
+	query := `
+	SELECT id, listing_id, address, price, bedrooms, url, queued_at FROM outbox
+	WHERE chat_id = ? AND sent_at IS NULL ORDER BY id
+	`
+	rows, err := db.Query(query, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.ListingID, &n.Address, &n.Price, &n.Bedrooms, &n.URL, &n.QueuedAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// ChatsWithPendingNotifications returns the chats with alerts waiting in their outbox.
+func (db *DB) ChatsWithPendingNotifications() ([]int64, error) {
+	rows, err := db.Query(`SELECT DISTINCT chat_id FROM outbox WHERE sent_at IS NULL ORDER BY chat_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// LastAlertSent returns when the chat was last sent an alert or digest, zero if never.
+// Dropped alerts don't count.
+func (db *DB) LastAlertSent(chatID int64) (time.Time, error) {
+	query := `
+	SELECT sent_at FROM outbox WHERE chat_id = ? AND alert = 1 AND dropped = 0 AND sent_at IS NOT NULL
+	ORDER BY sent_at DESC LIMIT 1
+	`
+	var sentAt sql.NullTime
+	err := db.QueryRow(query, chatID).Scan(&sentAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return sentAt.Time, nil
+}
+
+// MarkSent takes notifications out of the outbox as sent at the given time.
+func (db *DB) MarkSent(ids []int64, at time.Time) error {
+	return db.takeNotifications(ids, at, false)
+}
+
+// DropNotifications takes alerts out of the outbox without sending them, e.g. when the
+// user turns alerts off, so they aren't alerted later. They are pruned like sent ones.
+func (db *DB) DropNotifications(ids []int64, at time.Time) error {
+	return db.takeNotifications(ids, at, true)
+}
+
+func (db *DB) takeNotifications(ids []int64, at time.Time, dropped bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := []any{at.UTC(), dropped}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	_, err := db.Exec(`UPDATE outbox SET sent_at = ?, dropped = ? WHERE id IN (`+placeholders+`)`, args...)
+	return err
+}
+
+// PruneNotifications deletes notifications sent before the given time. Providers stop
+// returning old listings, so there is no need to remember them for ever.
+func (db *DB) PruneNotifications(before time.Time) (int64, error) {
+	result, err := db.Exec(`DELETE FROM outbox WHERE sent_at IS NOT NULL AND sent_at < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := NewDB(filepath.Join(t.TempDir(), "bot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestDroppedAlertsArentSent(t *testing.T) {
+	db := newTestDB(t)
+	const chatID = 1
+	sent := time.Date(2026, time.March, 10, 9, 0, 0, 0, time.UTC)
+	dropped := sent.Add(time.Hour)
+
+	if _, err := db.QueueNotifications(chatID, []Notification{{ListingID: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := db.PendingNotifications(chatID)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("PendingNotifications() = %v, %v", pending, err)
+	}
+	if err := db.MarkSent([]int64{pending[0].ID}, sent); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.QueueNotifications(chatID, []Notification{{ListingID: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	pending, err = db.PendingNotifications(chatID)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("PendingNotifications() = %v, %v", pending, err)
+	}
+	if err := db.DropNotifications([]int64{pending[0].ID}, dropped); err != nil {
+		t.Fatal(err)
+	}
+
+	if pending, err := db.PendingNotifications(chatID); err != nil || len(pending) != 0 {
+		t.Errorf("PendingNotifications() after dropping = %v, %v, want none", pending, err)
+	}
+	last, err := db.LastAlertSent(chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !last.Equal(sent) {
+		t.Errorf("LastAlertSent() = %v, want %v: dropped alerts don't count", last, sent)
+	}
+	// A dropped listing isn't queued again
+	if queued, err := db.QueueNotifications(chatID, []Notification{{ListingID: "b"}}); err != nil || queued != 0 {
+		t.Errorf("QueueNotifications() of a dropped listing = %d, %v, want 0", queued, err)
+	}
+}
@@ -0,0 +1,254 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"time"
+)
+
+// Roommate match decisions.
+const (
+	MatchPending  = "pending"
+	MatchAccepted = "accepted"
+	MatchDeclined = "declined"
+)
+
+type RoommateProfile struct {
+	ChatID    int64
+	Username  string
+	FirstName string
+	// Active is set once the profile is complete and the user has opted in to matching.
+	Active    bool
+	MinBudget int
+	MaxBudget int
+	// Areas holds canonical gazetteer names separated by commas.
+	Areas        string
+	MoveIn       time.Time
+	Smoker       bool
+	HasPets      bool
+	WorkFromHome string
+	Cleanliness  int
+}
+
+// RoommateMatch records both sides' decisions about a proposed pair. UserA is always
+// the lower chat ID so each pair is stored once.
+type RoommateMatch struct {
+	// ID is a random identifier for the pair, used in buttons instead of chat IDs.
+	ID      string
+	UserA   int64
+	UserB   int64
+	StatusA string
+	StatusB string
+}
+
+func (db *DB) createRoommateTables() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS roommate_profiles (
+		chat_id INTEGER PRIMARY KEY,
+		username TEXT NOT NULL DEFAULT '',
+		first_name TEXT NOT NULL DEFAULT '',
+		active INTEGER NOT NULL DEFAULT 0,
+		min_budget INTEGER NOT NULL DEFAULT 0,
+		max_budget INTEGER NOT NULL DEFAULT 0,
+		areas TEXT NOT NULL DEFAULT '',
+		move_in DATETIME,
+		smoker INTEGER NOT NULL DEFAULT 0,
+		has_pets INTEGER NOT NULL DEFAULT 0,
+		work_from_home TEXT NOT NULL DEFAULT '',
+		cleanliness INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE IF NOT EXISTS roommate_matches (
+		id TEXT NOT NULL DEFAULT '',
+		user_a INTEGER NOT NULL,
+		user_b INTEGER NOT NULL,
+		status_a TEXT NOT NULL DEFAULT 'pending',
+		status_b TEXT NOT NULL DEFAULT 'pending',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_a, user_b)
+	);
+	`
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+	if err := db.addMissingColumns("roommate_matches", []column{{"id", "TEXT NOT NULL DEFAULT ''"}}); err != nil {
+		return err
+	}
+	_, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS roommate_matches_id ON roommate_matches (id) WHERE id != ''`)
+	return err
+}
+
+func (db *DB) SaveRoommateProfile(profile *RoommateProfile) error {
+	query := `
+	INSERT INTO roommate_profiles (chat_id, username, first_name, active, min_budget, max_budget, areas,
+		move_in, smoker, has_pets, work_from_home, cleanliness)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(chat_id) DO UPDATE SET
+		username = excluded.username,
+		first_name = excluded.first_name,
+		active = excluded.active,
+		min_budget = excluded.min_budget,
+		max_budget = excluded.max_budget,
+		areas = excluded.areas,
+		move_in = excluded.move_in,
+		smoker = excluded.smoker,
+		has_pets = excluded.has_pets,
+		work_from_home = excluded.work_from_home,
+		cleanliness = excluded.cleanliness
+	`
+	var moveIn sql.NullTime
+	if !profile.MoveIn.IsZero() {
+		moveIn = sql.NullTime{Time: profile.MoveIn, Valid: true}
+	}
+	_, err := db.Exec(query, profile.ChatID, profile.Username, profile.FirstName, profile.Active,
+		profile.MinBudget, profile.MaxBudget, profile.Areas, moveIn, profile.Smoker, profile.HasPets,
+		profile.WorkFromHome, profile.Cleanliness)
+	return err
+}
+
+const roommateProfileColumns = `chat_id, username, first_name, active, min_budget, max_budget, areas,
+	move_in, smoker, has_pets, work_from_home, cleanliness`
+
+func scanRoommateProfile(row interface{ Scan(...any) error }) (*RoommateProfile, error) {
+	var profile RoommateProfile
+	var moveIn sql.NullTime
+	err := row.Scan(&profile.ChatID, &profile.Username, &profile.FirstName, &profile.Active,
+		&profile.MinBudget, &profile.MaxBudget, &profile.Areas, &moveIn, &profile.Smoker, &profile.HasPets,
+		&profile.WorkFromHome, &profile.Cleanliness)
+	if err != nil {
+		return nil, err
+	}
+	profile.MoveIn = moveIn.Time
+	return &profile, nil
+}
+
+// GetRoommateProfile returns the user's roommate profile, or nil if they never started one.
+func (db *DB) GetRoommateProfile(chatID int64) (*RoommateProfile, error) {
+	query := `SELECT ` + roommateProfileColumns + ` FROM roommate_profiles WHERE chat_id = ?`
+	profile, err := scanRoommateProfile(db.QueryRow(query, chatID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return profile, nil
+}
+
+// ActiveRoommateProfiles returns every opted-in profile except the given user's.
+func (db *DB) ActiveRoommateProfiles(excludeChatID int64) ([]RoommateProfile, error) {
+	query := `SELECT ` + roommateProfileColumns + ` FROM roommate_profiles WHERE active = 1 AND chat_id != ?`
+	rows, err := db.Query(query, excludeChatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var profiles []RoommateProfile
+	for rows.Next() {
+		profile, err := scanRoommateProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, *profile)
+	}
+	return profiles, rows.Err()
+}
+
+const roommateMatchColumns = `id, user_a, user_b, status_a, status_b`
+
+func scanRoommateMatch(row *sql.Row) (*RoommateMatch, error) {
+	var match RoommateMatch
+	err := row.Scan(&match.ID, &match.UserA, &match.UserB, &match.StatusA, &match.StatusB)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &match, nil
+}
+
+// GetRoommateMatch returns the decisions recorded for a pair, or nil if the pair was
+// never proposed.
+func (db *DB) GetRoommateMatch(chatID, otherID int64) (*RoommateMatch, error) {
+	a, b := orderPair(chatID, otherID)
+	query := `SELECT ` + roommateMatchColumns + ` FROM roommate_matches WHERE user_a = ? AND user_b = ?`
+	return scanRoommateMatch(db.QueryRow(query, a, b))
+}
+
+// GetRoommateMatchByID returns the pair with the given ID, or nil if there is none.
+func (db *DB) GetRoommateMatchByID(id string) (*RoommateMatch, error) {
+	if id == "" {
+		return nil, nil
+	}
+	query := `SELECT ` + roommateMatchColumns + ` FROM roommate_matches WHERE id = ?`
+	return scanRoommateMatch(db.QueryRow(query, id))
+}
+
+// ProposeRoommateMatch records that the pair has been proposed, giving it an ID if it has
+// none yet, and returns it. Decisions already made are kept.
+func (db *DB) ProposeRoommateMatch(chatID, otherID int64) (*RoommateMatch, error) {
+	a, b := orderPair(chatID, otherID)
+	query := `
+	INSERT INTO roommate_matches (id, user_a, user_b) VALUES (?, ?, ?)
+	ON CONFLICT(user_a, user_b) DO UPDATE SET id = excluded.id WHERE id = ''`
+	if _, err := db.Exec(query, newMatchID(), a, b); err != nil {
+		return nil, err
+	}
+	return db.GetRoommateMatch(chatID, otherID)
+}
+
+// SaveRoommateDecision records chatID's decision about the proposed pair with the given ID
+// and returns the updated pair. It returns nil, and records nothing, if there is no such
+// pair or chatID isn't part of it.
+func (db *DB) SaveRoommateDecision(matchID string, chatID int64, status string) (*RoommateMatch, error) {
+	match, err := db.GetRoommateMatchByID(matchID)
+	if err != nil || match == nil || !match.Includes(chatID) {
+		return nil, err
+	}
+	column := "status_a"
+	if chatID == match.UserB {
+		column = "status_b"
+	}
+	query := `UPDATE roommate_matches SET ` + column + ` = ? WHERE id = ?`
+	if _, err := db.Exec(query, status, matchID); err != nil {
+		return nil, err
+	}
+	return db.GetRoommateMatchByID(matchID)
+}
+
+// Includes reports whether chatID is one side of the pair.
+func (m *RoommateMatch) Includes(chatID int64) bool {
+	return chatID == m.UserA || chatID == m.UserB
+}
+
+// Other returns the side of the pair that isn't chatID.
+func (m *RoommateMatch) Other(chatID int64) int64 {
+	if chatID == m.UserA {
+		return m.UserB
+	}
+	return m.UserA
+}
+
+// StatusOf returns the decision made by the given side of the pair.
+func (m *RoommateMatch) StatusOf(chatID int64) string {
+	if chatID == m.UserA {
+		return m.StatusA
+	}
+	return m.StatusB
+}
+
+func orderPair(x, y int64) (int64, int64) {
+	if x < y {
+		return x, y
+	}
+	return y, x
+}
+
+// newMatchID returns a random ID that reveals nothing about the pair.
+func newMatchID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,50 @@
+package database
+
+import "testing"
+
+func TestRoommateDecisionsNeedAProposedMatch(t *testing.T) {
+	db := newTestDB(t)
+
+	// Without a proposal there is nothing to decide on
+	if match, err := db.SaveRoommateDecision("", 1, MatchAccepted); err != nil || match != nil {
+		t.Fatalf("SaveRoommateDecision() without a match = %+v, %v; want nil", match, err)
+	}
+
+	match, err := db.ProposeRoommateMatch(2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match.ID == "" || match.UserA != 1 || match.UserB != 2 {
+		t.Fatalf("ProposeRoommateMatch() = %+v, want an ID and the pair in order", match)
+	}
+	if again, err := db.ProposeRoommateMatch(1, 2); err != nil || again.ID != match.ID {
+		t.Errorf("proposing the pair again gave ID %q, want %q", again.ID, match.ID)
+	}
+
+	// Someone outside the pair can't decide for it
+	if decided, err := db.SaveRoommateDecision(match.ID, 3, MatchAccepted); err != nil || decided != nil {
+		t.Errorf("SaveRoommateDecision() by an outsider = %+v, %v; want nil", decided, err)
+	}
+
+	decided, err := db.SaveRoommateDecision(match.ID, 2, MatchAccepted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decided.StatusOf(2) != MatchAccepted || decided.StatusOf(1) != MatchPending {
+		t.Errorf("after user 2 accepted the match is %+v", decided)
+	}
+	if decided.Other(2) != 1 || decided.Other(1) != 2 {
+		t.Errorf("Other() doesn't give the other side of %+v", decided)
+	}
+
+	// Proposing again keeps the decisions made
+	if again, _ := db.ProposeRoommateMatch(1, 2); again.StatusOf(2) != MatchAccepted {
+		t.Errorf("proposing again reset the decisions to %+v", again)
+	}
+	if byID, err := db.GetRoommateMatchByID(match.ID); err != nil || byID == nil || byID.StatusOf(2) != MatchAccepted {
+		t.Errorf("GetRoommateMatchByID() = %+v, %v", byID, err)
+	}
+	if unknown, err := db.GetRoommateMatchByID("0123456789abcdef"); err != nil || unknown != nil {
+		t.Errorf("GetRoommateMatchByID() for an unknown ID = %+v, %v; want nil", unknown, err)
+	}
+}
@@ -0,0 +1,102 @@
+package database
+
+// ShortlistEntry is a listing shown in a group chat, with the group's votes.
+type ShortlistEntry struct {
+	ListingID string
+	Address   string
+	Price     int
+	Bedrooms  int
+	URL       string
+	Up        int
+	Down      int
+}
+
+func (db *DB) createShortlistTables() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS shortlist (
+		chat_id INTEGER NOT NULL,
+		listing_id TEXT NOT NULL,
+		address TEXT NOT NULL DEFAULT '',
+		price INTEGER NOT NULL DEFAULT 0,
+		bedrooms INTEGER NOT NULL DEFAULT 0,
+		url TEXT NOT NULL DEFAULT '',
+		added_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (chat_id, listing_id)
+	);
+	CREATE TABLE IF NOT EXISTS votes (
+		chat_id INTEGER NOT NULL,
+		listing_id TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		vote INTEGER NOT NULL,
+		PRIMARY KEY (chat_id, listing_id, user_id)
+	);
+	`
+	_, err := db.Exec(query)
+	return err
+}
+
+// AddToShortlist stores a listing shown in a chat so it can be voted on and tallied later.
+func (db *DB) AddToShortlist(chatID int64, entry ShortlistEntry) error {
+	query := `
+	INSERT INTO shortlist (chat_id, listing_id, address, price, bedrooms, url)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(chat_id, listing_id) DO UPDATE SET
+		address = excluded.address,
+		price = excluded.price,
+		bedrooms = excluded.bedrooms,
+		url = excluded.url
+	`
+	_, err := db.Exec(query, chatID, entry.ListingID, entry.Address, entry.Price, entry.Bedrooms, entry.URL)
+	return err
+}
+
+// SaveVote records a member's vote on a listing, replacing any earlier vote. Vote is 1 or -1.
+func (db *DB) SaveVote(chatID int64, listingID string, userID int64, vote int) error {
+	query := `
+	INSERT INTO votes (chat_id, listing_id, user_id, vote) VALUES (?, ?, ?, ?)
+	ON CONFLICT(chat_id, listing_id, user_id) DO UPDATE SET vote = excluded.vote
+	`
+	_, err := db.Exec(query, chatID, listingID, userID, vote)
+	return err
+}
+
+// VoteCounts returns the number of up and down votes on a listing.
+func (db *DB) VoteCounts(chatID int64, listingID string) (int, int, error) {
+	query := `
+	SELECT COALESCE(SUM(vote > 0), 0), COALESCE(SUM(vote < 0), 0)
+	FROM votes WHERE chat_id = ? AND listing_id = ?
+	`
+	var up, down int
+	err := db.QueryRow(query, chatID, listingID).Scan(&up, &down)
+	return up, down, err
+}
+
+// Tally returns the chat's shortlisted listings that have votes, ranked by net votes.
+func (db *DB) Tally(chatID int64, limit int) ([]ShortlistEntry, error) {
+	query := `
+	SELECT s.listing_id, s.address, s.price, s.bedrooms, s.url,
+		SUM(v.vote > 0) AS up, SUM(v.vote < 0) AS down
+	FROM shortlist s
+	JOIN votes v ON v.chat_id = s.chat_id AND v.listing_id = s.listing_id
+	WHERE s.chat_id = ?
+	GROUP BY s.listing_id
+	ORDER BY up - down DESC, up DESC, s.price ASC
+	LIMIT ?
+	`
+	rows, err := db.Query(query, chatID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []ShortlistEntry
+	for rows.Next() {
+		var entry ShortlistEntry
+		if err := rows.Scan(&entry.ListingID, &entry.Address, &entry.Price, &entry.Bedrooms, &entry.URL,
+			&entry.Up, &entry.Down); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
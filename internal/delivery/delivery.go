@@ -0,0 +1,192 @@
+// Package delivery decides when queued listing alerts may be sent, following each user's
+// choice of instant alerts or hourly or daily digests, their quiet hours and time zone.
+package delivery
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	// Embed the time zone database so zones load in containers without one
+	_ "time/tzdata"
+)
+
+// Delivery modes. The values are stored in the users table, so they must not change.
+const (
+	Instant = "instant"
+	Hourly  = "hourly"
+	Daily   = "daily"
+	Off     = "off"
+)
+
+// Modes lists the delivery modes in the order they are offered.
+var Modes = []string{Instant, Hourly, Daily, Off}
+
+const (
+	// DefaultDigestTime is when daily digests are sent unless the user picks a time.
+	DefaultDigestTime = "09:00"
+	// DefaultTimezone is the time zone of users who haven't set one, as the listings
+	// are in the UK.
+	DefaultTimezone = "Europe/London"
+)
+
+const minutesPerDay = 24 * 60
+
+// Schedule is a user's delivery preference.
+type Schedule struct {
+	// Mode is one of Modes.
+	Mode string
+	// DigestAt is the local time daily digests are sent at, in minutes after midnight.
+	DigestAt int
+	// QuietStart and QuietEnd are the local times quiet hours start and end at, in
+	// minutes after midnight. Equal times mean no quiet hours.
+	QuietStart int
+	QuietEnd   int
+	Location   *time.Location
+}
+
+// NewSchedule reads a schedule as stored with a user. Empty or invalid settings fall
+// back to instant alerts, DefaultDigestTime, no quiet hours and DefaultTimezone.
+func NewSchedule(mode, digestTime, quietHours, timezone string) Schedule {
+	s := Schedule{Mode: Instant, Location: defaultLocation()}
+	switch mode {
+	case Hourly, Daily, Off:
+		s.Mode = mode
+	}
+	s.DigestAt, _ = ParseClock(DefaultDigestTime)
+	if at, err := ParseClock(digestTime); err == nil {
+		s.DigestAt = at
+	}
+	if start, end, err := ParseQuietHours(quietHours); err == nil {
+		s.QuietStart, s.QuietEnd = start, end
+	}
+	if location, err := LoadTimezone(timezone); err == nil {
+		s.Location = location
+	}
+	return s
+}
+
+// defaultLocation loads DefaultTimezone, falling back to UTC.
+func defaultLocation() *time.Location {
+	location, err := time.LoadLocation(DefaultTimezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// Quiet reports whether t falls in the quiet hours, which may run past midnight.
+func (s Schedule) Quiet(t time.Time) bool {
+	if s.QuietStart == s.QuietEnd {
+		return false
+	}
+	local := t.In(s.Location)
+	minute := local.Hour()*60 + local.Minute()
+	if s.QuietStart < s.QuietEnd {
+		return minute >= s.QuietStart && minute < s.QuietEnd
+	}
+	return minute >= s.QuietStart || minute < s.QuietEnd
+}
+
+// Due reports whether the alerts waiting in the outbox may be sent at now. last is when
+// the chat was last sent an alert or digest, zero if never, and queued is when the oldest
+// alert waiting was queued. Nothing is sent in quiet hours, whatever the mode: alerts
+// wait until they end. Instant alerts go out straight away and hourly digests at most
+// once per clock hour. A daily digest goes out once the chosen time has passed since the
+// oldest alert was queued, so alerts queued after one day's digest wait for the next
+// day's, however long it is since the last one. Nothing is due when alerts are off.
+func (s Schedule) Due(now, last, queued time.Time) bool {
+	if s.Mode == Off || s.Quiet(now) {
+		return false
+	}
+	local := now.In(s.Location)
+	switch s.Mode {
+	case Daily:
+		slot := time.Date(local.Year(), local.Month(), local.Day(), s.DigestAt/60, s.DigestAt%60, 0, 0, s.Location)
+		if local.Before(slot) {
+			slot = slot.AddDate(0, 0, -1)
+		}
+		return queued.Before(slot)
+	case Hourly:
+		hour := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, s.Location)
+		return last.Before(hour)
+	default:
+		return true
+	}
+}
+
+// ParseClock reads a time of day such as "7", "07:30" or "7.30" as minutes after midnight.
+func ParseClock(text string) (int, error) {
+	text = strings.TrimSpace(text)
+	hours, minutes, found := strings.Cut(strings.ReplaceAll(text, ".", ":"), ":")
+	h, err := strconv.Atoi(hours)
+	if err != nil || h < 0 || h > 23 {
+		return 0, fmt.Errorf("invalid time %q", text)
+	}
+	m := 0
+	if found {
+		m, err = strconv.Atoi(minutes)
+		if err != nil || len(minutes) != 2 || m < 0 || m > 59 {
+			return 0, fmt.Errorf("invalid time %q", text)
+		}
+	}
+	return h*60 + m, nil
+}
+
+// FormatClock writes minutes after midnight as a 24-hour time, e.g. "07:30".
+func FormatClock(minutes int) string {
+	minutes = (minutes%minutesPerDay + minutesPerDay) % minutesPerDay
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// ParseQuietHours reads quiet hours such as "22-7" or "22:00 - 07:30" as the minutes
+// after midnight they start and end at.
+func ParseQuietHours(text string) (int, int, error) {
+	from, to, found := strings.Cut(strings.NewReplacer("–", "-", "—", "-").Replace(text), "-")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid quiet hours %q", text)
+	}
+	start, err := ParseClock(from)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := ParseClock(to)
+	if err != nil {
+		return 0, 0, err
+	}
+	if start == end {
+		return 0, 0, fmt.Errorf("quiet hours %q start and end at the same time", text)
+	}
+	return start, end, nil
+}
+
+// FormatQuietHours writes quiet hours as stored with a user, e.g. "22:00-07:00".
+func FormatQuietHours(start, end int) string {
+	return FormatClock(start) + "-" + FormatClock(end)
+}
+
+// LoadTimezone loads an IANA time zone such as "Europe/Warsaw", whatever its case.
+func LoadTimezone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.EqualFold(name, "Local") {
+		return nil, fmt.Errorf("invalid time zone %q", name)
+	}
+	// Zone names are case sensitive: also try "america/new_york" as "America/New_York",
+	// and "utc" as "UTC"
+	parts := strings.Split(strings.ToLower(name), "/")
+	for i, part := range parts {
+		words := strings.Split(part, "_")
+		for j, word := range words {
+			if word != "" {
+				words[j] = strings.ToUpper(word[:1]) + word[1:]
+			}
+		}
+		parts[i] = strings.Join(words, "_")
+	}
+	for _, candidate := range []string{name, strings.Join(parts, "/"), strings.ToUpper(name)} {
+		if location, err := time.LoadLocation(candidate); err == nil {
+			return location, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown time zone %q", name)
+}
@@ -0,0 +1,53 @@
+package delivery
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDue(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.March, day, hour, minute, 0, 0, london)
+	}
+	var never time.Time
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		now      time.Time
+		last     time.Time
+		queued   time.Time
+		want     bool
+	}{
+		{name: "instant", schedule: NewSchedule(Instant, "", "", ""), now: at(10, 14, 0), queued: at(10, 13, 59), want: true},
+		{name: "instant in quiet hours", schedule: NewSchedule(Instant, "", "22-7", ""), now: at(10, 23, 0), queued: at(10, 22, 30), want: false},
+		{name: "instant after quiet hours", schedule: NewSchedule(Instant, "", "22-7", ""), now: at(11, 7, 0), queued: at(10, 22, 30), want: true},
+		{name: "off", schedule: NewSchedule(Off, "", "", ""), now: at(10, 14, 0), queued: at(10, 9, 0), want: false},
+
+		{name: "hourly first", schedule: NewSchedule(Hourly, "", "", ""), now: at(10, 14, 5), last: never, queued: at(10, 14, 1), want: true},
+		{name: "hourly sent this hour", schedule: NewSchedule(Hourly, "", "", ""), now: at(10, 14, 50), last: at(10, 14, 5), queued: at(10, 14, 20), want: false},
+		{name: "hourly next hour", schedule: NewSchedule(Hourly, "", "", ""), now: at(10, 15, 0), last: at(10, 14, 5), queued: at(10, 14, 20), want: true},
+		{name: "hourly in quiet hours", schedule: NewSchedule(Hourly, "", "22-7", ""), now: at(11, 3, 0), last: at(10, 21, 0), queued: at(10, 22, 20), want: false},
+
+		{name: "daily first digest before the time", schedule: NewSchedule(Daily, "09:00", "", ""), now: at(10, 15, 0), last: never, queued: at(10, 14, 0), want: false},
+		{name: "daily first digest at the time", schedule: NewSchedule(Daily, "09:00", "", ""), now: at(11, 9, 0), last: never, queued: at(10, 14, 0), want: true},
+		{name: "daily after an empty day", schedule: NewSchedule(Daily, "09:00", "", ""), now: at(12, 15, 0), last: at(10, 9, 0), queued: at(12, 14, 0), want: false},
+		{name: "daily next morning after an empty day", schedule: NewSchedule(Daily, "09:00", "", ""), now: at(13, 9, 1), last: at(10, 9, 0), queued: at(12, 14, 0), want: true},
+		{name: "daily queued just after the time", schedule: NewSchedule(Daily, "09:00", "", ""), now: at(10, 9, 30), last: at(10, 9, 0), queued: at(10, 9, 1), want: false},
+		{name: "daily missed while down", schedule: NewSchedule(Daily, "09:00", "", ""), now: at(11, 20, 0), last: at(9, 9, 0), queued: at(9, 18, 0), want: true},
+		{name: "daily time in quiet hours", schedule: NewSchedule(Daily, "06:00", "22-7", ""), now: at(11, 6, 30), queued: at(10, 12, 0), want: false},
+		{name: "daily held until quiet hours end", schedule: NewSchedule(Daily, "06:00", "22-7", ""), now: at(11, 7, 0), queued: at(10, 12, 0), want: true},
+		{name: "daily in the user's time zone", schedule: NewSchedule(Daily, "09:00", "", "Asia/Tokyo"), now: at(11, 0, 30), queued: at(10, 12, 0), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.Due(tt.now, tt.last, tt.queued); got != tt.want {
+				t.Errorf("Due(%v, %v, %v) = %v, want %v", tt.now, tt.last, tt.queued, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+// Package fsm implements a small declarative finite-state machine for guided
+// conversations. It knows nothing about Telegram: inputs are plain values and prompts
+// describe the text and buttons to show, so flows can be exercised without a bot.
+package fsm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// State names a step of a conversation.
+type State string
+
+// Idle is the state of a conversation that isn't waiting for an answer.
+const Idle State = ""
+
+var (
+	// ErrUnknownState is returned for a state that isn't part of the machine.
+	ErrUnknownState = errors.New("unknown state")
+	// ErrUnexpectedInput is returned when the current state doesn't accept this kind of
+	// input or this button, for example a button pressed on an old message.
+	ErrUnexpectedInput = errors.New("input not accepted in this state")
+	// ErrInvalidTransition is returned when a handler moves to a state it doesn't list in Next.
+	ErrInvalidTransition = errors.New("transition not allowed")
+)
+
+// Button is an inline button shown with a prompt.
+type Button struct {
+	Label string
+	Data  string
+}
+
+// Prompt is the message shown when entering a state, or when an answer is rejected.
+// Prompts without buttons are answered by typing.
+type Prompt struct {
+	Text    string
+	Buttons [][]Button
+}
+
+// Location is a point shared by the user.
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Input is a single answer from the user: typed text, the data of a pressed button or a
+// shared location. Exactly one of them is set.
+type Input struct {
+	Text     string
+	Data     string
+	Location *Location
+}
+
+// Rejection is returned by handlers when an answer is invalid. The conversation stays in
+// the current state and the rejection prompt is shown to the user.
+type Rejection struct {
+	Prompt Prompt
+}
+
+func (r *Rejection) Error() string {
+	return r.Prompt.Text
+}
+
+// Reject builds a Rejection with the given text and optional button rows.
+func Reject(text string, buttons ...[]Button) error {
+	return &Rejection{Prompt: Prompt{Text: text, Buttons: buttons}}
+}
+
+// Outcome is the result of handling an input.
+type Outcome struct {
+	Next State
+	// Notice is an optional message shown before the next state's prompt.
+	Notice string
+}
+
+// Go moves to the next state.
+func Go(next State) Outcome {
+	return Outcome{Next: next}
+}
+
+// GoWithNotice moves to the next state after showing a notice.
+func GoWithNotice(next State, notice string) Outcome {
+	return Outcome{Next: next, Notice: notice}
+}
+
+// Handler validates an input and applies it to the conversation data. Handlers must not
+// modify data when returning an error.
+type Handler[T any] func(data T, in Input) (Outcome, error)
+
+// Step declares how a state is entered and which inputs it accepts. A nil handler means
+// the state doesn't accept that kind of input.
+type Step[T any] struct {
+	// Prompt returns the message shown when entering the state. It may be nil for states
+	// that are processed by the caller without asking anything, such as running a search.
+	Prompt     func(data T) Prompt
+	OnText     Handler[T]
+	OnButton   Handler[T]
+	OnLocation Handler[T]
+	// Next lists the states the handlers may move to.
+	Next []State
+}
+
+// Machine is a set of steps keyed by state.
+type Machine[T any] struct {
+	steps map[State]Step[T]
+}
+
+// New builds a machine, checking that every transition leads to a declared state.
+func New[T any](steps map[State]Step[T]) (*Machine[T], error) {
+	for state, step := range steps {
+		for _, next := range step.Next {
+			if _, ok := steps[next]; !ok {
+				return nil, fmt.Errorf("%w: %q lists undeclared next state %q", ErrUnknownState, state, next)
+			}
+		}
+	}
+	return &Machine[T]{steps: steps}, nil
+}
+
+// MustNew is like New but panics on an invalid definition. It is meant for package level
+// machines whose definitions are fixed at compile time.
+func MustNew[T any](steps map[State]Step[T]) *Machine[T] {
+	m, err := New(steps)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Has reports whether the state is part of the machine.
+func (m *Machine[T]) Has(state State) bool {
+	_, ok := m.steps[state]
+	return ok
+}
+
+// Handle applies an input in the given state and returns the outcome. On error the
+// conversation should stay in the current state.
+func (m *Machine[T]) Handle(state State, data T, in Input) (Outcome, error) {
+	step, ok := m.steps[state]
+	if !ok {
+		return Outcome{Next: state}, fmt.Errorf("%w: %q", ErrUnknownState, state)
+	}
+
+	var handler Handler[T]
+	switch {
+	case in.Location != nil:
+		handler = step.OnLocation
+	case in.Data != "":
+		handler = step.OnButton
+	default:
+		handler = step.OnText
+	}
+	if handler == nil {
+		return Outcome{Next: state}, ErrUnexpectedInput
+	}
+
+	outcome, err := handler(data, in)
+	if err != nil {
+		return Outcome{Next: state}, err
+	}
+	if !m.allowed(step, outcome.Next) {
+		return Outcome{Next: state}, fmt.Errorf("%w: %q -> %q", ErrInvalidTransition, state, outcome.Next)
+	}
+	return outcome, nil
+}
+
+// Prompt returns the prompt for entering a state, and false if the state has none.
+func (m *Machine[T]) Prompt(state State, data T) (Prompt, bool) {
+	step, ok := m.steps[state]
+	if !ok || step.Prompt == nil {
+		return Prompt{}, false
+	}
+	return step.Prompt(data), true
+}
+
+func (m *Machine[T]) allowed(step Step[T], next State) bool {
+	for _, s := range step.Next {
+		if s == next {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+)
+
+const (
+	stateName  State = "name"
+	stateColor State = "color"
+	statePlace State = "place"
+)
+
+type answers struct {
+	Name  string
+	Color string
+	Lat   float64
+}
+
+// newTestMachine asks for a name by text, a colour by button and a place by location.
+func newTestMachine(t *testing.T) *Machine[*answers] {
+	t.Helper()
+	m, err := New(map[State]Step[*answers]{
+		Idle: {
+			OnButton: func(a *answers, in Input) (Outcome, error) {
+				if in.Data != "go" {
+					return Outcome{}, ErrUnexpectedInput
+				}
+				return Go(stateName), nil
+			},
+			Next: []State{stateName},
+		},
+		stateName: {
+			Prompt: func(a *answers) Prompt { return Prompt{Text: "Name?"} },
+			OnText: func(a *answers, in Input) (Outcome, error) {
+				if in.Text == "" {
+					return Outcome{}, Reject("Please type a name", []Button{{Label: "Skip", Data: "skip"}})
+				}
+				a.Name = in.Text
+				return Go(stateColor), nil
+			},
+			Next: []State{stateColor},
+		},
+		stateColor: {
+			Prompt: func(a *answers) Prompt {
+				return Prompt{Text: "Colour, " + a.Name + "?", Buttons: [][]Button{{{Label: "Red", Data: "red"}}}}
+			},
+			OnButton: func(a *answers, in Input) (Outcome, error) {
+				if in.Data == "jump" {
+					// Not listed in Next
+					return Go(Idle), nil
+				}
+				a.Color = in.Data
+				return GoWithNotice(statePlace, "Nice colour"), nil
+			},
+			Next: []State{statePlace},
+		},
+		statePlace: {
+			OnLocation: func(a *answers, in Input) (Outcome, error) {
+				a.Lat = in.Location.Latitude
+				return Go(Idle), nil
+			},
+			Next: []State{Idle},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestNewRejectsUndeclaredNextState(t *testing.T) {
+	_, err := New(map[State]Step[int]{
+		Idle: {Next: []State{"missing"}},
+	})
+	if !errors.Is(err, ErrUnknownState) {
+		t.Fatalf("New() error = %v, want ErrUnknownState", err)
+	}
+}
+
+func TestMustNewPanicsOnInvalidDefinition(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("MustNew() didn't panic")
+		}
+	}()
+	MustNew(map[State]Step[int]{Idle: {Next: []State{"missing"}}})
+}
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name       string
+		state      State
+		in         Input
+		wantNext   State
+		wantNotice string
+		wantErr    error
+		wantReject string
+		want       answers
+	}{
+		{name: "go button starts", state: Idle, in: Input{Data: "go"}, wantNext: stateName},
+		{name: "other button when idle", state: Idle, in: Input{Data: "red"}, wantNext: Idle, wantErr: ErrUnexpectedInput},
+		{name: "text when idle", state: Idle, in: Input{Text: "hello"}, wantNext: Idle, wantErr: ErrUnexpectedInput},
+		{name: "name typed", state: stateName, in: Input{Text: "Ann"}, wantNext: stateColor, want: answers{Name: "Ann"}},
+		{name: "empty name rejected", state: stateName, in: Input{Text: ""}, wantNext: stateName, wantReject: "Please type a name"},
+		{name: "button for a text question", state: stateName, in: Input{Data: "red"}, wantNext: stateName, wantErr: ErrUnexpectedInput},
+		{name: "colour pressed", state: stateColor, in: Input{Data: "red"}, wantNext: statePlace, wantNotice: "Nice colour", want: answers{Color: "red"}},
+		{name: "text for a button question", state: stateColor, in: Input{Text: "red"}, wantNext: stateColor, wantErr: ErrUnexpectedInput},
+		{name: "transition not in Next", state: stateColor, in: Input{Data: "jump"}, wantNext: stateColor, wantErr: ErrInvalidTransition},
+		{name: "location shared", state: statePlace, in: Input{Location: &Location{Latitude: 51.5}}, wantNext: Idle, want: answers{Lat: 51.5}},
+		{name: "text for a location question", state: statePlace, in: Input{Text: "London"}, wantNext: statePlace, wantErr: ErrUnexpectedInput},
+		{name: "unknown state", state: "gone", in: Input{Text: "x"}, wantNext: "gone", wantErr: ErrUnknownState},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMachine(t)
+			var got answers
+			outcome, err := m.Handle(tt.state, &got, tt.in)
+			if outcome.Next != tt.wantNext {
+				t.Errorf("Next = %q, want %q", outcome.Next, tt.wantNext)
+			}
+			if outcome.Notice != tt.wantNotice {
+				t.Errorf("Notice = %q, want %q", outcome.Notice, tt.wantNotice)
+			}
+			switch {
+			case tt.wantReject != "":
+				var rejection *Rejection
+				if !errors.As(err, &rejection) || rejection.Prompt.Text != tt.wantReject {
+					t.Fatalf("error = %v, want rejection %q", err, tt.wantReject)
+				}
+				if len(rejection.Prompt.Buttons) != 1 {
+					t.Errorf("rejection buttons = %v, want one row", rejection.Prompt.Buttons)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// Rejected inputs must leave the data alone
+			if got != tt.want {
+				t.Errorf("data = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	m := newTestMachine(t)
+	prompt, ok := m.Prompt(stateColor, &answers{Name: "Ann"})
+	if !ok || prompt.Text != "Colour, Ann?" || len(prompt.Buttons) != 1 {
+		t.Errorf("Prompt(color) = %+v, %v", prompt, ok)
+	}
+	if _, ok := m.Prompt(statePlace, &answers{}); ok {
+		t.Error("Prompt(place) reported a prompt for a state without one")
+	}
+	if _, ok := m.Prompt("gone", &answers{}); ok {
+		t.Error("Prompt(gone) reported a prompt for an unknown state")
+	}
+}
+
+func TestHas(t *testing.T) {
+	m := newTestMachine(t)
+	for _, state := range []State{Idle, stateName, stateColor, statePlace} {
+		if !m.Has(state) {
+			t.Errorf("Has(%q) = false", state)
+		}
+	}
+	if m.Has("gone") {
+		t.Error(`Has("gone") = true`)
+	}
+}
@@ -0,0 +1,18 @@
+package geo
+
+import "math"
+
+const earthRadiusMiles = 3958.8
+
+// DistanceMiles returns the great-circle distance between two points using the haversine formula.
+func DistanceMiles(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := radians(lat2 - lat1)
+	dLon := radians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(radians(lat1))*math.Cos(radians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMiles * math.Asin(math.Sqrt(a))
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
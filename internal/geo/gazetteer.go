@@ -0,0 +1,350 @@
+package geo
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed data/places.csv
+var placesCSV string
+
+//go:embed data/postcode_areas.csv
+var postcodeAreasCSV string
+
+// Place kinds stored in the gazetteer.
+const (
+	KindOutcode       = "outcode"
+	KindBorough       = "borough"
+	KindNeighbourhood = "neighbourhood"
+	KindTown          = "town"
+)
+
+// maxSuggestions is the number of "Did you mean…?" options offered for ambiguous input.
+const maxSuggestions = 4
+
+var postcodePattern = regexp.MustCompile(`^(([A-Z]{1,2})[0-9][0-9A-Z]?)([0-9][A-Z]{2})?$`)
+
+// Place is a named area with an approximate centroid.
+type Place struct {
+	Name      string
+	Kind      string
+	Latitude  float64
+	Longitude float64
+	Aliases   []string
+}
+
+// Resolution is the outcome of resolving free text typed by the user.
+// Place is set when the input identifies a single area; Exact is false when it was
+// corrected from a typo. Suggestions is set when the input is ambiguous.
+type Resolution struct {
+	Place       *Place
+	Exact       bool
+	Suggestions []Place
+}
+
+// Gazetteer is an offline index of UK outcodes, London boroughs and neighbourhoods, and
+// post towns. Every Greater London outcode has its own centroid; outcodes elsewhere that
+// the dataset doesn't list take the centroid of their postcode area's post town.
+type Gazetteer struct {
+	places   []Place
+	outcodes map[string]int
+	names    map[string][]int
+	// areas maps a postcode area, such as "M", to its post town.
+	areas map[string]int
+}
+
+// NewGazetteer parses the embedded places and postcode areas datasets.
+func NewGazetteer() (*Gazetteer, error) {
+	reader := csv.NewReader(strings.NewReader(placesCSV))
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading places dataset: %w", err)
+	}
+
+	g := &Gazetteer{
+		outcodes: make(map[string]int),
+		names:    make(map[string][]int),
+		areas:    make(map[string]int),
+	}
+	for i, record := range records {
+		if len(record) != 5 {
+			return nil, fmt.Errorf("places dataset line %d: expected 5 fields, got %d", i+1, len(record))
+		}
+		lat, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("places dataset line %d: invalid latitude: %w", i+1, err)
+		}
+		lon, err := strconv.ParseFloat(record[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("places dataset line %d: invalid longitude: %w", i+1, err)
+		}
+		place := Place{Name: record[1], Kind: record[0], Latitude: lat, Longitude: lon}
+		if record[4] != "" {
+			place.Aliases = strings.Split(record[4], "|")
+		}
+
+		idx := len(g.places)
+		g.places = append(g.places, place)
+		if place.Kind == KindOutcode {
+			g.outcodes[place.Name] = idx
+			continue
+		}
+		g.names[Normalise(place.Name)] = append(g.names[Normalise(place.Name)], idx)
+		for _, alias := range place.Aliases {
+			g.names[Normalise(alias)] = append(g.names[Normalise(alias)], idx)
+		}
+	}
+	if err := g.readPostcodeAreas(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// readPostcodeAreas links each postcode area to its post town in the places dataset.
+func (g *Gazetteer) readPostcodeAreas() error {
+	reader := csv.NewReader(strings.NewReader(postcodeAreasCSV))
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		return fmt.Errorf("error reading postcode areas dataset: %w", err)
+	}
+	for i, record := range records {
+		if len(record) != 2 {
+			return fmt.Errorf("postcode areas dataset line %d: expected 2 fields, got %d", i+1, len(record))
+		}
+		idx := -1
+		for _, candidate := range g.names[Normalise(record[1])] {
+			if g.places[candidate].Name == record[1] {
+				idx = candidate
+				break
+			}
+		}
+		if idx < 0 {
+			return fmt.Errorf("postcode areas dataset line %d: unknown post town %q", i+1, record[1])
+		}
+		g.areas[record[0]] = idx
+	}
+	return nil
+}
+
+// Lookup returns the place with the given canonical name.
+func (g *Gazetteer) Lookup(name string) (Place, bool) {
+	if match := postcodePattern.FindStringSubmatch(strings.ToUpper(name)); match != nil && match[3] == "" {
+		return g.outcode(match[1], match[2])
+	}
+	for _, idx := range g.names[Normalise(name)] {
+		if g.places[idx].Name == name {
+			return g.places[idx], true
+		}
+	}
+	return Place{}, false
+}
+
+// Nearest returns the outcode closest to the given point, used to describe a shared location.
+func (g *Gazetteer) Nearest(lat, lon float64) Place {
+	var nearest Place
+	best := math.MaxFloat64
+	for _, idx := range g.outcodes {
+		place := g.places[idx]
+		if d := DistanceMiles(lat, lon, place.Latitude, place.Longitude); d < best {
+			best = d
+			nearest = place
+		}
+	}
+	return nearest
+}
+
+// Resolve matches free text against the gazetteer. Postcodes are reduced to their
+// outcode, names are matched exactly (including aliases), then by prefix, and finally
+// by edit distance to catch typos.
+func (g *Gazetteer) Resolve(input string) Resolution {
+	if place, ok := g.resolvePostcode(input); ok {
+		return Resolution{Place: &place, Exact: true}
+	}
+
+	query := Normalise(input)
+	if query == "" {
+		return Resolution{}
+	}
+	if idxs := g.names[query]; len(idxs) > 0 {
+		if len(idxs) == 1 {
+			place := g.places[idxs[0]]
+			return Resolution{Place: &place, Exact: true}
+		}
+		return Resolution{Suggestions: g.collect(idxs)}
+	}
+
+	// Prefix matches are ambiguous by definition, e.g. "west" or "north".
+	if len(query) >= 3 {
+		var idxs []int
+		for name, candidates := range g.names {
+			if strings.HasPrefix(name, query+" ") || strings.HasPrefix(name, query) && len(query) >= 5 {
+				idxs = append(idxs, candidates...)
+			}
+		}
+		sort.Ints(idxs)
+		if places := g.collect(idxs); len(places) == 1 {
+			return Resolution{Place: &places[0]}
+		} else if len(places) > 1 {
+			return Resolution{Suggestions: places}
+		}
+	}
+
+	return g.resolveFuzzy(query)
+}
+
+// resolvePostcode extracts an outcode from a full or partial postcode, either as the
+// whole input or as one of its words (e.g. "Camden NW1").
+func (g *Gazetteer) resolvePostcode(input string) (Place, bool) {
+	candidates := []string{strings.ReplaceAll(strings.ToUpper(input), " ", "")}
+	candidates = append(candidates, strings.Fields(strings.ToUpper(input))...)
+
+	for _, candidate := range candidates {
+		match := postcodePattern.FindStringSubmatch(candidate)
+		if match == nil {
+			continue
+		}
+		if place, ok := g.outcode(match[1], match[2]); ok {
+			return place, true
+		}
+	}
+	return Place{}, false
+}
+
+// outcode returns the place for an outcode in the given postcode area. Outcodes the
+// dataset doesn't list take the centroid of the area's post town.
+func (g *Gazetteer) outcode(outcode, area string) (Place, bool) {
+	if idx, ok := g.outcodes[outcode]; ok {
+		return g.places[idx], true
+	}
+	// Central London districts are split into sub-districts such as W1D or EC1A.
+	if last := outcode[len(outcode)-1]; last >= 'A' && last <= 'Z' {
+		if idx, ok := g.outcodes[outcode[:len(outcode)-1]]; ok {
+			return g.places[idx], true
+		}
+	}
+	idx, ok := g.areas[area]
+	if !ok {
+		return Place{}, false
+	}
+	town := g.places[idx]
+	return Place{Name: outcode, Kind: KindOutcode, Latitude: town.Latitude, Longitude: town.Longitude}, true
+}
+
+func (g *Gazetteer) resolveFuzzy(query string) Resolution {
+	type candidate struct {
+		idx      int
+		distance int
+	}
+	threshold := 1
+	switch {
+	case len(query) > 10:
+		threshold = 3
+	case len(query) > 5:
+		threshold = 2
+	}
+
+	best := make(map[int]int)
+	for name, idxs := range g.names {
+		distance := Levenshtein(query, name)
+		if distance > threshold {
+			continue
+		}
+		for _, idx := range idxs {
+			if d, ok := best[idx]; !ok || distance < d {
+				best[idx] = distance
+			}
+		}
+	}
+
+	candidates := make([]candidate, 0, len(best))
+	for idx, distance := range best {
+		candidates = append(candidates, candidate{idx, distance})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return g.places[candidates[i].idx].Name < g.places[candidates[j].idx].Name
+	})
+
+	switch {
+	case len(candidates) == 0:
+		return Resolution{}
+	case len(candidates) == 1 || candidates[0].distance < candidates[1].distance:
+		place := g.places[candidates[0].idx]
+		return Resolution{Place: &place}
+	}
+
+	idxs := make([]int, 0, len(candidates))
+	for _, c := range candidates {
+		idxs = append(idxs, c.idx)
+	}
+	return Resolution{Suggestions: g.collect(idxs)}
+}
+
+// collect returns the places for the given indexes in order without duplicates, capped
+// at maxSuggestions.
+func (g *Gazetteer) collect(idxs []int) []Place {
+	seen := make(map[int]bool)
+	var places []Place
+	for _, idx := range idxs {
+		if seen[idx] {
+			continue
+		}
+		seen[idx] = true
+		places = append(places, g.places[idx])
+	}
+	if len(places) > maxSuggestions {
+		places = places[:maxSuggestions]
+	}
+	return places
+}
+
+// Normalise lowercases the input, drops apostrophes, replaces "&" with "and" and
+// collapses punctuation and whitespace into single spaces.
+func Normalise(input string) string {
+	input = strings.ToLower(input)
+	input = strings.ReplaceAll(input, "&", " and ")
+	var b strings.Builder
+	for _, r := range input {
+		switch {
+		case r == '\'' || r == '’':
+			continue
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// Levenshtein returns the edit distance between two strings, counted in runes.
+func Levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
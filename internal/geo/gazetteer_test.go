@@ -0,0 +1,185 @@
+package geo
+
+import (
+	"slices"
+	"testing"
+)
+
+func newTestGazetteer(t *testing.T) *Gazetteer {
+	t.Helper()
+	g, err := NewGazetteer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// names returns the names of places, in order.
+func names(places []Place) []string {
+	var names []string
+	for _, place := range places {
+		names = append(names, place.Name)
+	}
+	return names
+}
+
+func TestResolve(t *testing.T) {
+	g := newTestGazetteer(t)
+	tests := []struct {
+		input       string
+		want        string
+		wantKind    string
+		wantExact   bool
+		suggestions []string
+	}{
+		// Exact names and aliases
+		{input: "Camden", want: "Camden", wantKind: KindBorough, wantExact: true},
+		{input: "hampstead", want: "Hampstead", wantKind: KindNeighbourhood, wantExact: true},
+		{input: "Richmond", want: "Richmond upon Thames", wantKind: KindBorough, wantExact: true},
+		{input: "Manchester", want: "Manchester", wantKind: KindTown, wantExact: true},
+		{input: "Newcastle", want: "Newcastle upon Tyne", wantKind: KindTown, wantExact: true},
+
+		// Postcodes
+		{input: "NW1", want: "NW1", wantKind: KindOutcode, wantExact: true},
+		{input: "Camden NW1", want: "NW1", wantKind: KindOutcode, wantExact: true},
+		{input: "BR3", want: "BR3", wantKind: KindOutcode, wantExact: true},
+		{input: "CR2 6XH", want: "CR2", wantKind: KindOutcode, wantExact: true},
+		{input: "M14 5AB", want: "M14", wantKind: KindOutcode, wantExact: true},
+
+		// Misspelt
+		{input: "hackny", want: "Hackney", wantKind: KindBorough},
+		{input: "manchestr", want: "Manchester", wantKind: KindTown},
+
+		// Ambiguous
+		{input: "west", suggestions: []string{"Dulwich", "West Ham", "West Hampstead"}},
+		{input: "leton", suggestions: []string{"Leyton", "Luton"}},
+
+		// Unknown
+		{input: "zzzz"},
+		{input: ""},
+		{input: "QQ1 1AA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := g.Resolve(tt.input)
+			if tt.want == "" {
+				if got.Place != nil {
+					t.Fatalf("Resolve(%q) = %+v, want no place", tt.input, got.Place)
+				}
+			} else {
+				if got.Place == nil || got.Place.Name != tt.want || got.Place.Kind != tt.wantKind {
+					t.Fatalf("Resolve(%q) = %+v, want %s %q", tt.input, got.Place, tt.wantKind, tt.want)
+				}
+				if got.Exact != tt.wantExact {
+					t.Errorf("Resolve(%q).Exact = %v, want %v", tt.input, got.Exact, tt.wantExact)
+				}
+			}
+			if !slices.Equal(names(got.Suggestions), tt.suggestions) {
+				t.Errorf("Resolve(%q).Suggestions = %q, want %q", tt.input, names(got.Suggestions), tt.suggestions)
+			}
+		})
+	}
+}
+
+func TestResolvePostcode(t *testing.T) {
+	g := newTestGazetteer(t)
+	manchester, _ := g.Lookup("Manchester")
+	tests := []struct {
+		input    string
+		want     string
+		wantLat  float64
+		wantLong float64
+	}{
+		{input: "E8", want: "E8", wantLat: 51.5440, wantLong: -0.0640},
+		{input: "e8 3ab", want: "E8", wantLat: 51.5440, wantLong: -0.0640},
+		{input: "E83AB", want: "E8", wantLat: 51.5440, wantLong: -0.0640},
+		// Sub-districts fall back to their district
+		{input: "EC1A 1BB", want: "EC1", wantLat: 51.5240, wantLong: -0.1020},
+		{input: "W1D", want: "W1", wantLat: 51.5150, wantLong: -0.1440},
+		// Outer London districts have their own centroids
+		{input: "BR3 1AA", want: "BR3", wantLat: 51.4050, wantLong: -0.0300},
+		// Other outcodes are placed at their post town
+		{input: "M14 5AB", want: "M14", wantLat: manchester.Latitude, wantLong: manchester.Longitude},
+		{input: "flat near M14", want: "M14", wantLat: manchester.Latitude, wantLong: manchester.Longitude},
+		{input: "QQ1"},
+		{input: "Camden"},
+		{input: "1AB"},
+	}
+	for _, tt := range tests {
+		got, ok := g.resolvePostcode(tt.input)
+		if ok != (tt.want != "") || got.Name != tt.want {
+			t.Errorf("resolvePostcode(%q) = %q, %v, want %q", tt.input, got.Name, ok, tt.want)
+			continue
+		}
+		if ok && (got.Kind != KindOutcode || got.Latitude != tt.wantLat || got.Longitude != tt.wantLong) {
+			t.Errorf("resolvePostcode(%q) = %+v, want an outcode at %v, %v", tt.input, got, tt.wantLat, tt.wantLong)
+		}
+	}
+}
+
+func TestEveryPostcodeAreaResolves(t *testing.T) {
+	g := newTestGazetteer(t)
+	if len(g.areas) < 120 {
+		t.Errorf("%d postcode areas, want every UK area", len(g.areas))
+	}
+	for area := range g.areas {
+		if place, ok := g.Lookup(area + "99"); !ok || place.Name != area+"99" {
+			t.Errorf("Lookup(%q) = %+v, %v", area+"99", place, ok)
+		}
+	}
+}
+
+func TestResolveFuzzy(t *testing.T) {
+	g := newTestGazetteer(t)
+	tests := []struct {
+		query       string
+		want        string
+		suggestions []string
+	}{
+		{query: "leytn", want: "Leyton"},
+		{query: "walthamstowe", want: "Walthamstow"},
+		{query: "hamersmith", want: "Hammersmith"},
+		{query: "harow", want: "Harrow"},
+		{query: "yrk", want: "York"},
+		{query: "leton", suggestions: []string{"Leyton", "Luton"}},
+		// Short queries allow a single edit
+		{query: "ham"},
+		{query: "zzzz"},
+	}
+	for _, tt := range tests {
+		got := g.resolveFuzzy(tt.query)
+		var name string
+		if got.Place != nil {
+			name = got.Place.Name
+		}
+		if name != tt.want || got.Exact {
+			t.Errorf("resolveFuzzy(%q) = %+v, want %q", tt.query, got.Place, tt.want)
+		}
+		if !slices.Equal(names(got.Suggestions), tt.suggestions) {
+			t.Errorf("resolveFuzzy(%q).Suggestions = %q, want %q", tt.query, names(got.Suggestions), tt.suggestions)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"hackney", "hackney", 0},
+		{"hackny", "hackney", 1},
+		{"prefrences", "preferences", 1},
+		{"kitten", "sitting", 3},
+		{"łódź", "lodz", 3},
+	}
+	for _, tt := range tests {
+		if got := Levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("Levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := Levenshtein(tt.b, tt.a); got != tt.want {
+			t.Errorf("Levenshtein(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
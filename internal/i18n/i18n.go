@@ -0,0 +1,281 @@
+// Package i18n translates the bot's messages. Each locale has a catalogue, embedded from
+// data/<tag>.json, that maps message keys to fmt formats. Translations can reorder the
+// arguments with explicit indexes such as %[2]s. A message can instead have plural forms,
+// one of which is picked by a count with the locale's plural rule.
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+//go:embed data/*.json
+var catalogueFiles embed.FS
+
+// DefaultTag is the locale used when a user's language isn't supported. Its catalogue
+// defines the keys every other catalogue must have.
+const DefaultTag = "en"
+
+// Catalogue holds the messages of one locale.
+type Catalogue struct {
+	tag      string
+	name     string
+	rule     pluralRule
+	messages map[string]message
+}
+
+// message is a format, or a format per plural form.
+type message struct {
+	text  string
+	forms map[Form]string
+}
+
+// catalogueFile is the layout of data/<tag>.json.
+type catalogueFile struct {
+	// Name is the language's name in the language itself, shown by /language.
+	Name     string                     `json:"name"`
+	Messages map[string]json.RawMessage `json:"messages"`
+}
+
+// Tag returns the locale's language tag, e.g. "en".
+func (c *Catalogue) Tag() string {
+	return c.tag
+}
+
+// Name returns the language's name in the language itself, e.g. "Polski".
+func (c *Catalogue) Name() string {
+	return c.name
+}
+
+// Text formats the message with the given key. A missing key is returned as is, so it
+// shows up instead of an empty message.
+func (c *Catalogue) Text(key string, args ...any) string {
+	msg, ok := c.messages[key]
+	if !ok {
+		return key
+	}
+	text := msg.text
+	if msg.forms != nil {
+		text = msg.forms[Other]
+	}
+	return format(text, args)
+}
+
+// Has reports whether the catalogue has a message with the given key.
+func (c *Catalogue) Has(key string) bool {
+	_, ok := c.messages[key]
+	return ok
+}
+
+// Plural formats the form of the message that fits the count n. The arguments usually
+// include n itself.
+func (c *Catalogue) Plural(key string, n int, args ...any) string {
+	msg, ok := c.messages[key]
+	if !ok {
+		return key
+	}
+	if msg.forms == nil {
+		return format(msg.text, args)
+	}
+	return format(msg.forms[c.rule.form(n)], args)
+}
+
+func format(text string, args []any) string {
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// Bundle holds the catalogue of every supported locale.
+type Bundle struct {
+	catalogues map[string]*Catalogue
+}
+
+// NewBundle parses the embedded catalogues and checks that each has every message of the
+// default catalogue, with the same arguments and the plural forms its locale needs.
+func NewBundle() (*Bundle, error) {
+	files, err := catalogueFiles.ReadDir("data")
+	if err != nil {
+		return nil, fmt.Errorf("error reading catalogues: %w", err)
+	}
+	b := &Bundle{catalogues: make(map[string]*Catalogue)}
+	for _, file := range files {
+		tag := strings.TrimSuffix(file.Name(), ".json")
+		catalogue, err := parseCatalogue(tag, path.Join("data", file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error loading catalogue %q: %w", tag, err)
+		}
+		b.catalogues[tag] = catalogue
+	}
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func parseCatalogue(tag, name string) (*Catalogue, error) {
+	rule, ok := pluralRules[tag]
+	if !ok {
+		return nil, fmt.Errorf("no plural rule for locale")
+	}
+	data, err := catalogueFiles.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var file catalogueFile
+	if err = json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if file.Name == "" {
+		return nil, fmt.Errorf("missing language name")
+	}
+
+	c := &Catalogue{tag: tag, name: file.Name, rule: rule, messages: make(map[string]message, len(file.Messages))}
+	for key, raw := range file.Messages {
+		var msg message
+		if err = json.Unmarshal(raw, &msg.text); err != nil {
+			if err = json.Unmarshal(raw, &msg.forms); err != nil {
+				return nil, fmt.Errorf("message %q is neither text nor plural forms", key)
+			}
+		}
+		c.messages[key] = msg
+	}
+	return c, nil
+}
+
+// check compares every catalogue with the default one.
+func (b *Bundle) check() error {
+	reference, ok := b.catalogues[DefaultTag]
+	if !ok {
+		return fmt.Errorf("missing default catalogue %q", DefaultTag)
+	}
+	var problems []string
+	for _, c := range b.catalogues {
+		for key, msg := range c.messages {
+			want, ok := reference.messages[key]
+			switch {
+			case !ok:
+				problems = append(problems, fmt.Sprintf("%s: unknown message %q", c.tag, key))
+				continue
+			case (msg.forms == nil) != (want.forms == nil):
+				problems = append(problems, fmt.Sprintf("%s: message %q must be %s", c.tag, key, kind(want)))
+				continue
+			}
+			wantVerbs := countVerbs(want.variants()[0])
+			for _, text := range msg.variants() {
+				if countVerbs(text) != wantVerbs {
+					problems = append(problems, fmt.Sprintf("%s: message %q must have %d arguments", c.tag, key, wantVerbs))
+					break
+				}
+			}
+			if msg.forms != nil && !c.rule.covers(msg.forms) {
+				problems = append(problems, fmt.Sprintf("%s: message %q must have the plural forms %v", c.tag, key, c.rule.forms))
+			}
+		}
+		for key := range reference.messages {
+			if _, ok := c.messages[key]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing message %q", c.tag, key))
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("invalid catalogues: %w", errors.New(strings.Join(problems, "; ")))
+}
+
+// variants returns the text, or every plural form.
+func (m message) variants() []string {
+	if m.forms == nil {
+		return []string{m.text}
+	}
+	texts := make([]string, 0, len(m.forms))
+	for _, text := range m.forms {
+		texts = append(texts, text)
+	}
+	return texts
+}
+
+func kind(m message) string {
+	if m.forms == nil {
+		return "text"
+	}
+	return "plural forms"
+}
+
+// countVerbs counts the fmt verbs in a format, not counting "%%".
+func countVerbs(text string) int {
+	n := 0
+	for i := 0; i < len(text); i++ {
+		if text[i] != '%' {
+			continue
+		}
+		if i+1 < len(text) && text[i+1] == '%' {
+			i++
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// Default returns the catalogue of DefaultTag.
+func (b *Bundle) Default() *Catalogue {
+	return b.catalogues[DefaultTag]
+}
+
+// Lookup returns the catalogue with the given tag.
+func (b *Bundle) Lookup(tag string) (*Catalogue, bool) {
+	c, ok := b.catalogues[tag]
+	return c, ok
+}
+
+// Match returns the catalogue for an IETF language tag as sent by Telegram clients, e.g.
+// "pl" or "en-GB", falling back to the default catalogue.
+func (b *Bundle) Match(languageCode string) *Catalogue {
+	base, _, _ := strings.Cut(strings.ToLower(languageCode), "-")
+	if c, ok := b.catalogues[base]; ok {
+		return c
+	}
+	return b.Default()
+}
+
+// Catalogues returns every catalogue, the default one first and the others by tag.
+func (b *Bundle) Catalogues() []*Catalogue {
+	catalogues := make([]*Catalogue, 0, len(b.catalogues))
+	for _, c := range b.catalogues {
+		catalogues = append(catalogues, c)
+	}
+	slices.SortFunc(catalogues, func(x, y *Catalogue) int {
+		switch {
+		case x.tag == DefaultTag:
+			return -1
+		case y.tag == DefaultTag:
+			return 1
+		}
+		return strings.Compare(x.tag, y.tag)
+	})
+	return catalogues
+}
+
+type contextKey struct{}
+
+// WithCatalogue returns a copy of ctx carrying the catalogue of the chat being served.
+func WithCatalogue(ctx context.Context, c *Catalogue) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// FromContext returns the catalogue carried by ctx, if any.
+func FromContext(ctx context.Context) (*Catalogue, bool) {
+	c, ok := ctx.Value(contextKey{}).(*Catalogue)
+	return c, ok
+}
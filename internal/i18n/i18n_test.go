@@ -0,0 +1,83 @@
+package i18n
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEveryKeyInEveryLocale(t *testing.T) {
+	b, err := NewBundle()
+	if err != nil {
+		t.Fatalf("NewBundle() error = %v", err)
+	}
+	reference := b.Default()
+	if len(b.Catalogues()) < 2 {
+		t.Fatalf("found %d catalogues, want the default one and at least one translation", len(b.Catalogues()))
+	}
+	for _, c := range b.Catalogues() {
+		for key, want := range reference.messages {
+			msg, ok := c.messages[key]
+			if !ok {
+				t.Errorf("%s: missing message %q", c.Tag(), key)
+				continue
+			}
+			if (msg.forms == nil) != (want.forms == nil) {
+				t.Errorf("%s: message %q must be %s", c.Tag(), key, kind(want))
+				continue
+			}
+			for _, text := range msg.variants() {
+				if countVerbs(text) != countVerbs(want.variants()[0]) {
+					t.Errorf("%s: message %q has %d arguments, want %d", c.Tag(), key, countVerbs(text), countVerbs(want.variants()[0]))
+				}
+			}
+		}
+		for key := range c.messages {
+			if _, ok := reference.messages[key]; !ok {
+				t.Errorf("%s: message %q isn't in the default catalogue", c.Tag(), key)
+			}
+		}
+	}
+}
+
+func TestCheckReportsProblems(t *testing.T) {
+	english := &Catalogue{tag: DefaultTag, rule: pluralRules[DefaultTag], messages: map[string]message{
+		"greeting": {text: "Hello %s"},
+		"listings": {forms: map[Form]string{One: "%d listing", Other: "%d listings"}},
+	}}
+	tests := []struct {
+		name     string
+		messages map[string]message
+		want     string
+	}{
+		{name: "missing message", messages: map[string]message{
+			"listings": {forms: map[Form]string{One: "%d", Few: "%d", Many: "%d", Other: "%d"}},
+		}, want: `pl: missing message "greeting"`},
+		{name: "unknown message", messages: map[string]message{
+			"greeting": {text: "Cześć %s"},
+			"listings": {forms: map[Form]string{One: "%d", Few: "%d", Many: "%d", Other: "%d"}},
+			"farewell": {text: "Pa"},
+		}, want: `pl: unknown message "farewell"`},
+		{name: "wrong arguments", messages: map[string]message{
+			"greeting": {text: "Cześć"},
+			"listings": {forms: map[Form]string{One: "%d", Few: "%d", Many: "%d", Other: "%d"}},
+		}, want: `pl: message "greeting" must have 1 arguments`},
+		{name: "text for plural forms", messages: map[string]message{
+			"greeting": {text: "Cześć %s"},
+			"listings": {text: "%d ogłoszeń"},
+		}, want: `pl: message "listings" must be plural forms`},
+		{name: "missing plural form", messages: map[string]message{
+			"greeting": {text: "Cześć %s"},
+			"listings": {forms: map[Form]string{One: "%d", Other: "%d"}},
+		}, want: `pl: message "listings" must have the plural forms`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			polish := &Catalogue{tag: "pl", rule: pluralRules["pl"], messages: tt.messages}
+			b := &Bundle{catalogues: map[string]*Catalogue{DefaultTag: english, "pl": polish}}
+			err := b.check()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("check() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package i18n
+
+// Form is a plural form, named as in the Unicode CLDR plural rules.
+type Form string
+
+const (
+	One   Form = "one"
+	Few   Form = "few"
+	Many  Form = "many"
+	Other Form = "other"
+)
+
+// pluralRule picks the plural form of a whole number for a locale.
+type pluralRule struct {
+	// forms are the forms every plural message must have.
+	forms []Form
+	form  func(n int) Form
+}
+
+// pluralRules holds the rule of every supported locale, keyed by tag.
+var pluralRules = map[string]pluralRule{
+	"en": {forms: []Form{One, Other}, form: func(n int) Form {
+		if n == 1 {
+			return One
+		}
+		return Other
+	}},
+	"pl": {forms: []Form{One, Few, Many, Other}, form: polishForm},
+}
+
+// polishForm follows the CLDR rule for Polish: 1 plik, 2–4 pliki, 5–21 plików, 22–24
+// pliki and so on. Other is for fractions, which are never counted here, but Text uses it.
+func polishForm(n int) Form {
+	if n < 0 {
+		n = -n
+	}
+	switch {
+	case n == 1:
+		return One
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return Few
+	}
+	return Many
+}
+
+// covers reports whether forms has every form of the rule.
+func (r pluralRule) covers(forms map[Form]string) bool {
+	for _, form := range r.forms {
+		if _, ok := forms[form]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+// Package logging sets up structured JSON logs. Each update gets a correlation ID, carried
+// in its context.Context and added to every record logged with that context.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// redactedValue replaces the value of sensitive attributes.
+const redactedValue = "[redacted]"
+
+// Attribute keys holding message contents or personal data. Their values are replaced
+// with redactedValue unless personal data logging is turned on.
+var sensitiveKeys = map[string]bool{
+	"text":        true,
+	"first_name":  true,
+	"last_name":   true,
+	"username":    true,
+	"area":        true,
+	"address":     true,
+	"destination": true,
+	"details":     true,
+}
+
+// Options configures the logger.
+type Options struct {
+	// Level is "debug", "info" (the default), "warn" or "error".
+	Level string
+	// LogPersonalData logs message contents and personal data instead of redacting them.
+	// It is meant for local debugging only.
+	LogPersonalData bool
+}
+
+// New returns a JSON logger writing to w.
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	if !opts.LogPersonalData {
+		handlerOpts.ReplaceAttr = redact
+	}
+	return slog.New(contextHandler{slog.NewJSONHandler(w, handlerOpts)}), nil
+}
+
+// ParseLevel parses a level name. An empty name is the info level.
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	if sensitiveKeys[attr.Key] {
+		return slog.String(attr.Key, redactedValue)
+	}
+	return attr
+}
+
+type correlationKey struct{}
+
+// NewCorrelationID returns a random ID for tying together the records logged for one update.
+func NewCorrelationID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// WithCorrelationID returns a context whose log records carry the given correlation ID.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the context's correlation ID, or "" if it has none.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// contextHandler adds the correlation ID of the record's context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := CorrelationID(ctx); id != "" {
+		record.AddAttrs(slog.String("correlation_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
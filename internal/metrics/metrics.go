@@ -0,0 +1,97 @@
+// Package metrics defines the bot's Prometheus metrics, served on /metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+const namespace = "rentseeker"
+
+var (
+	// UpdatesProcessed counts handled updates by type: "message", "callback_query" or "other".
+	UpdatesProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "updates_processed_total",
+		Help:      "Telegram updates handled, by update type.",
+	}, []string{"type"})
+
+	// HandlerDuration is how long handling an update took, by update type.
+	HandlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handler_duration_seconds",
+		Help:      "Time taken to handle a Telegram update, by update type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"type"})
+
+	// ProviderRequests counts listings provider calls by operation and status ("ok" or "error").
+	ProviderRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_requests_total",
+		Help:      "Listings provider calls, by operation and status.",
+	}, []string{"operation", "status"})
+
+	// ProviderDuration is the latency of listings provider calls by operation.
+	ProviderDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provider_request_duration_seconds",
+		Help:      "Latency of listings provider calls, by operation.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"operation"})
+
+	// ProviderUp is 1 while the listings provider passes its connection test, 0 while the
+	// bot runs in degraded mode.
+	ProviderUp = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "provider_up",
+		Help:      "Whether the listings provider passed its last connection test.",
+	})
+
+	// CacheLookups counts cache lookups by cache and result ("hit" or "miss").
+	CacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Cache lookups, by cache and result.",
+	}, []string{"cache", "result"})
+
+	// AlertsSent counts listings sent as alerts and digests, by what triggered them.
+	AlertsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alerts_sent_total",
+		Help:      "Listings sent as alerts and digests, by trigger.",
+	}, []string{"trigger"})
+
+	// SearchResultsSent counts listings shown in reply to searches.
+	SearchResultsSent = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "search_results_sent_total",
+		Help:      "Listings shown in reply to searches.",
+	})
+
+	// TelegramSendFailures counts failed Telegram API calls by method.
+	TelegramSendFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_send_failures_total",
+		Help:      "Failed Telegram API calls, by method.",
+	}, []string{"method"})
+)
+
+// ObserveProviderRequest records the outcome and latency of a listings provider call.
+func ObserveProviderRequest(operation string, latency time.Duration, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	ProviderRequests.WithLabelValues(operation, status).Inc()
+	ProviderDuration.WithLabelValues(operation).Observe(latency.Seconds())
+}
+
+// ObserveCacheLookup records a cache hit or miss.
+func ObserveCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	CacheLookups.WithLabelValues(cache, result).Inc()
+}
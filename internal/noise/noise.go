@@ -0,0 +1,173 @@
+package noise
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+//go:embed data/sources.csv
+var sourcesCSV string
+
+// Scores range from 1 (quiet) to 5 (very noisy).
+const (
+	MinScore = 1
+	MaxScore = 5
+	// QuietScore is the highest score still considered quiet.
+	QuietScore = 2
+)
+
+const earthRadiusMetres = 6371000.0
+
+// band adds points to the score when a listing is within the given distance of a source.
+type band struct {
+	metres float64
+	points int
+}
+
+// bands are checked from nearest to furthest for each kind of source.
+var bands = map[string][]band{
+	"road":   {{60, 3}, {200, 2}, {500, 1}},
+	"rail":   {{75, 2}, {250, 1}},
+	"flight": {{800, 2}, {2000, 1}},
+}
+
+type point struct {
+	lat, lon float64
+}
+
+type source struct {
+	kind   string
+	name   string
+	points []point
+}
+
+// Index scores locations by their distance to major roads, railway lines and flight paths.
+// It only covers the area around its sources: the box bounding them, widened by the
+// furthest band.
+type Index struct {
+	sources []source
+	// south, west, north and east bound the covered area in degrees.
+	south, west, north, east float64
+}
+
+// NewIndex parses the embedded noise sources dataset.
+func NewIndex() (*Index, error) {
+	return parseIndex(sourcesCSV)
+}
+
+func parseIndex(data string) (*Index, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 3
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading noise sources dataset: %w", err)
+	}
+
+	index := &Index{south: math.Inf(1), west: math.Inf(1), north: math.Inf(-1), east: math.Inf(-1)}
+	for _, record := range records {
+		if _, ok := bands[record[0]]; !ok {
+			return nil, fmt.Errorf("noise source %s: unknown kind %s", record[1], record[0])
+		}
+		s := source{kind: record[0], name: record[1]}
+		for _, pair := range strings.Split(record[2], "|") {
+			fields := strings.Fields(pair)
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("noise source %s: invalid point %q", record[1], pair)
+			}
+			lat, err := strconv.ParseFloat(fields[0], 64)
+			if err != nil {
+				return nil, fmt.Errorf("noise source %s: invalid latitude: %w", record[1], err)
+			}
+			lon, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("noise source %s: invalid longitude: %w", record[1], err)
+			}
+			s.points = append(s.points, point{lat, lon})
+			index.south, index.north = math.Min(index.south, lat), math.Max(index.north, lat)
+			index.west, index.east = math.Min(index.west, lon), math.Max(index.east, lon)
+		}
+		if len(s.points) < 2 {
+			return nil, fmt.Errorf("noise source %s: needs at least two points", record[1])
+		}
+		index.sources = append(index.sources, s)
+	}
+
+	var furthest float64
+	for _, kind := range bands {
+		furthest = math.Max(furthest, kind[len(kind)-1].metres)
+	}
+	margin := furthest / earthRadiusMetres * 180 / math.Pi
+	index.south -= margin
+	index.north += margin
+	midLatitude := (index.south + index.north) / 2 * math.Pi / 180
+	index.west -= margin / math.Cos(midLatitude)
+	index.east += margin / math.Cos(midLatitude)
+	return index, nil
+}
+
+// Covers reports whether the location is in the area the index has noise sources for.
+func (i *Index) Covers(lat, lon float64) bool {
+	return lat >= i.south && lat <= i.north && lon >= i.west && lon <= i.east
+}
+
+// Score returns a noise score from MinScore to MaxScore for the given location. Each kind
+// of source contributes once, based on the nearest source of that kind. It returns false
+// outside the covered area, where the score is unknown rather than quiet.
+func (i *Index) Score(lat, lon float64) (int, bool) {
+	if !i.Covers(lat, lon) {
+		return 0, false
+	}
+	nearest := make(map[string]float64)
+	for _, s := range i.sources {
+		d := distanceToLine(point{lat, lon}, s.points)
+		if current, ok := nearest[s.kind]; !ok || d < current {
+			nearest[s.kind] = d
+		}
+	}
+
+	score := MinScore
+	for kind, metres := range nearest {
+		for _, b := range bands[kind] {
+			if metres <= b.metres {
+				score += b.points
+				break
+			}
+		}
+	}
+	return min(score, MaxScore), true
+}
+
+// distanceToLine returns the distance in metres from p to the nearest segment of a polyline.
+// Points are projected onto a plane centred on p, which is accurate at city scale.
+func distanceToLine(p point, line []point) float64 {
+	cosLat := math.Cos(p.lat * math.Pi / 180)
+	project := func(q point) (float64, float64) {
+		x := (q.lon - p.lon) * math.Pi / 180 * earthRadiusMetres * cosLat
+		y := (q.lat - p.lat) * math.Pi / 180 * earthRadiusMetres
+		return x, y
+	}
+
+	best := math.Inf(1)
+	for j := 1; j < len(line); j++ {
+		ax, ay := project(line[j-1])
+		bx, by := project(line[j])
+		best = math.Min(best, distanceToSegment(ax, ay, bx, by))
+	}
+	return best
+}
+
+// distanceToSegment returns the distance from the origin to the segment AB.
+func distanceToSegment(ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	lengthSquared := dx*dx + dy*dy
+	t := 0.0
+	if lengthSquared > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/lengthSquared))
+	}
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
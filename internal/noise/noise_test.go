@@ -0,0 +1,84 @@
+package noise
+
+import "testing"
+
+// testSources has a road and, 67 metres north of it, a railway line, with a flight path
+// about 11 km south. 0.001 degrees of latitude is about 111 metres.
+const testSources = `road,Test Road,51.5000 -0.1000|51.5000 0.1000
+rail,Test Rail,51.5006 -0.1000|51.5006 0.1000
+flight,Test Path,51.4000 -0.1000|51.4000 0.1000
+`
+
+func TestScore(t *testing.T) {
+	index, err := parseIndex(testSources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     int
+		wantOK   bool
+	}{
+		{"on the road and next to the railway, capped", 51.5000, 0, MaxScore, true},
+		{"near both", 51.5020, 0, 3, true},
+		{"road in earshot", 51.5040, 0, 2, true},
+		{"away from everything", 51.5060, 0, MinScore, true},
+		{"under the flight path", 51.4050, 0, 3, true},
+		{"near the flight path", 51.4150, 0, 2, true},
+		{"past the end of the sources, still covered", 51.4500, 0.1200, MinScore, true},
+		{"east of the covered area", 51.4500, 0.1400, 0, false},
+		{"north of the covered area", 51.5300, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := index.Score(tt.lat, tt.lon)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Score() = %d, %v; want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestScoreOutsideLondonIsUnknown(t *testing.T) {
+	index, err := NewIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, place := range []struct {
+		name     string
+		lat, lon float64
+	}{
+		{"Manchester M1", 53.4794, -2.2353},
+		{"Birmingham B1", 52.4796, -1.9088},
+		{"Edinburgh EH1", 55.9500, -3.1883},
+	} {
+		if score, ok := index.Score(place.lat, place.lon); ok {
+			t.Errorf("Score() in %s = %d, want unknown", place.name, score)
+		}
+	}
+	for _, place := range []struct {
+		name     string
+		lat, lon float64
+	}{
+		{"Hackney", 51.5450, -0.0553},
+		{"Wimbledon", 51.4214, -0.2064},
+	} {
+		if _, ok := index.Score(place.lat, place.lon); !ok {
+			t.Errorf("Score() in %s is unknown, want a score", place.name)
+		}
+	}
+}
+
+func TestParseIndexRejectsBadSources(t *testing.T) {
+	for _, data := range []string{
+		"river,Thames,51.5 -0.1|51.5 0.1\n",
+		"road,A1,51.5 -0.1\n",
+		"road,A1,51.5 -0.1|north 0.1\n",
+		"road,A1,51.5|51.5 0.1\n",
+	} {
+		if _, err := parseIndex(data); err == nil {
+			t.Errorf("parseIndex(%q) succeeded, want an error", data)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package query
+
+import (
+	"reflect"
+	"rent_seekerbot/internal/geo"
+	"testing"
+)
+
+func newTestParser(t *testing.T) *Parser {
+	t.Helper()
+	gazetteer, err := geo.NewGazetteer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewParser(gazetteer)
+}
+
+// parsed is the part of a Query a test checks, with the area by name.
+type parsed struct {
+	PropertyType string
+	Studio       bool
+	MinBedrooms  int
+	MaxBedrooms  int
+	MinPrice     int
+	MaxPrice     int
+	Furnished    string
+	Pets         string
+	Area         string
+	AreaExact    bool
+	Keywords     []string
+}
+
+func summarise(q Query) parsed {
+	p := parsed{
+		PropertyType: q.PropertyType,
+		Studio:       q.Studio,
+		MinBedrooms:  q.MinBedrooms,
+		MaxBedrooms:  q.MaxBedrooms,
+		MinPrice:     q.MinPrice,
+		MaxPrice:     q.MaxPrice,
+		Furnished:    q.Furnished,
+		Pets:         q.Pets,
+		AreaExact:    q.AreaExact,
+	}
+	if len(q.Keywords) > 0 {
+		p.Keywords = q.Keywords
+	}
+	if q.Area != nil {
+		p.Area = q.Area.Name
+	}
+	return p
+}
+
+func TestParse(t *testing.T) {
+	p := newTestParser(t)
+	tests := []struct {
+		text string
+		want parsed
+	}{
+		{"2 bed flat in Hackney under 2k",
+			parsed{PropertyType: PropertyFlat, MinBedrooms: 2, MaxBedrooms: 2, MaxPrice: 2000, Area: "Hackney", AreaExact: true}},
+		{"Studio in Shoreditch, max £1,500 pcm",
+			parsed{PropertyType: PropertyFlat, Studio: true, MaxPrice: 1500, Area: "Shoreditch", AreaExact: true}},
+		{"3 bedroom house near Clapham between 2500 and 3000",
+			parsed{PropertyType: PropertyHouse, MinBedrooms: 3, MaxBedrooms: 3, MinPrice: 2500, MaxPrice: 3000, Area: "Clapham", AreaExact: true}},
+		{"two bed apartment in Camden, furnished, pets ok",
+			parsed{PropertyType: PropertyFlat, MinBedrooms: 2, MaxBedrooms: 2, Furnished: Furnished, Pets: PetsOther, Area: "Camden", AreaExact: true}},
+		{"2-3 bed flat in Islington £1800-£2400",
+			parsed{PropertyType: PropertyFlat, MinBedrooms: 2, MaxBedrooms: 3, MinPrice: 1800, MaxPrice: 2400, Area: "Islington", AreaExact: true}},
+		{"between 1 and 2 beds in Angel",
+			parsed{MinBedrooms: 1, MaxBedrooms: 2, Area: "Angel", AreaExact: true}},
+		{"2+ beds in Brixton over 1500",
+			parsed{MinBedrooms: 2, MinPrice: 1500, Area: "Brixton", AreaExact: true}},
+		{"at least 2 bedrooms in SW11 from £2000",
+			parsed{MinBedrooms: 2, MinPrice: 2000, Area: "SW11", AreaExact: true}},
+		{"3 bdrm semi-detached house in Croydon £2,000 a month",
+			parsed{PropertyType: PropertyHouse, MinBedrooms: 3, MaxBedrooms: 3, MaxPrice: 2000, Area: "Croydon", AreaExact: true}},
+		{"unfurnished house with a garden and parking in Richmond",
+			parsed{PropertyType: PropertyHouse, Furnished: Unfurnished, Area: "Richmond upon Thames", AreaExact: true, Keywords: []string{"garden", "parking"}}},
+		{"part-furnished maisonette in Ealing, washer-dryer, bike storage",
+			parsed{PropertyType: PropertyFlat, Furnished: Furnished, Area: "Ealing", AreaExact: true, Keywords: []string{"washing machine", "bike storage"}}},
+		{"penthouse with a roof terrace, concierge and gym in Canary Wharf",
+			parsed{PropertyType: PropertyFlat, Area: "Canary Wharf", AreaExact: true, Keywords: []string{"terrace", "gym", "concierge"}}},
+		{"flat in Manchester under 1200",
+			parsed{PropertyType: PropertyFlat, MaxPrice: 1200, Area: "Manchester", AreaExact: true}},
+		{"2 bed house M14 5AB max 1100",
+			parsed{PropertyType: PropertyHouse, MinBedrooms: 2, MaxBedrooms: 2, MaxPrice: 1100, Area: "M14", AreaExact: true}},
+		{"en-suite room in Hackney, all inclusive",
+			parsed{Area: "Hackney", AreaExact: true, Keywords: []string{"bills included", "en suite"}}},
+
+		// Weekly rents are converted to monthly, and a period after a range applies to both
+		{"1 bed flat E1 400pw",
+			parsed{PropertyType: PropertyFlat, MinBedrooms: 1, MaxBedrooms: 1, MaxPrice: 1733, Area: "E1", AreaExact: true}},
+		{"1 bed flat 300 - 400 pw in Bow",
+			parsed{PropertyType: PropertyFlat, MinBedrooms: 1, MaxBedrooms: 1, MinPrice: 1300, MaxPrice: 1733, Area: "Bow", AreaExact: true}},
+
+		// Pets
+		{"flat with a dog in Peckham under 2000",
+			parsed{PropertyType: PropertyFlat, MaxPrice: 2000, Pets: PetsDog, Area: "Peckham", AreaExact: true}},
+		{"cat and dog friendly 2 bed house in Walthamstow up to £2.5k",
+			parsed{PropertyType: PropertyHouse, MinBedrooms: 2, MaxBedrooms: 2, MaxPrice: 2500, Pets: PetsOther, Area: "Walthamstow", AreaExact: true}},
+		{"no pets, bills included, 1 bed in Stratford",
+			parsed{MinBedrooms: 1, MaxBedrooms: 1, Pets: PetsNone, Area: "Stratford", AreaExact: true, Keywords: []string{"bills included"}}},
+
+		// Typos in the area are corrected
+		{"looking for a flat in hackny",
+			parsed{PropertyType: PropertyFlat, Area: "Hackney"}},
+
+		// Numbers that aren't rents are left alone
+		{"2 bed flat in Newham 1500",
+			parsed{PropertyType: PropertyFlat, MinBedrooms: 2, MaxBedrooms: 2, Area: "Newham", AreaExact: true}},
+		{"2 bed flat from 1 june in Hackney",
+			parsed{PropertyType: PropertyFlat, MinBedrooms: 2, MaxBedrooms: 2, Area: "Hackney", AreaExact: true}},
+
+		{"hello there", parsed{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := summarise(p.Parse(tt.text)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) =\n%+v, want\n%+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	p := newTestParser(t)
+	for _, text := range []string{"", "hello there", "what can you do?"} {
+		if q := p.Parse(text); !q.Empty() {
+			t.Errorf("Parse(%q) = %+v, want nothing understood", text, q)
+		}
+	}
+}
+
+func TestParsePriceRange(t *testing.T) {
+	tests := []struct {
+		text     string
+		min, max int
+		wantErr  bool
+	}{
+		{text: "1200 - 1800", min: 1200, max: 1800},
+		{text: "£1,200-£1,800", min: 1200, max: 1800},
+		{text: "1.2k to 1.8k", min: 1200, max: 1800},
+		{text: "300 - 400 pw", min: 1300, max: 1733},
+		{text: "1200", wantErr: true},
+		{text: "cheap - cheaper", wantErr: true},
+	}
+	for _, tt := range tests {
+		minPrice, maxPrice, err := ParsePriceRange(tt.text)
+		if (err != nil) != tt.wantErr || minPrice != tt.min || maxPrice != tt.max {
+			t.Errorf("ParsePriceRange(%q) = %d, %d, %v", tt.text, minPrice, maxPrice, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Fragments of the price patterns, shared with the query parser. An amount may have a
+// pound sign, thousands separators and a "k" suffix; a period marks weekly or monthly rent.
+const (
+	amountPattern = `(£\s*)?\b(\d+(?:,\d{3})*(?:\.\d+)?)\s*(k)?`
+	periodPattern = `(p\.?\s?w\.?|per\s+week|a\s+week|/\s*w(?:ee)?k|weekly|p\.?\s?c\.?\s?m\.?|per\s+month|a\s+month|/\s*mo(?:nth)?|monthly)`
+)
+
+var (
+	pricePattern  = regexp.MustCompile(`^` + amountPattern + `(?:\s*` + periodPattern + `)?$`)
+	weeklyPattern = regexp.MustCompile(`^(p\.?\s?w\.?|per\s+week|a\s+week|/\s*w(?:ee)?k|weekly)$`)
+)
+
+// weeksPerMonth converts weekly rent to the monthly rent providers search by.
+const weeksPerMonth = 52.0 / 12
+
+// ParsePrice reads a monthly rent such as "1800", "£1,800", "1.8k" or "1800 pcm". Weekly
+// rents such as "450pw" are converted to monthly.
+func ParsePrice(text string) (int, error) {
+	amount, period, err := parseAmount(text)
+	if err != nil {
+		return 0, err
+	}
+	return monthly(amount, period), nil
+}
+
+// ParsePriceRange reads a range of monthly rents such as "1200 - 1800" or "1.2k to 1.8k".
+// A period after the second price, as in "300 - 400 pw", applies to both.
+func ParsePriceRange(priceRange string) (int, int, error) {
+	text := strings.ToLower(strings.NewReplacer("–", "-", "—", "-").Replace(priceRange))
+	parts := strings.Split(text, "-")
+	if len(parts) != 2 {
+		parts = strings.Split(text, " to ")
+	}
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid price range format")
+	}
+
+	minAmount, minPeriod, err := parseAmount(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	maxAmount, maxPeriod, err := parseAmount(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	if minPeriod == "" {
+		minPeriod = maxPeriod
+	}
+	return monthly(minAmount, minPeriod), monthly(maxAmount, maxPeriod), nil
+}
+
+// parseAmount returns the amount in pounds and the period it is quoted for, if any.
+func parseAmount(text string) (float64, string, error) {
+	match := pricePattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(text)))
+	if match == nil {
+		return 0, "", fmt.Errorf("invalid price %q", text)
+	}
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(match[2], ",", ""), 64)
+	if err != nil {
+		return 0, "", err
+	}
+	if match[3] != "" {
+		amount *= 1000
+	}
+	return amount, match[4], nil
+}
+
+// monthly rounds an amount to whole pounds per month.
+func monthly(amount float64, period string) int {
+	if weeklyPattern.MatchString(period) {
+		amount *= weeksPerMonth
+	}
+	return int(math.Round(amount))
+}
@@ -0,0 +1,426 @@
+// Package query reads a property search typed in plain English, such as "2 bed flat in
+// Hackney under 2k furnished, pets ok", with a fixed set of rules. Nothing is sent to an
+// external service.
+package query
+
+import (
+	"regexp"
+	"rent_seekerbot/internal/geo"
+	"strconv"
+	"strings"
+)
+
+// Property types.
+const (
+	PropertyFlat  = "flat"
+	PropertyHouse = "house"
+)
+
+// Furnishing answers.
+const (
+	Furnished   = "furnished"
+	Unfurnished = "unfurnished"
+)
+
+// Pets answers. PetsOther is also used for pets in general, e.g. "pets ok".
+const (
+	PetsNone  = "none"
+	PetsCat   = "cat"
+	PetsDog   = "dog"
+	PetsOther = "other"
+)
+
+// minBareRange is the lowest price without a pound sign, "k" or period that is read as
+// rent, so "2 - 3" or "from 1 June" aren't taken for prices.
+const minBareRange = 100
+
+// minFuzzyArea is the shortest area phrase corrected for typos. Shorter words match too
+// many places.
+const minFuzzyArea = 4
+
+// Query is what was understood from a search. Zero values mean not mentioned.
+type Query struct {
+	PropertyType string
+	// Studio is set for studios, which have no bedrooms.
+	Studio bool
+	// MinBedrooms and MaxBedrooms bound the number of bedrooms. MaxBedrooms is 0 when
+	// there is no upper bound, as in "2+ bed".
+	MinBedrooms int
+	MaxBedrooms int
+	// MinPrice and MaxPrice are monthly rents in GBP.
+	MinPrice  int
+	MaxPrice  int
+	Furnished string
+	Pets      string
+	// Area is the place searched in. AreaExact is false when the text was corrected
+	// from a typo, and AreaText holds the text the area was read from.
+	Area      *geo.Place
+	AreaExact bool
+	AreaText  string
+	// AreaSuggestions holds the candidates when the area named is ambiguous.
+	AreaSuggestions []geo.Place
+	// Keywords are the features asked for, such as "garden", in the order of keywords.
+	Keywords []string
+}
+
+// HasBedrooms reports whether the number of bedrooms was given.
+func (q Query) HasBedrooms() bool {
+	return q.Studio || q.MinBedrooms > 0
+}
+
+// Empty reports whether nothing was understood.
+func (q Query) Empty() bool {
+	return q.PropertyType == "" && !q.HasBedrooms() && q.MinPrice == 0 && q.MaxPrice == 0 &&
+		q.Furnished == "" && q.Pets == "" && q.Area == nil && len(q.AreaSuggestions) == 0 && len(q.Keywords) == 0
+}
+
+const numberPattern = `(\d+|one|two|three|four|five|six)`
+const bedsPattern = `\s*-?\s*(?:bed(?:room)?s?|bdr?m?s?|br|bedder)\b`
+
+var (
+	bedroomRangePattern = regexp.MustCompile(`\b(?:between\s+)?` + numberPattern + `\s*(?:-|to|or|and)\s*` + numberPattern + bedsPattern)
+	bedroomMinPattern   = regexp.MustCompile(`\b(?:at\s+least\s+` + numberPattern + `|` + numberPattern + `\s*\+)` + bedsPattern)
+	bedroomPattern      = regexp.MustCompile(`\b` + numberPattern + bedsPattern)
+	studioPattern       = regexp.MustCompile(`\bstudios?\b`)
+
+	flatPattern  = regexp.MustCompile(`\b(?:flat|apartment|maisonette|penthouse)s?\b`)
+	housePattern = regexp.MustCompile(`\b(?:house|cottage|bungalow|townhouse|terraced|semi[\s-]detached|detached)s?\b`)
+
+	unfurnishedPattern = regexp.MustCompile(`\b(?:unfurnished|not\s+furnished|no\s+furniture)\b`)
+	furnishedPattern   = regexp.MustCompile(`\b(?:fully\s+|part(?:ly)?[\s-])?furnished\b`)
+
+	noPetsPattern  = regexp.MustCompile(`\b(?:no|without)\s+pets?\b|\bpet[\s-]?free\b`)
+	dogPattern     = regexp.MustCompile(`\b(?:dogs?|pupp(?:y|ies))\b`)
+	catPattern     = regexp.MustCompile(`\b(?:cats?|kittens?)\b`)
+	anyPetsPattern = regexp.MustCompile(`\bpets?(?:[\s-]+(?:ok|okay|allowed|welcome|considered|friendly))?\b`)
+
+	priceRangePattern = regexp.MustCompile(`(?:\bbetween\s+)?` + amountPattern + `(?:\s*` + periodPattern + `)?\s*(?:-|\bto\b|\band\b)\s*` + amountPattern + `(?:\s*` + periodPattern + `)?`)
+	maxPricePattern   = regexp.MustCompile(`(?:\bunder|\bbelow|\bless\s+than|\bmax(?:imum)?|\bup\s*to|\bno\s+more\s+than|\bbudget(?:\s+(?:of|is))?|<)\s*` + amountPattern + `(?:\s*` + periodPattern + `)?`)
+	minPricePattern   = regexp.MustCompile(`(?:\bover|\babove|\bmore\s+than|\bmin(?:imum)?|\bfrom|\bat\s+least|>)\s*` + amountPattern + `(?:\s*` + periodPattern + `)?`)
+	barePricePattern  = regexp.MustCompile(amountPattern + `(?:\s*` + periodPattern + `)?`)
+
+	areaPattern = regexp.MustCompile(`\b(?:in|near|around|close\s+to|by)\s+([^,;.]+)`)
+)
+
+// keywords are the features a search can ask for, with the patterns that find them in a
+// search or a listing's description.
+var keywords = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"garden", regexp.MustCompile(`\bgardens?\b`)},
+	{"balcony", regexp.MustCompile(`\bbalcon(?:y|ies)\b`)},
+	{"terrace", regexp.MustCompile(`\b(?:roof\s+)?terraces?\b`)},
+	{"parking", regexp.MustCompile(`\b(?:(?:off[\s-]street\s+)?parking|car\s+space|driveway)\b`)},
+	{"garage", regexp.MustCompile(`\bgarages?\b`)},
+	{"gym", regexp.MustCompile(`\bgym\b`)},
+	{"concierge", regexp.MustCompile(`\b(?:concierge|porter(?:age)?)\b`)},
+	{"lift", regexp.MustCompile(`\b(?:lift|elevator)\b`)},
+	{"dishwasher", regexp.MustCompile(`\bdishwasher\b`)},
+	{"washing machine", regexp.MustCompile(`\b(?:washing\s+machine|washer[\s-]dryer)\b`)},
+	{"bills included", regexp.MustCompile(`\bbills\s+(?:are\s+)?incl(?:uded|usive)?\b|\ball[\s-]inclusive\b`)},
+	{"en suite", regexp.MustCompile(`\ben[\s-]?suites?\b`)},
+	{"bike storage", regexp.MustCompile(`\b(?:bike|bicycle|cycle)\s+(?:storage|store|shed)\b`)},
+}
+
+var numberWords = map[string]int{"one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6}
+
+// fillerWords are skipped when looking for an area among the words left over.
+var fillerWords = map[string]bool{
+	"a": true, "an": true, "the": true, "i": true, "im": true, "we": true, "want": true, "need": true,
+	"looking": true, "look": true, "for": true, "to": true, "rent": true, "let": true, "with": true,
+	"and": true, "or": true, "please": true, "ok": true, "okay": true, "search": true, "find": true,
+	"me": true, "my": true, "us": true, "our": true, "show": true, "property": true, "home": true,
+	"place": true, "somewhere": true, "something": true, "allowed": true, "per": true,
+	"month": true, "week": true, "max": true, "only": true, "must": true, "be": true, "is": true,
+	"quiet": true, "nice": true, "cheap": true, "area": true, "of": true, "that": true, "has": true,
+	"in": true, "near": true, "around": true, "moving": true, "move": true, "live": true,
+}
+
+// Parser reads searches, resolving areas with a gazetteer.
+type Parser struct {
+	gazetteer *geo.Gazetteer
+}
+
+// NewParser returns a parser that resolves areas with gazetteer.
+func NewParser(gazetteer *geo.Gazetteer) *Parser {
+	return &Parser{gazetteer: gazetteer}
+}
+
+// Parse reads a search from text. Each rule removes the words it understood, and the
+// area is looked for in what is left, so "2 bed" is never mistaken for a place.
+func (p *Parser) Parse(text string) Query {
+	s := &scanner{text: normalise(text)}
+	var q Query
+
+	if m := s.take(bedroomRangePattern); m != nil {
+		q.MinBedrooms, q.MaxBedrooms = number(m[1]), number(m[2])
+		if q.MinBedrooms > q.MaxBedrooms {
+			q.MinBedrooms, q.MaxBedrooms = q.MaxBedrooms, q.MinBedrooms
+		}
+	} else if m := s.take(bedroomMinPattern); m != nil {
+		q.MinBedrooms = number(m[1] + m[2])
+	} else if m := s.take(bedroomPattern); m != nil {
+		q.MinBedrooms = number(m[1])
+		q.MaxBedrooms = q.MinBedrooms
+	}
+	if s.take(studioPattern) != nil {
+		q.Studio, q.MinBedrooms, q.MaxBedrooms = true, 0, 0
+		q.PropertyType = PropertyFlat
+	}
+
+	switch {
+	case s.take(flatPattern) != nil:
+		q.PropertyType = PropertyFlat
+	case s.take(housePattern) != nil:
+		q.PropertyType = PropertyHouse
+	}
+
+	switch {
+	case s.take(unfurnishedPattern) != nil:
+		q.Furnished = Unfurnished
+	case s.take(furnishedPattern) != nil:
+		q.Furnished = Furnished
+	}
+
+	dog, cat := s.take(dogPattern) != nil, s.take(catPattern) != nil
+	switch {
+	case s.take(noPetsPattern) != nil:
+		q.Pets = PetsNone
+	case dog && cat:
+		q.Pets = PetsOther
+	case dog:
+		q.Pets = PetsDog
+	case cat:
+		q.Pets = PetsCat
+	case s.take(anyPetsPattern) != nil:
+		q.Pets = PetsOther
+	}
+	// "with a dog, pets ok" mentions pets twice
+	s.take(anyPetsPattern)
+
+	for _, k := range keywords {
+		if s.take(k.pattern) != nil {
+			q.Keywords = append(q.Keywords, k.name)
+		}
+	}
+
+	p.parsePrice(s, &q)
+	p.parseArea(s, &q)
+	return q
+}
+
+// Mentions reports whether text, such as a listing's description, mentions keyword, one
+// of the keywords Parse reports. Unknown keywords are looked for as they are.
+func Mentions(text, keyword string) bool {
+	text = normalise(text)
+	for _, k := range keywords {
+		if k.name == keyword {
+			return k.pattern.MatchString(text)
+		}
+	}
+	return strings.Contains(text, strings.ToLower(keyword))
+}
+
+// parsePrice reads a price range, or an upper and lower bound, or a lone price, which is
+// taken as the most the user will pay.
+func (p *Parser) parsePrice(s *scanner, q *Query) {
+	if m := s.find(priceRangePattern); m != nil {
+		minPrice, minErr := ParsePrice(m.group(1, 4))
+		maxPrice, maxErr := ParsePrice(m.group(5, 8))
+		if minErr == nil && maxErr == nil && minPrice <= maxPrice && (marked(m, 1, 3, 4) || marked(m, 5, 7, 8) || maxPrice >= minBareRange) {
+			if m.text(4) == "" && m.text(8) != "" {
+				// "300 - 400 pw": the period applies to both
+				minPrice, _ = ParsePrice(m.group(1, 3) + " " + m.text(8))
+			}
+			s.remove(m)
+			q.MinPrice, q.MaxPrice = minPrice, maxPrice
+			return
+		}
+	}
+	if m := s.find(maxPricePattern); m != nil {
+		if price, err := ParsePrice(m.group(1, 4)); err == nil && (marked(m, 1, 3, 4) || price >= minBareRange) {
+			s.remove(m)
+			q.MaxPrice = price
+		}
+	}
+	if m := s.find(minPricePattern); m != nil {
+		if price, err := ParsePrice(m.group(1, 4)); err == nil && (marked(m, 1, 3, 4) || price >= minBareRange) {
+			s.remove(m)
+			q.MinPrice = price
+		}
+	}
+	if q.MinPrice != 0 || q.MaxPrice != 0 {
+		return
+	}
+	for _, m := range s.findAll(barePricePattern) {
+		if !marked(m, 1, 3, 4) {
+			continue
+		}
+		if price, err := ParsePrice(m.group(1, 4)); err == nil {
+			s.remove(m)
+			q.MaxPrice = price
+			return
+		}
+	}
+}
+
+// marked reports whether an amount has a pound sign, "k" or period, which tells it
+// apart from other numbers.
+func marked(m *match, groups ...int) bool {
+	for _, g := range groups {
+		if m.text(g) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseArea looks for the area after "in", "near" and the like, trying the longest run
+// of words first, then for any words left over that name a place exactly.
+func (p *Parser) parseArea(s *scanner, q *Query) {
+	for _, m := range s.findAll(areaPattern) {
+		words := trimFiller(strings.Fields(m.text(1)))
+		var suggestions []geo.Place
+		for n := len(words); n > 0; n-- {
+			phrase := strings.Join(words[:n], " ")
+			resolution := p.gazetteer.Resolve(phrase)
+			if resolution.Place != nil && (resolution.Exact || len(phrase) >= minFuzzyArea) {
+				q.Area, q.AreaExact, q.AreaText = resolution.Place, resolution.Exact, phrase
+				s.remove(m)
+				return
+			}
+			if suggestions == nil && len(resolution.Suggestions) > 0 {
+				suggestions = resolution.Suggestions
+				q.AreaText = phrase
+			}
+		}
+		if suggestions != nil {
+			q.AreaSuggestions = suggestions
+			s.remove(m)
+			return
+		}
+	}
+
+	words := strings.Fields(strings.Map(func(r rune) rune {
+		if r == ',' || r == ';' || r == '.' {
+			return ' '
+		}
+		return r
+	}, s.text))
+	for n := min(3, len(words)); n > 0; n-- {
+		for i := 0; i+n <= len(words); i++ {
+			run := words[i : i+n]
+			if fillerWords[run[0]] || fillerWords[run[n-1]] {
+				continue
+			}
+			phrase := strings.Join(run, " ")
+			if resolution := p.gazetteer.Resolve(phrase); resolution.Place != nil && resolution.Exact {
+				q.Area, q.AreaExact, q.AreaText = resolution.Place, true, phrase
+				return
+			}
+		}
+	}
+}
+
+// trimFiller drops filler words from both ends, e.g. "the" in "in the city".
+func trimFiller(words []string) []string {
+	for len(words) > 0 && fillerWords[words[0]] {
+		words = words[1:]
+	}
+	for len(words) > 0 && fillerWords[words[len(words)-1]] {
+		words = words[:len(words)-1]
+	}
+	return words
+}
+
+// normalise lowercases the text, unifies dashes and drops apostrophes, keeping the
+// punctuation that separates parts of a search.
+func normalise(text string) string {
+	text = strings.ToLower(text)
+	text = strings.NewReplacer("–", "-", "—", "-", "'", "", "’", "").Replace(text)
+	return " " + strings.Join(strings.Fields(text), " ") + " "
+}
+
+func number(text string) int {
+	if n, ok := numberWords[text]; ok {
+		return n
+	}
+	n, _ := strconv.Atoi(text)
+	return n
+}
+
+// scanner holds the text not yet understood.
+type scanner struct {
+	text string
+}
+
+// match is a pattern matched in the scanner's text, as submatch byte offsets.
+type match struct {
+	s       *scanner
+	indexes []int
+}
+
+// text returns a submatch, or "" if it didn't take part.
+func (m *match) text(group int) string {
+	start, end := m.indexes[2*group], m.indexes[2*group+1]
+	if start < 0 {
+		return ""
+	}
+	return m.s.text[start:end]
+}
+
+// group returns the text from the first to the last submatch that took part, between
+// the given groups.
+func (m *match) group(first, last int) string {
+	start, end := -1, -1
+	for g := first; g <= last; g++ {
+		if m.indexes[2*g] < 0 {
+			continue
+		}
+		if start < 0 {
+			start = m.indexes[2*g]
+		}
+		end = m.indexes[2*g+1]
+	}
+	if start < 0 {
+		return ""
+	}
+	return m.s.text[start:end]
+}
+
+func (s *scanner) find(pattern *regexp.Regexp) *match {
+	indexes := pattern.FindStringSubmatchIndex(s.text)
+	if indexes == nil {
+		return nil
+	}
+	return &match{s, indexes}
+}
+
+func (s *scanner) findAll(pattern *regexp.Regexp) []*match {
+	var matches []*match
+	for _, indexes := range pattern.FindAllStringSubmatchIndex(s.text, -1) {
+		matches = append(matches, &match{s, indexes})
+	}
+	return matches
+}
+
+// remove blanks out a match, keeping the offsets of the rest of the text.
+func (s *scanner) remove(m *match) {
+	start, end := m.indexes[0], m.indexes[1]
+	s.text = s.text[:start] + strings.Repeat(" ", end-start) + s.text[end:]
+}
+
+// take finds and removes pattern, returning its submatches.
+func (s *scanner) take(pattern *regexp.Regexp) []string {
+	m := s.find(pattern)
+	if m == nil {
+		return nil
+	}
+	groups := make([]string, len(m.indexes)/2)
+	for g := range groups {
+		groups[g] = m.text(g)
+	}
+	s.remove(m)
+	return groups
+}
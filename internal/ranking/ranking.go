@@ -0,0 +1,240 @@
+// Package ranking orders search results by how well they suit a search, or by price,
+// age, distance or commute time.
+package ranking
+
+import (
+	"math"
+	"rent_seekerbot/internal/geo"
+	"rent_seekerbot/internal/query"
+	"rent_seekerbot/internal/real_estate_api"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Orders results can be sorted in. The values are stored in the users table, so they
+// must not change.
+const (
+	BestMatch = "best"
+	Cheapest  = "cheapest"
+	Newest    = "newest"
+	Nearest   = "nearest"
+	Quickest  = "quickest"
+)
+
+// Orders lists the orders in the order they are offered.
+var Orders = []string{BestMatch, Cheapest, Newest, Nearest, Quickest}
+
+// Weights of the signals in the match score. They add up to 100.
+const (
+	budgetWeight   = 30
+	valueWeight    = 20
+	recencyWeight  = 15
+	distanceWeight = 15
+	photoWeight    = 10
+	keywordWeight  = 10
+)
+
+const (
+	// overBudgetMargin is how far over the maximum, as a fraction of it, a price scores
+	// nothing for budget fit.
+	overBudgetMargin = 0.2
+	// valueMargin is how far below the area median, as a fraction of it, a price scores
+	// full marks for value, and how far above it scores nothing.
+	valueMargin = 0.2
+	// minComparables is the fewest listings with the same number of bedrooms needed for
+	// their median to be a fair price.
+	minComparables = 3
+	// staleDays is the age in days at which a listing scores nothing for recency.
+	staleDays = 30
+	// defaultDistanceMiles is the distance that scores nothing for distance when the
+	// search has no radius.
+	defaultDistanceMiles = 3.0
+	// neutral is the score of a signal that can't be measured, e.g. the age of a
+	// listing without a date, so it neither helps nor hurts.
+	neutral = 0.5
+)
+
+// Search is what listings are scored against. Zero values mean not set.
+type Search struct {
+	MinPrice int
+	MaxPrice int
+	// Latitude and Longitude are the centre of the searched area, and RadiusMiles the
+	// distance from it the user is willing to live.
+	Latitude    float64
+	Longitude   float64
+	RadiusMiles float64
+	// Keywords are the features asked for, such as "garden".
+	Keywords []string
+	// Commute estimates the travel time in minutes from a point to the user's commute
+	// destination, if they have one. It returns false when the time isn't known.
+	Commute func(latitude, longitude float64) (int, bool)
+}
+
+// Result is a listing with its match score from 0 to 100.
+type Result struct {
+	Property real_estate_api.Property
+	Score    int
+	// Miles is the distance from the centre of the search, or -1 when either has no
+	// coordinates.
+	Miles float64
+	// Listed is when the listing went live, zero when unknown.
+	Listed time.Time
+	// Minutes is the commute time to the search's destination, or -1 when the search
+	// has none or the time isn't known.
+	Minutes int
+}
+
+// Rank scores the listings against the search and sorts them in order, which is one of
+// Orders and falls back to BestMatch. Ties are broken by score, then by the provider's
+// order. Recency is measured from now.
+func Rank(properties []real_estate_api.Property, search Search, order string, now time.Time) []Result {
+	medians := medianPrices(properties)
+	results := make([]Result, 0, len(properties))
+	for _, property := range properties {
+		result := Result{Property: property, Miles: -1, Minutes: -1}
+		if property.Latitude != 0 || property.Longitude != 0 {
+			if search.Latitude != 0 || search.Longitude != 0 {
+				result.Miles = geo.DistanceMiles(search.Latitude, search.Longitude, property.Latitude, property.Longitude)
+			}
+			if search.Commute != nil {
+				if minutes, ok := search.Commute(property.Latitude, property.Longitude); ok {
+					result.Minutes = minutes
+				}
+			}
+		}
+		if listed, ok := property.ListedAt(); ok {
+			result.Listed = listed
+		}
+
+		score := budgetWeight*budgetFit(property.Price, search) +
+			valueWeight*value(property.Price, medians[property.Bedrooms]) +
+			recencyWeight*recency(result.Listed, now) +
+			distanceWeight*closeness(result.Miles, search.RadiusMiles) +
+			photoWeight*photos(property) +
+			keywordWeight*keywordMatch(property.Description, search.Keywords)
+		result.Score = int(math.Round(score))
+		results = append(results, result)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		switch order {
+		case Cheapest:
+			if a.Property.Price != b.Property.Price {
+				return a.Property.Price < b.Property.Price
+			}
+		case Newest:
+			if !a.Listed.Equal(b.Listed) {
+				// Listings without a date come last
+				return a.Listed.After(b.Listed)
+			}
+		case Nearest:
+			if a.Miles != b.Miles {
+				return b.Miles < 0 || a.Miles >= 0 && a.Miles < b.Miles
+			}
+		case Quickest:
+			if a.Minutes != b.Minutes {
+				return b.Minutes < 0 || a.Minutes >= 0 && a.Minutes < b.Minutes
+			}
+		}
+		return a.Score > b.Score
+	})
+	return results
+}
+
+// IsOrder reports whether order is one of Orders.
+func IsOrder(order string) bool {
+	return slices.Contains(Orders, order)
+}
+
+// budgetFit is 1 for the cheapest price in the budget, falling to 0.5 at its maximum and
+// to 0 at overBudgetMargin over it. Prices under the budget score like its minimum.
+func budgetFit(price int, search Search) float64 {
+	if search.MaxPrice <= 0 {
+		return neutral
+	}
+	maxPrice := float64(search.MaxPrice)
+	if p := float64(price); p > maxPrice {
+		return math.Max(0, 0.5*(1-(p-maxPrice)/(overBudgetMargin*maxPrice)))
+	}
+	span := float64(search.MaxPrice - search.MinPrice)
+	if span <= 0 {
+		return 1
+	}
+	return 1 - 0.5*math.Max(0, float64(price-search.MinPrice))/span
+}
+
+// value compares a price with the median of comparable listings: 1 at valueMargin below
+// it, 0.5 at the median and 0 at valueMargin above it.
+func value(price, median int) float64 {
+	if median <= 0 {
+		return neutral
+	}
+	difference := float64(median-price) / float64(median)
+	return math.Max(0, math.Min(1, 0.5+0.5*difference/valueMargin))
+}
+
+// medianPrices returns the median price of the listings by number of bedrooms, for the
+// numbers with at least minComparables listings.
+func medianPrices(properties []real_estate_api.Property) map[int]int {
+	prices := make(map[int][]int)
+	for _, property := range properties {
+		prices[property.Bedrooms] = append(prices[property.Bedrooms], property.Price)
+	}
+	medians := make(map[int]int)
+	for bedrooms, p := range prices {
+		if len(p) < minComparables {
+			continue
+		}
+		slices.Sort(p)
+		if n := len(p); n%2 == 1 {
+			medians[bedrooms] = p[n/2]
+		} else {
+			medians[bedrooms] = (p[n/2-1] + p[n/2]) / 2
+		}
+	}
+	return medians
+}
+
+// recency is 1 for a listing that went live now, falling to 0 at staleDays old.
+func recency(listed, now time.Time) float64 {
+	if listed.IsZero() {
+		return neutral
+	}
+	days := now.Sub(listed).Hours() / 24
+	return math.Max(0, math.Min(1, 1-days/staleDays))
+}
+
+// closeness is 1 at the centre of the search, falling to 0 at the edge of its radius.
+func closeness(miles, radiusMiles float64) float64 {
+	if miles < 0 {
+		return neutral
+	}
+	if radiusMiles <= 0 {
+		radiusMiles = defaultDistanceMiles
+	}
+	return math.Max(0, 1-miles/radiusMiles)
+}
+
+// photos is 1 for listings with a photo.
+func photos(property real_estate_api.Property) float64 {
+	if property.ImageURL == "" {
+		return 0
+	}
+	return 1
+}
+
+// keywordMatch is the fraction of the keywords the description mentions.
+func keywordMatch(description string, keywords []string) float64 {
+	if len(keywords) == 0 {
+		return neutral
+	}
+	matched := 0
+	for _, keyword := range keywords {
+		if query.Mentions(description, keyword) {
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(keywords))
+}
@@ -0,0 +1,247 @@
+package ranking
+
+import (
+	"math"
+	"rent_seekerbot/internal/real_estate_api"
+	"slices"
+	"testing"
+	"time"
+)
+
+// now is the end of May 2024; listing dates are in UK time, an hour ahead of UTC then.
+var now = time.Date(2024, 5, 31, 11, 0, 0, 0, time.UTC)
+
+const centreLatitude = 51.5
+
+// testListings are one bedroom flats north of the search centre, 0.01 degrees of latitude
+// being about 0.69 miles.
+var testListings = []real_estate_api.Property{
+	{ID: "a", Price: 1200, Bedrooms: 1, FirstPublished: "2024-05-30 12:00:00", Latitude: 51.50, Longitude: 0.0001},
+	{ID: "b", Price: 900, Bedrooms: 1, Latitude: 51.51, Longitude: 0.0001},
+	{ID: "c", Price: 1000, Bedrooms: 1, FirstPublished: "2024-05-20 12:00:00"},
+	{ID: "d", Price: 1100, Bedrooms: 1, FirstPublished: "2024-05-29 12:00:00", Latitude: 51.52, Longitude: 0.0001},
+}
+
+// commuteMinutes knows the commute from a and d only.
+func commuteMinutes(latitude, longitude float64) (int, bool) {
+	switch latitude {
+	case 51.50:
+		return 30, true
+	case 51.52:
+		return 20, true
+	}
+	return 0, false
+}
+
+var testSearch = Search{MinPrice: 800, MaxPrice: 1200, Latitude: centreLatitude, Longitude: 0.0001, Commute: commuteMinutes}
+
+func ids(results []Result) []string {
+	var ids []string
+	for _, result := range results {
+		ids = append(ids, result.Property.ID)
+	}
+	return ids
+}
+
+func TestRankOrders(t *testing.T) {
+	tests := []struct {
+		order string
+		want  []string
+	}{
+		{Cheapest, []string{"b", "c", "d", "a"}},
+		// Undated listings come last
+		{Newest, []string{"a", "d", "c", "b"}},
+		// Unlocated listings come last
+		{Nearest, []string{"a", "b", "d", "c"}},
+		// Listings with an unknown commute come last, by score
+		{Quickest, []string{"d", "a", "b", "c"}},
+		// b scores 67, c 57, d 53 and a 52: see TestRankScores
+		{BestMatch, []string{"b", "c", "d", "a"}},
+		{"", []string{"b", "c", "d", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			if got := ids(Rank(testListings, testSearch, tt.order, now)); !slices.Equal(got, tt.want) {
+				t.Errorf("Rank() by %q = %v, want %v", tt.order, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRankScores(t *testing.T) {
+	// The median price is 1050. Photos score nothing and keywords are neutral (5) for all.
+	want := map[string]int{
+		// Budget 0.875 (26.25), value 0.86 (17.14), undated (7.5), 0.69 miles (11.55)
+		"b": 67,
+		// Budget 0.75 (22.5), value 0.62 (12.38), 11 days old (9.5), unlocated (7.5)
+		"c": 57,
+		// Budget 0.625 (18.75), value 0.38 (7.62), 2 days old (14), 1.38 miles (8.09)
+		"d": 53,
+		// Budget 0.5 (15), value 0.14 (2.86), 1 day old (14.5), at the centre (15)
+		"a": 52,
+	}
+	for _, result := range Rank(testListings, testSearch, BestMatch, now) {
+		if result.Score != want[result.Property.ID] {
+			t.Errorf("%s scored %d, want %d", result.Property.ID, result.Score, want[result.Property.ID])
+		}
+	}
+}
+
+func TestRankResultDetails(t *testing.T) {
+	results := make(map[string]Result)
+	for _, result := range Rank(testListings, testSearch, BestMatch, now) {
+		results[result.Property.ID] = result
+	}
+
+	if a := results["a"]; a.Miles != 0 || a.Minutes != 30 || !a.Listed.Equal(time.Date(2024, 5, 30, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("a = %+v, want 0 miles, 30 minutes and listed on 30 May at 11:00 UTC", a)
+	}
+	if b := results["b"]; math.Abs(b.Miles-0.69) > 0.01 || b.Minutes != -1 || !b.Listed.IsZero() {
+		t.Errorf("b = %+v, want 0.69 miles, an unknown commute and no date", b)
+	}
+	if c := results["c"]; c.Miles != -1 || c.Minutes != -1 {
+		t.Errorf("c = %+v, want unknown distance and commute", c)
+	}
+}
+
+func TestRankTiesKeepTheProvidersOrder(t *testing.T) {
+	properties := []real_estate_api.Property{{ID: "first", Price: 1000}, {ID: "second", Price: 1000}, {ID: "third", Price: 1000}}
+	for _, order := range Orders {
+		if got := ids(Rank(properties, Search{}, order, now)); !slices.Equal(got, []string{"first", "second", "third"}) {
+			t.Errorf("Rank() by %q = %v, want the provider's order", order, got)
+		}
+	}
+}
+
+func TestRankValueNeedsComparables(t *testing.T) {
+	// Nothing is known about these listings but their price, so every other signal is
+	// neutral: 30*0.5 + 15*0.5 + 15*0.5 + 10*0.5 = 35, plus value
+	score := func(properties []real_estate_api.Property) map[int]int {
+		scores := make(map[int]int)
+		for _, result := range Rank(properties, Search{}, BestMatch, now) {
+			scores[result.Property.Price] = result.Score
+		}
+		return scores
+	}
+
+	// Two listings aren't enough for a fair price, so value is neutral too
+	two := score([]real_estate_api.Property{{Price: 900, Bedrooms: 1}, {Price: 1100, Bedrooms: 1}})
+	if two[900] != 45 || two[1100] != 45 {
+		t.Errorf("scores with two comparables = %v, want 45 each", two)
+	}
+
+	// With three the median is 1000: 900 is 10% below it and 1100 10% above
+	three := score([]real_estate_api.Property{{Price: 900, Bedrooms: 1}, {Price: 1000, Bedrooms: 1}, {Price: 1100, Bedrooms: 1}})
+	if three[900] != 50 || three[1000] != 45 || three[1100] != 40 {
+		t.Errorf("scores with three comparables = %v, want 50, 45 and 40", three)
+	}
+
+	// Listings with other numbers of bedrooms aren't comparable
+	mixed := score([]real_estate_api.Property{{Price: 900, Bedrooms: 1}, {Price: 1000, Bedrooms: 2}, {Price: 1100, Bedrooms: 3}})
+	if mixed[900] != 45 || mixed[1100] != 45 {
+		t.Errorf("scores with no comparables = %v, want 45 each", mixed)
+	}
+}
+
+func TestBudgetFit(t *testing.T) {
+	budget := Search{MinPrice: 800, MaxPrice: 1200}
+	tests := []struct {
+		name   string
+		price  int
+		search Search
+		want   float64
+	}{
+		{"no budget", 1000, Search{}, neutral},
+		{"at the minimum", 800, budget, 1},
+		{"under the minimum", 600, budget, 1},
+		{"halfway", 1000, budget, 0.75},
+		{"at the maximum", 1200, budget, 0.5},
+		{"10% over", 1320, budget, 0.25},
+		{"20% over", 1440, budget, 0},
+		{"far over", 2000, budget, 0},
+		{"fixed budget", 1000, Search{MinPrice: 1000, MaxPrice: 1000}, 1},
+		{"maximum only", 600, Search{MaxPrice: 1200}, 0.75},
+	}
+	for _, tt := range tests {
+		if got := budgetFit(tt.price, tt.search); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: budgetFit(%d) = %v, want %v", tt.name, tt.price, got, tt.want)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	tests := []struct {
+		price, median int
+		want          float64
+	}{
+		{1000, 0, neutral},
+		{1000, 1000, 0.5},
+		{900, 1000, 0.75},
+		{800, 1000, 1},
+		{500, 1000, 1},
+		{1100, 1000, 0.25},
+		{1200, 1000, 0},
+		{1500, 1000, 0},
+	}
+	for _, tt := range tests {
+		if got := value(tt.price, tt.median); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("value(%d, %d) = %v, want %v", tt.price, tt.median, got, tt.want)
+		}
+	}
+}
+
+func TestMedianPrices(t *testing.T) {
+	properties := []real_estate_api.Property{
+		{Price: 1100, Bedrooms: 1}, {Price: 900, Bedrooms: 1}, {Price: 1000, Bedrooms: 1},
+		{Price: 1400, Bedrooms: 2}, {Price: 1500, Bedrooms: 2}, {Price: 1700, Bedrooms: 2}, {Price: 1600, Bedrooms: 2},
+		{Price: 2000, Bedrooms: 3}, {Price: 2100, Bedrooms: 3},
+	}
+	medians := medianPrices(properties)
+	if medians[1] != 1000 || medians[2] != 1550 {
+		t.Errorf("medians = %v, want 1000 for one bedroom and 1550 for two", medians)
+	}
+	if median, ok := medians[3]; ok {
+		t.Errorf("three bedrooms have a median of %d from fewer than %d listings", median, minComparables)
+	}
+}
+
+func TestRecency(t *testing.T) {
+	tests := []struct {
+		name   string
+		listed time.Time
+		want   float64
+	}{
+		{"no date", time.Time{}, neutral},
+		{"just listed", now, 1},
+		{"listed in the future", now.Add(time.Hour), 1},
+		{"15 days old", now.AddDate(0, 0, -15), 0.5},
+		{"stale", now.AddDate(0, 0, -staleDays), 0},
+		{"older than stale", now.AddDate(0, 0, -90), 0},
+	}
+	for _, tt := range tests {
+		if got := recency(tt.listed, now); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: recency() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCloseness(t *testing.T) {
+	tests := []struct {
+		name               string
+		miles, radiusMiles float64
+		want               float64
+	}{
+		{"unlocated", -1, 2, neutral},
+		{"at the centre", 0, 2, 1},
+		{"halfway to the edge", 1, 2, 0.5},
+		{"at the edge", 2, 2, 0},
+		{"outside the radius", 5, 2, 0},
+		{"no radius", 1.5, 0, 0.5},
+		{"beyond the default distance", 4, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := closeness(tt.miles, tt.radiusMiles); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: closeness() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Package ratelimit implements token buckets for throttling outgoing messages and
+// limiting how often users can trigger expensive work.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket holding up to Burst tokens, refilled at Rate tokens per
+// second. It is not safe for concurrent use; Keyed adds locking.
+type Bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket returns a full bucket.
+func NewBucket(rate float64, burst int) *Bucket {
+	return &Bucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+func (b *Bucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// Take removes a token and returns how long the caller must wait before using it. The
+// bucket can go into debt, so callers that wait are served in the order they called Take.
+func (b *Bucket) Take(now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return b.wait(-b.tokens)
+}
+
+// Allow removes a token if one is available. Otherwise it takes nothing and returns how
+// long until a token will be available.
+func (b *Bucket) Allow(now time.Time) (bool, time.Duration) {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, b.wait(1 - b.tokens)
+}
+
+// full reports whether the bucket has refilled completely, so it can be forgotten.
+func (b *Bucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+func (b *Bucket) wait(tokens float64) time.Duration {
+	return time.Duration(tokens / b.rate * float64(time.Second))
+}
+
+// Keyed holds one bucket per key, such as a chat or user ID. Buckets that have refilled
+// completely are dropped from time to time to keep memory bounded.
+type Keyed struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	buckets map[int64]*Bucket
+	swept   time.Time
+}
+
+// sweepInterval is how often Keyed drops buckets that have refilled.
+const sweepInterval = 10 * time.Minute
+
+func NewKeyed(rate float64, burst int) *Keyed {
+	return &Keyed{rate: rate, burst: burst, buckets: make(map[int64]*Bucket)}
+}
+
+// Take is Bucket.Take for the key's bucket.
+func (k *Keyed) Take(key int64, now time.Time) time.Duration {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.bucket(key, now).Take(now)
+}
+
+// Allow is Bucket.Allow for the key's bucket.
+func (k *Keyed) Allow(key int64, now time.Time) (bool, time.Duration) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.bucket(key, now).Allow(now)
+}
+
+func (k *Keyed) bucket(key int64, now time.Time) *Bucket {
+	if now.Sub(k.swept) > sweepInterval {
+		for id, bucket := range k.buckets {
+			if bucket.full(now) {
+				delete(k.buckets, id)
+			}
+		}
+		k.swept = now
+	}
+	bucket, ok := k.buckets[key]
+	if !ok {
+		bucket = NewBucket(k.rate, k.burst)
+		k.buckets[key] = bucket
+	}
+	return bucket
+}
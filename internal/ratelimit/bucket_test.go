@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func at(seconds float64) time.Time {
+	return epoch.Add(time.Duration(seconds * float64(time.Second)))
+}
+
+func TestBucketTake(t *testing.T) {
+	b := NewBucket(2, 3)
+
+	// The burst is free, then callers queue up half a second apart
+	steps := []struct {
+		now  float64
+		want time.Duration
+	}{
+		{0, 0},
+		{0, 0},
+		{0, 0},
+		{0, 500 * time.Millisecond},
+		{0, time.Second},
+		{0, 1500 * time.Millisecond},
+		// A second later two of the three tokens owed have come in
+		{1, time.Second},
+	}
+	for i, step := range steps {
+		if got := b.Take(at(step.now)); got != step.want {
+			t.Errorf("Take #%d at %vs = %v, want %v", i+1, step.now, got, step.want)
+		}
+	}
+}
+
+func TestBucketAllow(t *testing.T) {
+	b := NewBucket(4, 2)
+
+	for i := range 2 {
+		if ok, wait := b.Allow(at(0)); !ok || wait != 0 {
+			t.Fatalf("Allow #%d = %v, %v; want true, 0", i+1, ok, wait)
+		}
+	}
+	// Refusals take nothing, so the wait doesn't grow
+	for range 2 {
+		if ok, wait := b.Allow(at(0)); ok || wait != 250*time.Millisecond {
+			t.Errorf("Allow on an empty bucket = %v, %v; want false, 250ms", ok, wait)
+		}
+	}
+	if ok, wait := b.Allow(at(0.1)); ok || wait != 150*time.Millisecond {
+		t.Errorf("Allow after 100ms = %v, %v; want false, 150ms", ok, wait)
+	}
+	if ok, _ := b.Allow(at(0.25)); !ok {
+		t.Error("Allow after 250ms was refused")
+	}
+}
+
+func TestBucketRefillIsCappedAtBurst(t *testing.T) {
+	b := NewBucket(10, 2)
+	b.Take(at(0))
+	b.Take(at(0))
+
+	// An hour idle still only buys the burst
+	for i := range 2 {
+		if wait := b.Take(at(3600)); wait != 0 {
+			t.Errorf("Take #%d after an hour = %v, want 0", i+1, wait)
+		}
+	}
+	if wait := b.Take(at(3600)); wait != 100*time.Millisecond {
+		t.Errorf("Take beyond the burst = %v, want 100ms", wait)
+	}
+}
+
+func TestKeyedKeepsKeysApart(t *testing.T) {
+	k := NewKeyed(1, 1)
+
+	if wait := k.Take(1, at(0)); wait != 0 {
+		t.Errorf("first Take for key 1 = %v, want 0", wait)
+	}
+	if wait := k.Take(1, at(0)); wait != time.Second {
+		t.Errorf("second Take for key 1 = %v, want 1s", wait)
+	}
+	if wait := k.Take(2, at(0)); wait != 0 {
+		t.Errorf("first Take for key 2 = %v, want 0", wait)
+	}
+	if ok, wait := k.Allow(2, at(0.5)); ok || wait != 500*time.Millisecond {
+		t.Errorf("Allow for key 2 = %v, %v; want false, 500ms", ok, wait)
+	}
+}
+
+func TestKeyedSweepsRefilledBuckets(t *testing.T) {
+	k := NewKeyed(0.01, 1)
+	k.Take(1, at(0))
+	k.Take(2, at(550))
+	k.Take(2, at(550))
+	if len(k.buckets) != 2 {
+		t.Fatalf("%d buckets before the sweep, want 2", len(k.buckets))
+	}
+
+	// Past the sweep interval key 1 has refilled, while key 2 is still in debt
+	k.Take(3, epoch.Add(sweepInterval+time.Second))
+	if _, ok := k.buckets[1]; ok {
+		t.Error("key 1's refilled bucket wasn't swept")
+	}
+	if _, ok := k.buckets[2]; !ok {
+		t.Error("key 2's bucket was swept while in debt")
+	}
+}
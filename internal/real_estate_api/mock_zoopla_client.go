@@ -1,21 +1,37 @@
 package real_estate_api
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"math/rand"
+	"rent_seekerbot/internal/geo"
 	"strings"
+	"time"
+)
+
+// Central London, used when the searched area is not in the gazetteer.
+const (
+	defaultMockLatitude  = 51.5074
+	defaultMockLongitude = -0.1278
 )
 
 type MockZooplaClient struct {
+	gazetteer *geo.Gazetteer
 }
 
 func NewMockZooplaClient() *MockZooplaClient {
-	return &MockZooplaClient{}
+	gazetteer, err := geo.NewGazetteer()
+	if err != nil {
+		slog.Warn("Mock client could not load gazetteer, using central London for all listings", "error", err)
+	}
+	return &MockZooplaClient{gazetteer: gazetteer}
 }
 
-func (c *MockZooplaClient) SearchProperties(area string, minPrice, maxPrice, bedrooms int, propertyType string) ([]Property, error) {
+func (c *MockZooplaClient) SearchProperties(ctx context.Context, area string, minPrice, maxPrice, bedrooms int, propertyType string) ([]Property, error) {
 	var properties []Property
 	numProperties := rand.Intn(5) + 1 // Return 1-5 properties
+	lat, lon := c.centre(area)
 
 	for i := 0; i < numProperties; i++ {
 		price := rand.Intn(maxPrice-minPrice+1) + minPrice
@@ -24,8 +40,17 @@ func (c *MockZooplaClient) SearchProperties(area string, minPrice, maxPrice, bed
 			Address:  fmt.Sprintf("%d %s, %s", rand.Intn(100)+1, randomStreet(), area),
 			Price:    price,
 			Bedrooms: bedrooms,
-			Description: fmt.Sprintf("A lovely %d bedroom %s in %s. This property is %s and available for £%d per month.",
-				bedrooms, strings.ToLower(propertyType), area, randomCondition(), price),
+			Description: fmt.Sprintf("A lovely %d bedroom %s in %s. This property is %s and available for £%d per month.%s%s",
+				bedrooms, strings.ToLower(propertyType), area, randomCondition(), price, randomFeatureNote(), randomPetsNote()),
+			// Scatter listings within roughly three miles of the area centre
+			Latitude:  lat + (rand.Float64()-0.5)*0.08,
+			Longitude: lon + (rand.Float64()-0.5)*0.12,
+			// Listed over the last fortnight
+			FirstPublished: time.Now().Add(-time.Duration(rand.Intn(14*24)) * time.Hour).In(ukTime).Format(publishedLayout),
+		}
+		property.URL = fmt.Sprintf("https://example.com/listings/%s", property.ID)
+		if rand.Intn(4) > 0 {
+			property.ImageURL = fmt.Sprintf("https://example.com/photos/%s.jpg", property.ID)
 		}
 		properties = append(properties, property)
 	}
@@ -33,11 +58,37 @@ func (c *MockZooplaClient) SearchProperties(area string, minPrice, maxPrice, bed
 	return properties, nil
 }
 
-func (c *MockZooplaClient) TestApiConnection() error {
+func (c *MockZooplaClient) SearchPropertiesWithPets(ctx context.Context, area string, minPrice, maxPrice, bedrooms int, propertyType, pet string) ([]Property, error) {
+	properties, err := c.SearchProperties(ctx, area, minPrice, maxPrice, bedrooms, propertyType)
+	if err != nil {
+		return nil, err
+	}
+	// Pretend the listings were filtered server side
+	var filtered []Property
+	for _, property := range properties {
+		if ClassifyPets(property.Description, pet) != PetsNotAllowed {
+			property.Pets = PetsAllowed
+			filtered = append(filtered, property)
+		}
+	}
+	return filtered, nil
+}
+
+func (c *MockZooplaClient) TestApiConnection(ctx context.Context) error {
 	// Always return success for the mock
 	return nil
 }
 
+// centre returns the centroid of the searched area, or central London if it is unknown.
+func (c *MockZooplaClient) centre(area string) (float64, float64) {
+	if c.gazetteer != nil {
+		if place, ok := c.gazetteer.Lookup(area); ok {
+			return place.Latitude, place.Longitude
+		}
+	}
+	return defaultMockLatitude, defaultMockLongitude
+}
+
 func randomStreet() string {
 	streets := []string{"High Street", "Church Road", "Main Street", "Park Road", "London Road"}
 	return streets[rand.Intn(len(streets))]
@@ -47,3 +98,13 @@ func randomCondition() string {
 	conditions := []string{"well-maintained", "newly renovated", "in good condition", "charming"}
 	return conditions[rand.Intn(len(conditions))]
 }
+
+func randomFeatureNote() string {
+	notes := []string{"", " It has a private garden.", " It comes with a balcony.", " Off-street parking included."}
+	return notes[rand.Intn(len(notes))]
+}
+
+func randomPetsNote() string {
+	notes := []string{"", " Pets considered.", " Sorry, no pets.", " Pet-friendly landlord."}
+	return notes[rand.Intn(len(notes))]
+}
@@ -0,0 +1,73 @@
+package real_estate_api
+
+import "strings"
+
+// PetPolicy describes whether a listing accepts pets.
+type PetPolicy string
+
+const (
+	PetsUnknown    PetPolicy = "unknown"
+	PetsAllowed    PetPolicy = "allowed"
+	PetsNotAllowed PetPolicy = "not allowed"
+)
+
+// Phrases are matched against lowercased descriptions. Refusals are checked first, since
+// "no pets allowed" also contains "pets allowed".
+var (
+	noPetsPhrases = []string{
+		"no pets", "pets not allowed", "pets are not allowed", "pets not permitted", "pets are not permitted",
+		"not suitable for pets", "no animals", "pets not accepted", "unable to accept pets", "not pet friendly",
+	}
+	petsConsideredPhrases = []string{
+		"pets considered", "pets will be considered", "pet friendly", "pets allowed", "pets welcome",
+		"pets accepted", "pets permitted", "pets by arrangement", "pets negotiable", "pets ok",
+	}
+)
+
+// petRefusals and petAllowances are species-specific phrases, keyed by pet type. They
+// outrank the general phrases, so "no pets, but cats considered" accepts a cat.
+var (
+	petRefusals = map[string][]string{
+		"cat": {"no cats", "cats not allowed", "cats are not allowed", "cats not permitted", "cats not accepted",
+			"not suitable for cats", "no dogs or cats", "no dogs and cats"},
+		"dog": {"no dogs", "dogs not allowed", "dogs are not allowed", "dogs not permitted", "dogs not accepted",
+			"not suitable for dogs", "not dog friendly", "no cats or dogs", "no cats and dogs", "cats only"},
+	}
+	petAllowances = map[string][]string{
+		"cat": {"cats welcome", "cats considered", "cat considered", "cats will be considered", "cat will be considered", "cats allowed",
+			"cat allowed", "cats accepted", "cats permitted", "cat friendly", "cats ok", "cats only",
+			"cats or dogs considered"},
+		"dog": {"dogs welcome", "dogs considered", "dog considered", "dogs will be considered", "dog will be considered", "dogs allowed",
+			"dog allowed", "dogs accepted", "dogs permitted", "dog friendly", "dogs ok",
+			"dogs or cats considered", "dogs and cats welcome"},
+	}
+)
+
+// ClassifyPets detects a pet policy from a listing description. The pet argument
+// ("cat", "dog" or "other") narrows species-specific phrases such as "no dogs" or
+// "cats considered".
+func ClassifyPets(description, pet string) PetPolicy {
+	text := strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(description, "-", " "))), " ")
+
+	for _, phrase := range petRefusals[pet] {
+		if strings.Contains(text, phrase) {
+			return PetsNotAllowed
+		}
+	}
+	for _, phrase := range petAllowances[pet] {
+		if strings.Contains(text, phrase) {
+			return PetsAllowed
+		}
+	}
+	for _, phrase := range noPetsPhrases {
+		if strings.Contains(text, phrase) {
+			return PetsNotAllowed
+		}
+	}
+	for _, phrase := range petsConsideredPhrases {
+		if strings.Contains(text, phrase) {
+			return PetsAllowed
+		}
+	}
+	return PetsUnknown
+}
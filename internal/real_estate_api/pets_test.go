@@ -0,0 +1,51 @@
+package real_estate_api
+
+import "testing"
+
+func TestClassifyPets(t *testing.T) {
+	tests := []struct {
+		description string
+		pet         string
+		want        PetPolicy
+	}{
+		// General policies apply to every pet
+		{"Bright two bedroom flat. Sorry, no pets.", "dog", PetsNotAllowed},
+		{"Pets are not permitted under the terms of the lease.", "cat", PetsNotAllowed},
+		{"Unfortunately this property is not suitable for pets or smokers.", "other", PetsNotAllowed},
+		{"Garden flat, pet-friendly landlord.", "dog", PetsAllowed},
+		{"Pets considered on request, subject to a higher deposit.", "other", PetsAllowed},
+		{"Not pet friendly.", "cat", PetsNotAllowed},
+		{"Available now. Council tax band C.", "dog", PetsUnknown},
+
+		// Species-specific refusals
+		{"Lovely maisonette, no dogs please.", "dog", PetsNotAllowed},
+		{"Lovely maisonette, no dogs please.", "cat", PetsUnknown},
+		{"No cats due to the freeholder's allergy.", "cat", PetsNotAllowed},
+		{"Dogs are not allowed in the building.", "dog", PetsNotAllowed},
+		{"No cats or dogs.", "dog", PetsNotAllowed},
+		{"No dogs or cats.", "cat", PetsNotAllowed},
+		{"Cats only, sorry.", "dog", PetsNotAllowed},
+		{"No dogs, but pets considered.", "dog", PetsNotAllowed},
+		{"No dogs, but pets considered.", "cat", PetsAllowed},
+
+		// Species-specific allowances, which outrank a general refusal
+		{"Dogs welcome! Walking distance to Victoria Park.", "dog", PetsAllowed},
+		{"Cats considered with a reference from a previous landlord.", "cat", PetsAllowed},
+		{"Cats considered with a reference from a previous landlord.", "dog", PetsUnknown},
+		{"Small dog considered.", "dog", PetsAllowed},
+		{"Cat-friendly flat with a secure garden.", "cat", PetsAllowed},
+		{"No pets, although a cat will be considered.", "cat", PetsAllowed},
+		{"No pets, although cats will be considered.", "cat", PetsAllowed},
+		{"No pets except cats, cats only.", "cat", PetsAllowed},
+		{"Cats or dogs considered.", "dog", PetsAllowed},
+		{"Dogs or cats considered.", "cat", PetsAllowed},
+		{"Dogs and cats welcome.", "dog", PetsAllowed},
+		{"DOGS   WELCOME", "dog", PetsAllowed},
+		{"Dogs welcome.", "other", PetsUnknown},
+	}
+	for _, tt := range tests {
+		if got := ClassifyPets(tt.description, tt.pet); got != tt.want {
+			t.Errorf("ClassifyPets(%q, %q) = %q, want %q", tt.description, tt.pet, got, tt.want)
+		}
+	}
+}
@@ -1,13 +1,17 @@
 package real_estate_api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"rent_seekerbot/internal/metrics"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -22,18 +26,47 @@ type ZooplaClient struct {
 	AgencyRef    string
 	Token        string
 	TokenExpiry  time.Time
+	// mu guards Token and TokenExpiry, as searches run concurrently.
+	mu sync.Mutex
 }
 
 type Property struct {
-	ID          string `json:"listing_id"`
-	Address     string `json:"address"`
-	Price       int    `json:"price"`
-	Bedrooms    int    `json:"num_bedrooms"`
-	Description string `json:"description"`
-	URL         string `json:"details_url"`
+	ID          string  `json:"listing_id"`
+	Address     string  `json:"address"`
+	Price       int     `json:"price"`
+	Bedrooms    int     `json:"num_bedrooms"`
+	Description string  `json:"description"`
+	URL         string  `json:"details_url"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	// ImageURL is the listing's main photo, or "" when it has none.
+	ImageURL string `json:"image_url"`
+	// FirstPublished is when the listing went live, in publishedLayout. See ListedAt.
+	FirstPublished string `json:"first_published_date"`
+	// Pets is set by clients that know the pet policy; otherwise it is left empty.
+	Pets PetPolicy `json:"-"`
 	// Add more fields as needed
 }
 
+// publishedLayout is the layout of the dates in listings, in UK time.
+const publishedLayout = time.DateTime
+
+// ukTime is the time zone listing dates are given in.
+var ukTime = func() *time.Location {
+	location, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}()
+
+// ListedAt returns when the listing went live. It reports false when the provider
+// didn't say.
+func (p Property) ListedAt() (time.Time, bool) {
+	listed, err := time.ParseInLocation(publishedLayout, p.FirstPublished, ukTime)
+	return listed, err == nil
+}
+
 func NewZooplaClient(clientID, clientSecret, agencyRef string) *ZooplaClient {
 	return &ZooplaClient{
 		ClientID:     clientID,
@@ -42,17 +75,22 @@ func NewZooplaClient(clientID, clientSecret, agencyRef string) *ZooplaClient {
 	}
 }
 
-func (c *ZooplaClient) getToken() error {
+// getToken returns the cached access token, requesting a new one when it has expired.
+func (c *ZooplaClient) getToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.Token != "" && time.Now().Before(c.TokenExpiry) {
-		return nil
+		metrics.ObserveCacheLookup("zoopla_token", true)
+		return c.Token, nil
 	}
+	metrics.ObserveCacheLookup("zoopla_token", false)
 
 	data := url.Values{}
 	data.Set("grant_type", "client_credentials")
 
-	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(data.Encode()))
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
@@ -61,13 +99,13 @@ func (c *ZooplaClient) getToken() error {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	var result struct {
@@ -76,20 +114,21 @@ func (c *ZooplaClient) getToken() error {
 	}
 
 	if err := json.Unmarshal(body, &result); err != nil {
-		return err
+		return "", err
 	}
 
 	c.Token = result.AccessToken
 	c.TokenExpiry = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
 
-	return nil
+	return c.Token, nil
 }
 
-func (c *ZooplaClient) SearchProperties(area string, minPrice, maxPrice, bedrooms int, propertyType string) ([]Property, error) {
-	log.Printf("Searching for properties: area=%s, minPrice=%d, maxPrice=%d, bedrooms=%d, type=%s",
-		area, minPrice, maxPrice, bedrooms, propertyType)
+func (c *ZooplaClient) SearchProperties(ctx context.Context, area string, minPrice, maxPrice, bedrooms int, propertyType string) ([]Property, error) {
+	slog.DebugContext(ctx, "Searching for properties", "area", area, "min_price", minPrice, "max_price", maxPrice,
+		"bedrooms", bedrooms, "property_type", propertyType)
 
-	if err := c.getToken(); err != nil {
+	token, err := c.getToken(ctx)
+	if err != nil {
 		return nil, fmt.Errorf("error getting token %v", err)
 	}
 
@@ -101,25 +140,27 @@ func (c *ZooplaClient) SearchProperties(area string, minPrice, maxPrice, bedroom
 	query.Add("minimum_beds", fmt.Sprintf("%d", bedrooms))
 	query.Add("property_type", propertyType)
 
-	req, err := http.NewRequest("GET", inventoryURL+"?"+query.Encode(), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", inventoryURL+"?"+query.Encode(), nil)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("AgencyRef", c.AgencyRef)
-	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Authorization", "Bearer "+token)
 
-	log.Printf("Sending request to Zoopla API: %s", req.URL.String())
+	// The query string holds the searched area, so only the endpoint is logged
+	slog.DebugContext(ctx, "Sending request to Zoopla API", "endpoint", inventoryURL)
 
 	client := &http.Client{}
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, withoutQuery(err)
 	}
 
 	defer resp.Body.Close()
 
-	log.Printf("Received response from Zoopla API. Status: %s", resp.Status)
+	slog.DebugContext(ctx, "Received response from Zoopla API", "status", resp.StatusCode, "duration", time.Since(start))
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -131,32 +172,38 @@ func (c *ZooplaClient) SearchProperties(area string, minPrice, maxPrice, bedroom
 	}
 
 	if err := json.Unmarshal(body, &result); err != nil {
-		log.Printf("Error unmarshaling JSON: %v. Body: %s", err, string(body))
+		slog.ErrorContext(ctx, "Error unmarshaling Zoopla API response", "error", err, "status", resp.StatusCode, "body_bytes", len(body))
 		return nil, err
 	}
 
-	log.Printf("Successfully parsed %d properties from Zoopla API response", len(result.Properties))
+	slog.DebugContext(ctx, "Parsed Zoopla API response", "properties", len(result.Properties))
 
 	return result.Properties, nil
 }
-func (c *ZooplaClient) TestApiConnection() error {
+
+// withoutQuery replaces a *url.Error's URL with the endpoint, since the query string
+// holds the searched area and prices and the error ends up in the logs.
+func withoutQuery(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%s %s: %w", urlErr.Op, inventoryURL, urlErr.Err)
+	}
+	return err
+}
+
+func (c *ZooplaClient) TestApiConnection(ctx context.Context) error {
 	// Test if we can get a token
-	err := c.getToken()
+	_, err := c.getToken(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get token: %w", err)
 	}
 	// Try a simple search
-	properties, err := c.SearchProperties("London", 1000, 2000, 2, "Flat")
+	properties, err := c.SearchProperties(ctx, "London", 1000, 2000, 2, "Flat")
 	if err != nil {
 		return fmt.Errorf("failed to search propeties: %w", err)
 	}
 
-	// print the first of the results
-	if len(properties) > 0 {
-		log.Printf("Successfully retrieved %d properties. First property: %+v", len(properties), properties[0])
-	} else {
-		log.Println("Search successful, but no properties found.")
-	}
+	slog.InfoContext(ctx, "Zoopla API test search succeeded", "properties", len(properties))
 
 	return nil
 }
@@ -1,6 +1,16 @@
 package real_estate_api
 
+import "context"
+
+// ZooplaClientInterface is a listings provider. Calls take the context of the update they
+// serve, so the provider's logs carry its correlation ID.
 type ZooplaClientInterface interface {
-	SearchProperties(area string, minPrice, maxPrice, bedrooms int, propertyType string) ([]Property, error)
-	TestApiConnection() error
+	SearchProperties(ctx context.Context, area string, minPrice, maxPrice, bedrooms int, propertyType string) ([]Property, error)
+	TestApiConnection(ctx context.Context) error
+}
+
+// PetFilterer is implemented by clients that can filter listings by pets themselves.
+// The pet argument is "cat", "dog" or "other".
+type PetFilterer interface {
+	SearchPropertiesWithPets(ctx context.Context, area string, minPrice, maxPrice, bedrooms int, propertyType, pet string) ([]Property, error)
 }
@@ -0,0 +1,31 @@
+package real_estate_api
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchErrorLeavesOutQuery(t *testing.T) {
+	c := &ZooplaClient{Token: "token", TokenExpiry: time.Now().Add(time.Hour)}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := c.SearchProperties(ctx, "Hackney", 1234, 5678, 2, "Flat")
+	if err == nil {
+		t.Fatal("SearchProperties() succeeded with a cancelled context")
+	}
+	for _, private := range []string{"Hackney", "1234", "5678", "?"} {
+		if strings.Contains(err.Error(), private) {
+			t.Errorf("error %q contains %q", err, private)
+		}
+	}
+	if !strings.Contains(err.Error(), inventoryURL) {
+		t.Errorf("error %q doesn't name the endpoint", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error %q doesn't wrap the cause", err)
+	}
+}
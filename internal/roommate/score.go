@@ -0,0 +1,104 @@
+package roommate
+
+import (
+	"math"
+	"rent_seekerbot/internal/geo"
+	"time"
+)
+
+const (
+	// MatchThreshold is the lowest score proposed to users as a match.
+	MatchThreshold = 60
+	// maxMoveInGapDays is the largest gap between move-in dates that can still match.
+	maxMoveInGapDays = 45
+	// maxAreaMiles is the furthest apart two preferred areas can be and still count as nearby.
+	maxAreaMiles = 3.0
+)
+
+// Work from home answers.
+const (
+	WorkFromHomeYes       = "yes"
+	WorkFromHomeSometimes = "sometimes"
+	WorkFromHomeNo        = "no"
+)
+
+// Profile holds the answers used to score compatibility between two people.
+type Profile struct {
+	MinBudget    int
+	MaxBudget    int
+	Areas        []geo.Place
+	MoveIn       time.Time
+	Smoker       bool
+	HasPets      bool
+	WorkFromHome string
+	// Cleanliness is a self-assessment from 1 (relaxed) to 5 (spotless).
+	Cleanliness int
+}
+
+// Score returns a compatibility score from 0 to 100. It returns false when a hard
+// constraint fails: budgets don't overlap, move-in dates are too far apart, or the
+// preferred areas are too far from each other.
+func Score(a, b Profile) (int, bool) {
+	budget, ok := budgetOverlap(a, b)
+	if !ok {
+		return 0, false
+	}
+	area, ok := areaProximity(a.Areas, b.Areas)
+	if !ok {
+		return 0, false
+	}
+	gap := math.Abs(a.MoveIn.Sub(b.MoveIn).Hours() / 24)
+	if gap > maxMoveInGapDays {
+		return 0, false
+	}
+
+	score := 25*budget + 20*area + 15*(1-gap/maxMoveInGapDays)
+	if a.Smoker == b.Smoker {
+		score += 15
+	}
+	if a.HasPets == b.HasPets {
+		score += 10
+	} else {
+		score += 5
+	}
+	switch {
+	case a.WorkFromHome == b.WorkFromHome:
+		score += 5
+	case a.WorkFromHome == WorkFromHomeSometimes || b.WorkFromHome == WorkFromHomeSometimes:
+		score += 3
+	}
+	score += math.Max(0, 10-2.5*math.Abs(float64(a.Cleanliness-b.Cleanliness)))
+
+	return int(math.Round(score)), true
+}
+
+// budgetOverlap returns the overlap of two budget ranges as a fraction of the narrower one.
+func budgetOverlap(a, b Profile) (float64, bool) {
+	low := max(a.MinBudget, b.MinBudget)
+	high := min(a.MaxBudget, b.MaxBudget)
+	if low > high {
+		return 0, false
+	}
+	narrowest := min(a.MaxBudget-a.MinBudget, b.MaxBudget-b.MinBudget)
+	if narrowest <= 0 {
+		return 1, true
+	}
+	return math.Min(1, float64(high-low)/float64(narrowest)), true
+}
+
+// areaProximity returns 1 when both share an area, falling to 0 at maxAreaMiles apart.
+func areaProximity(a, b []geo.Place) (float64, bool) {
+	closest := math.Inf(1)
+	for _, pa := range a {
+		for _, pb := range b {
+			if pa.Name == pb.Name {
+				return 1, true
+			}
+			closest = math.Min(closest, geo.DistanceMiles(pa.Latitude, pa.Longitude, pb.Latitude, pb.Longitude))
+		}
+	}
+	if closest > maxAreaMiles {
+		return 0, false
+	}
+	return 1 - closest/maxAreaMiles, true
+}
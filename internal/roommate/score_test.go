@@ -0,0 +1,106 @@
+package roommate
+
+import (
+	"math"
+	"rent_seekerbot/internal/geo"
+	"testing"
+	"time"
+)
+
+var (
+	hackney   = geo.Place{Name: "Hackney", Latitude: 51.5450, Longitude: -0.0553}
+	dalston   = geo.Place{Name: "Dalston", Latitude: 51.5460, Longitude: -0.0750}
+	islington = geo.Place{Name: "Islington", Latitude: 51.5380, Longitude: -0.0990}
+	croydon   = geo.Place{Name: "Croydon", Latitude: 51.3720, Longitude: -0.0990}
+)
+
+var moveIn = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func profile(minBudget, maxBudget int, areas ...geo.Place) Profile {
+	return Profile{MinBudget: minBudget, MaxBudget: maxBudget, Areas: areas, MoveIn: moveIn,
+		WorkFromHome: WorkFromHomeNo, Cleanliness: 3}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   Profile
+		want   int
+		wantOK bool
+	}{
+		{"identical", profile(800, 1200, hackney), profile(800, 1200, hackney), 100, true},
+		{
+			// Half the budget overlaps (12.5), same area (20), 9 days apart (12), different
+			// smoking (0) and pets (5), work from home yes and sometimes (3), cleanliness 3
+			// and 4 (7.5)
+			name: "partial",
+			a:    Profile{MinBudget: 800, MaxBudget: 1200, Areas: []geo.Place{hackney}, MoveIn: moveIn, Smoker: true, WorkFromHome: WorkFromHomeYes, Cleanliness: 3},
+			b:    Profile{MinBudget: 1000, MaxBudget: 1400, Areas: []geo.Place{hackney}, MoveIn: moveIn.AddDate(0, 0, 9), HasPets: true, WorkFromHome: WorkFromHomeSometimes, Cleanliness: 4},
+			want: 60, wantOK: true,
+		},
+		{"budgets apart", profile(800, 1000, hackney), profile(1100, 1400, hackney), 0, false},
+		{"areas too far apart", profile(800, 1200, hackney), profile(800, 1200, croydon), 0, false},
+		{"move-in too far apart", profile(800, 1200, hackney), Profile{MinBudget: 800, MaxBudget: 1200, Areas: []geo.Place{hackney}, MoveIn: moveIn.AddDate(0, 0, 46)}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Score(tt.a, tt.b)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Score() = %d, %v; want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+			if reversed, _ := Score(tt.b, tt.a); reversed != got {
+				t.Errorf("Score() isn't symmetric: %d one way, %d the other", got, reversed)
+			}
+		})
+	}
+}
+
+func TestBudgetOverlap(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   Profile
+		want   float64
+		wantOK bool
+	}{
+		{"same range", profile(800, 1200), profile(800, 1200), 1, true},
+		{"one inside the other", profile(900, 1000), profile(800, 1200), 1, true},
+		{"half of the narrower range", profile(800, 1200), profile(1000, 1600), 0.5, true},
+		{"touching", profile(800, 1000), profile(1000, 1200), 0, true},
+		{"fixed budget inside a range", profile(1000, 1000), profile(800, 1200), 1, true},
+		{"apart", profile(800, 900), profile(1000, 1200), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := budgetOverlap(tt.a, tt.b)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("budgetOverlap() = %v, %v; want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestAreaProximity(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   []geo.Place
+		want   float64
+		wantOK bool
+	}{
+		{"shared area", []geo.Place{hackney, croydon}, []geo.Place{croydon}, 1, true},
+		{"nearby", []geo.Place{hackney}, []geo.Place{dalston}, 1 - geo.DistanceMiles(hackney.Latitude, hackney.Longitude, dalston.Latitude, dalston.Longitude)/maxAreaMiles, true},
+		{"closest pair counts", []geo.Place{croydon, hackney}, []geo.Place{islington}, 1 - geo.DistanceMiles(hackney.Latitude, hackney.Longitude, islington.Latitude, islington.Longitude)/maxAreaMiles, true},
+		{"too far", []geo.Place{hackney}, []geo.Place{croydon}, 0, false},
+		{"no areas", nil, []geo.Place{hackney}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := areaProximity(tt.a, tt.b)
+			if math.Abs(got-tt.want) > 1e-9 || ok != tt.wantOK {
+				t.Errorf("areaProximity() = %v, %v; want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+			if tt.wantOK && tt.want != 1 && (got <= 0 || got >= 1) {
+				t.Errorf("areaProximity() = %v, want between 0 and 1 for different areas", got)
+			}
+		})
+	}
+}
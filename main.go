@@ -1,70 +1,91 @@
 package main
 
 import (
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"os"
 	"rent_seekerbot/internal/bot"
 	"rent_seekerbot/internal/config"
 	"rent_seekerbot/internal/database"
+	"rent_seekerbot/internal/logging"
 	"rent_seekerbot/internal/real_estate_api"
 )
 
 func main() {
-	config.LoadConfig()
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		// Logging isn't configured yet
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	token := config.GetEnv("TELEGRAM_BOT_TOKEN")
-	if token == "" {
-		log.Fatal("TELEGRAM_BOT_TOKEN must be set")
+	logger, err := logging.New(os.Stderr, logging.Options{
+		Level:           cfg.Log.Level,
+		LogPersonalData: cfg.Log.PersonalData,
+	})
+	if err != nil {
+		fatal("Invalid logging configuration", err)
 	}
-	db, err := database.NewDB("rent_seeker.db")
+	// Also routes the standard logger, used by the Telegram library, through the JSON handler
+	slog.SetDefault(logger)
+
+	db, err := database.NewDB(cfg.DatabaseDSN)
 	if err != nil {
-		log.Fatal(err)
+		fatal("Error opening database", err)
 	}
-	defer db.Close()
 
 	err = db.CreateTables()
 	if err != nil {
-		log.Fatal(err)
+		fatal("Error creating tables", err)
 	}
 
-	//zooplaClient := real_estate_api.NewZooplaClient(
-	//	config.GetEnv("ZOOPLA_CLIENT_ID"),
-	//	config.GetEnv("ZOOPLA_CLIENT_SECRET"),
-	//	config.GetEnv("ZOOPLA_AGENCY_REF"),
-	//)
-	//
-	//// Test Zoopla API connection
-	//log.Println("Testing Zoopla API connection...")
-	//err = zooplaClient.TestApiConnection()
-	//if err != nil {
-	//	log.Fatalf("Zoopla API test failed: %v", err)
-	//}
-	//log.Printf("Zoopla API test successful!")
-
 	var zooplaClient real_estate_api.ZooplaClientInterface
 
-	if os.Getenv("USE_MOCK_ZOOPLA") == "true" {
+	if cfg.Provider.Name == config.ProviderMock {
 		zooplaClient = real_estate_api.NewMockZooplaClient()
-		log.Println("Using mock Zoopla client")
+		slog.Info("Using mock Zoopla client")
 	} else {
 		zooplaClient = real_estate_api.NewZooplaClient(
-			config.GetEnv("ZOOPLA_CLIENT_ID"),
-			config.GetEnv("ZOOPLA_CLIENT_SECRET"),
-			config.GetEnv("ZOOPLA_AGENCY_REF"),
+			cfg.Provider.ClientID,
+			cfg.Provider.ClientSecret,
+			cfg.Provider.AgencyRef,
 		)
 	}
 
-	// Test API connection
-	log.Println("Testing API connection...")
-	err = zooplaClient.TestApiConnection()
-	if err != nil {
-		log.Fatalf("API test failed: %v", err)
+	options := bot.Options{
+		Mode:           cfg.Updates.Mode,
+		WebhookURL:     cfg.Updates.WebhookURL,
+		ListenAddr:     cfg.Updates.ListenAddr,
+		SecretToken:    cfg.Updates.SecretToken,
+		TLSCertFile:    cfg.Updates.TLSCertFile,
+		TLSKeyFile:     cfg.Updates.TLSKeyFile,
+		AdminIDs:       cfg.AdminIDs,
+		HealthAddr:     cfg.HealthAddr,
+		PollTimeout:    cfg.Updates.PollTimeout,
+		Workers:        cfg.Limits.Workers,
+		SearchBurst:    cfg.Limits.SearchBurst,
+		SearchInterval: cfg.Limits.SearchInterval,
+		AlertInterval:  cfg.Limits.AlertInterval,
 	}
-	log.Printf("API test successful!")
 
 	// Start the bot
-	err = bot.StartBot(token, zooplaClient, db)
+	err = bot.StartBot(cfg.TelegramToken, zooplaClient, db, options)
+	if err != nil {
+		fatal("Failed to start bot", err)
+	}
+}
+
+// fatal logs an error that stops the bot from starting and exits.
+func fatal(msg string, err error) {
 	if err != nil {
-		log.Fatalf("Failed to start bot: %v", err)
+		slog.Error(msg, "error", err)
+	} else {
+		slog.Error(msg)
 	}
+	os.Exit(1)
 }